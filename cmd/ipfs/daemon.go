@@ -380,6 +380,10 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		return err
 	}
 
+	// release expired pins
+	reapErrc := runPinReaper(req, node)
+	queueErrc := runPinQueue(req, node)
+
 	// construct http gateway - if it is set in the config
 	var gwErrc <-chan error
 	if len(cfg.Addresses.Gateway) > 0 {
@@ -396,7 +400,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	fmt.Printf("Daemon is ready\n")
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
-	for err := range merge(apiErrc, gwErrc, gcErrc) {
+	for err := range merge(apiErrc, gwErrc, gcErrc, reapErrc, queueErrc) {
 		if err != nil {
 			return err
 		}
@@ -646,6 +650,26 @@ func maybeRunGC(req *cmds.Request, node *core.IpfsNode) (<-chan error, error) {
 	return errc, nil
 }
 
+func runPinReaper(req *cmds.Request, node *core.IpfsNode) <-chan error {
+	errc := make(chan error)
+	go func() {
+		errc <- corerepo.PeriodicPinReaper(req.Context, node)
+		close(errc)
+	}()
+	return errc
+}
+
+// runPinQueue processes the pins queued with 'ipfs pin add --background',
+// including the ones left over from a previous run.
+func runPinQueue(req *cmds.Request, node *core.IpfsNode) <-chan error {
+	errc := make(chan error)
+	go func() {
+		errc <- node.PinQueue.Run(req.Context)
+		close(errc)
+	}()
+	return errc
+}
+
 // merge does fan-in of multiple read-only error channels
 // taken from http://blog.golang.org/pipelines
 func merge(cs ...<-chan error) <-chan error {
@@ -5,12 +5,17 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"syscall"
 	"time"
 
+	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 	pin "github.com/ipfs/go-ipfs/pin"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+	pinqueue "github.com/ipfs/go-ipfs/pin/pinqueue"
 	repo "github.com/ipfs/go-ipfs/repo"
 	cidv0v1 "github.com/ipfs/go-ipfs/thirdparty/cidv0v1"
 	"github.com/ipfs/go-ipfs/thirdparty/verifbs"
@@ -226,8 +231,20 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		n.Filestore = filestore.NewFilestore(bs, n.Repo.FileManager())
 		n.Blockstore = bstore.NewGCBlockstore(n.Filestore, n.GCLocker)
 		n.Blockstore = &verifbs.VerifBSGC{GCBlockstore: n.Blockstore}
+
+		if err := configureUrlstore(n.Repo, n.Filestore.FileManager()); err != nil {
+			return err
+		}
+	}
+
+	// record the block accesses used to pick the blocks to evict
+	if v, _ := n.Repo.GetConfigKey(GCEvictionConfigKey); v != nil && v != "" {
+		n.Blockstore = gc.NewAccessBlockstore(n.Blockstore, n.Repo.Datastore())
 	}
 
+	// record the blocks written during concurrent garbage collections
+	n.Blockstore = gc.NewTrackingBlockstore(n.Blockstore)
+
 	rcfg, err := n.Repo.Config()
 	if err != nil {
 		return err
@@ -256,17 +273,42 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		n.Exchange = offline.Exchange(n.Blockstore)
 	}
 
+	// the roots added while offline are provided once the node is online
+	n.ProvideQueue, err = rp.NewQueue(n.Repo.Datastore())
+	if err != nil {
+		return err
+	}
+
 	n.Blocks = bserv.New(n.Blockstore, n.Exchange)
 	n.DAG = dag.NewDAGService(n.Blocks)
 
 	internalDag := dag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
-	n.Pinning, err = pin.LoadPinner(n.Repo.Datastore(), n.DAG, internalDag)
+	if repo.ConfigBool(n.Repo, datastorePinnerConfigKey) {
+		n.Pinning, err = pin.LoadDatastorePinner(n.Repo.Datastore(), n.DAG, internalDag)
+		if err != nil {
+			return err
+		}
+	} else {
+		n.Pinning, err = pin.LoadPinner(n.Repo.Datastore(), n.DAG, internalDag)
+		if err == pin.ErrDatastorePins {
+			return fmt.Errorf("%s, set %s to true again to load them", err, datastorePinnerConfigKey)
+		}
+		if err != nil {
+			// TODO: we should move towards only running 'NewPinner' explicitly on
+			// node init instead of implicitly here as a result of the pinner keys
+			// not being found in the datastore.
+			// this is kinda sketchy and could cause data loss
+			n.Pinning = pin.NewPinner(n.Repo.Datastore(), n.DAG, internalDag)
+		}
+	}
+	if repo.ConfigBool(n.Repo, pinRefIndexConfigKey) {
+		if err := pin.EnableRefIndex(n.Pinning); err != nil {
+			return err
+		}
+	}
+	n.PinQueue, err = pinqueue.New(n.Repo.Datastore(), n.Blockstore, n.Pinning, n.DAG)
 	if err != nil {
-		// TODO: we should move towards only running 'NewPinner' explicitly on
-		// node init instead of implicitly here as a result of the pinner keys
-		// not being found in the datastore.
-		// this is kinda sketchy and could cause data loss
-		n.Pinning = pin.NewPinner(n.Repo.Datastore(), n.DAG, internalDag)
+		return err
 	}
 	n.Resolver = resolver.NewBasicResolver(n.DAG)
 
@@ -278,3 +320,67 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 
 	return n.loadFilesRoot()
 }
+
+// datastorePinnerConfigKey enables the pinner storing each pin under its own
+// datastore key. Existing pins are migrated when it is first enabled. It is
+// not part of the config struct, so it lives in its own section, which
+// SetConfig leaves untouched.
+const datastorePinnerConfigKey = "Pinning.DatastorePinner"
+
+// pinRefIndexConfigKey enables the index used to look up indirect pins
+// without walking every recursive pin.
+const pinRefIndexConfigKey = "Pinning.RefIndex"
+
+// GCEvictionConfigKey selects the policy used by corerepo to evict blocks
+// when the storage watermark is crossed, gc.EvictLRU or gc.EvictLFU, instead
+// of removing every unpinned block. Block accesses are only recorded when it
+// is set.
+const GCEvictionConfigKey = "GC.Eviction"
+
+// urlstoreHeadersConfigKey maps hosts to the HTTP headers sent along the
+// urlstore requests to them, as in {"example.com": {"Authorization":
+// "Bearer <token>"}}.
+const urlstoreHeadersConfigKey = "Urlstore.Headers"
+
+// urlstoreRetriesConfigKey is the number of times failed urlstore requests
+// are retried.
+const urlstoreRetriesConfigKey = "Urlstore.Retries"
+
+// configureUrlstore applies the urlstore config keys, which are not part of
+// the config struct, to the file manager.
+func configureUrlstore(r repo.Repo, fm *filestore.FileManager) error {
+	if v, _ := r.GetConfigKey(urlstoreRetriesConfigKey); v != nil {
+		// numbers are decoded from the JSON config as float64
+		retries, ok := v.(float64)
+		if !ok || retries < 0 {
+			return fmt.Errorf("invalid %s %v, expected a positive number", urlstoreRetriesConfigKey, v)
+		}
+		fm.URLRetries = int(retries)
+	}
+
+	v, _ := r.GetConfigKey(urlstoreHeadersConfigKey)
+	if v == nil {
+		return nil
+	}
+	hosts, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid %s, expected an object mapping hosts to headers", urlstoreHeadersConfigKey)
+	}
+	fm.URLHeaders = make(map[string]http.Header, len(hosts))
+	for host, hv := range hosts {
+		headers, ok := hv.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid %s for %s, expected an object mapping names to values", urlstoreHeadersConfigKey, host)
+		}
+		h := make(http.Header, len(headers))
+		for name, value := range headers {
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid %s for %s, the value of %s is not a string", urlstoreHeadersConfigKey, host, name)
+			}
+			h.Set(name, s)
+		}
+		fm.URLHeaders[host] = h
+	}
+	return nil
+}
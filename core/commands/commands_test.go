@@ -30,6 +30,7 @@ func TestROCommands(t *testing.T) {
 		"/ls",
 		"/name",
 		"/name/resolve",
+		"/name/rollback",
 		"/object",
 		"/object/data",
 		"/object/get",
@@ -125,6 +126,8 @@ func TestCommands(t *testing.T) {
 		"/filestore",
 		"/filestore/dups",
 		"/filestore/ls",
+		"/filestore/mv",
+		"/filestore/rm",
 		"/filestore/verify",
 		"/files/write",
 		"/get",
@@ -141,12 +144,17 @@ func TestCommands(t *testing.T) {
 		"/ls",
 		"/mount",
 		"/name",
+		"/name/cache",
+		"/name/cache/clear",
+		"/name/cache/ls",
+		"/name/history",
 		"/name/publish",
 		"/name/pubsub",
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
 		"/name/pubsub/cancel",
 		"/name/resolve",
+		"/name/rollback",
 		"/object",
 		"/object/data",
 		"/object/diff",
@@ -170,9 +178,17 @@ func TestCommands(t *testing.T) {
 		"/p2p/stream/ls",
 		"/pin",
 		"/pin/add",
+		"/pin/export",
+		"/pin/import",
 		"/ping",
 		"/pin/ls",
+		"/pin/reindex",
+		"/pin/remote",
+		"/pin/remote/add",
+		"/pin/remote/ls",
+		"/pin/remote/rm",
 		"/pin/rm",
+		"/pin/status",
 		"/pin/update",
 		"/pin/verify",
 		"/pubsub",
@@ -185,6 +201,10 @@ func TestCommands(t *testing.T) {
 		"/repo",
 		"/repo/fsck",
 		"/repo/gc",
+		"/repo/gc/protect",
+		"/repo/gc/protect/add",
+		"/repo/gc/protect/ls",
+		"/repo/gc/protect/rm",
 		"/repo/stat",
 		"/repo/verify",
 		"/repo/version",
@@ -193,6 +213,7 @@ func TestCommands(t *testing.T) {
 		"/stats",
 		"/stats/bitswap",
 		"/stats/bw",
+		"/stats/provide",
 		"/stats/repo",
 		"/swarm",
 		"/swarm/addrs",
@@ -210,6 +231,9 @@ func TestCommands(t *testing.T) {
 		"/update",
 		"/urlstore",
 		"/urlstore/add",
+		"/urlstore/ls",
+		"/urlstore/rm",
+		"/urlstore/verify",
 		"/version",
 		"/cid",
 		"/cid/format",
@@ -12,6 +12,7 @@ import (
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	repo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/common"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	"gx/ipfs/QmP2i47tnU23ijdshrZtuvrSkQPtf9HhsMb9fwGVe8owj2/jsondiff"
@@ -118,6 +119,7 @@ Set the value of the 'Datastore.Path' key:
 		if err != nil {
 			return err
 		}
+		output.Value = redactConfigValue(key, output.Value)
 
 		return res.Emit(output)
 	},
@@ -144,7 +146,10 @@ var configShowCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Output config file contents.",
 		ShortDescription: `
-NOTE: For security reasons, this command will omit your private key. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
+NOTE: For security reasons, this command will omit your private key, and
+replace the values of the headers of Urlstore.Headers and the keys of
+Pinning.RemoteServices. If you would like to make a full backup of your config
+(private key included), you must copy the config file from your repo.
 `,
 	},
 	Type: map[string]interface{}{},
@@ -174,6 +179,7 @@ NOTE: For security reasons, this command will omit your private key. If you woul
 		if err != nil {
 			return err
 		}
+		redactSecrets(cfg)
 
 		return cmds.EmitOnce(res, &cfg)
 	},
@@ -232,6 +238,62 @@ func scrubValue(m map[string]interface{}, key []string) error {
 	return nil
 }
 
+// redactedValue replaces the secret values in the output of the config
+// commands.
+const redactedValue = "<redacted>"
+
+// redactSecrets replaces the secret values of the given config, which are
+// not part of the config struct, with redactedValue. These are the values of
+// the headers sent to the urlstore hosts, which usually hold credentials, and
+// the keys of the remote pinning services.
+func redactSecrets(cfg map[string]interface{}) {
+	urlstore, _ := cfg["Urlstore"].(map[string]interface{})
+	hosts, _ := urlstore["Headers"].(map[string]interface{})
+	for _, h := range hosts {
+		headers, ok := h.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name := range headers {
+			headers[name] = redactedValue
+		}
+	}
+
+	pinning, _ := cfg["Pinning"].(map[string]interface{})
+	services, _ := pinning["RemoteServices"].(map[string]interface{})
+	for _, s := range services {
+		svc, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := svc["Key"]; ok {
+			svc["Key"] = redactedValue
+		}
+	}
+}
+
+// redactConfigValue redacts the secrets of the value of the given key, as
+// redactSecrets does for the whole config.
+func redactConfigValue(key string, value interface{}) interface{} {
+	parts := strings.Split(key, ".")
+	cfg := make(map[string]interface{})
+	cur := cfg
+	for _, part := range parts[:len(parts)-1] {
+		next := make(map[string]interface{})
+		cur[part] = next
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = value
+
+	redactSecrets(cfg)
+
+	redacted, err := common.MapGetKV(cfg, key)
+	if err != nil {
+		return value
+	}
+	return redacted
+}
+
 var configEditCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Open the config file for editing in $EDITOR.",
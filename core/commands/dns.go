@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	ncmd "github.com/ipfs/go-ipfs/core/commands/name"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	nsopts "github.com/ipfs/go-ipfs/namesys/opts"
@@ -63,7 +64,20 @@ The resolver can recursively resolve:
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		recursive, _ := req.Options[dnsRecursiveOptionName].(bool)
 		name := req.Arguments[0]
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.OnlineMode() {
+			if err := n.SetupOfflineRouting(); err != nil {
+				return err
+			}
+		}
+
 		resolver := namesys.NewDNSResolver()
+		if n.DNSResolver != nil {
+			resolver = n.DNSResolver
+		}
 
 		var ropts []nsopts.ResolveOpt
 		if !recursive {
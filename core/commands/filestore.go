@@ -1,16 +1,20 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
+	util "github.com/ipfs/go-ipfs/blocks/blockstoreutil"
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
@@ -23,11 +27,15 @@ var FileStoreCmd = &cmds.Command{
 		"ls":     lsFileStore,
 		"verify": verifyFileStore,
 		"dups":   dupsFileStore,
+		"rm":     rmFileStore,
+		"mv":     mvFileStore,
 	},
 }
 
 const (
 	fileOrderOptionName = "file-order"
+	quickOptionName     = "quick"
+	removeBadOptionName = "remove-bad"
 )
 
 var lsFileStore = &cmds.Command{
@@ -57,7 +65,7 @@ The output is:
 		}
 		args := req.Arguments
 		if len(args) > 0 {
-			return listByArgs(res, fs, args)
+			return listByArgs(res, fs, args, filestore.Verify)
 		}
 
 		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
@@ -113,6 +121,17 @@ missing:  <obj> could not be found in the filestore
 ERROR:    internal error, most likely due to a corrupt database
 
 For ERROR entries the error will also be printed to stderr.
+
+With --quick, the backing files are not read: a block is reported as changed
+when the size or modification time of its file differ from the ones recorded
+when it was added, or when the file is too short to hold it. URLs are checked
+with a HEAD request.
+
+With --remove-bad, the references with the no-file and changed statuses are
+removed once they are all verified. With --quick, the data of these references
+is read first, and they are only removed if it can not be read or changed. The
+references to pinned blocks are kept unless --force is given. The blocks they
+reference can then be added again, or fetched from the network.
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -120,23 +139,56 @@ For ERROR entries the error will also be printed to stderr.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(fileOrderOptionName, "verify the objects based on the order of the backing file"),
+		cmdkit.BoolOption(quickOptionName, "only check the size and modification time of the backing files, without reading them"),
+		cmdkit.BoolOption(removeBadOptionName, "remove the references to missing or changed files"),
+		cmdkit.BoolOption(forceOptionName, "f", "remove the references to pinned blocks too"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		_, fs, err := getFilestore(env)
+		n, fs, err := getFilestore(env)
 		if err != nil {
 			return err
 		}
+		quick, _ := req.Options[quickOptionName].(bool)
+		removeBad, _ := req.Options[removeBadOptionName].(bool)
+		force, _ := req.Options[forceOptionName].(bool)
 		args := req.Arguments
 		if len(args) > 0 {
-			return listByArgs(res, fs, args)
+			verify := filestore.Verify
+			if quick {
+				verify = filestore.VerifyQuick
+			}
+			if !removeBad {
+				return listByArgs(res, fs, args, verify)
+			}
+
+			var bad []cid.Cid
+			err := listByArgs(res, fs, args, func(fs *filestore.Filestore, c cid.Cid) *filestore.ListRes {
+				r := verify(fs, c)
+				if isBadRef(r) {
+					bad = append(bad, c)
+				}
+				return r
+			})
+			if err != nil {
+				return err
+			}
+			if quick {
+				bad = confirmBadRefs(fs, bad)
+			}
+			return removeRefs(n, fs, bad, force)
 		}
 
 		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
-		next, err := filestore.VerifyAll(fs, fileOrder)
+		verifyAll := filestore.VerifyAll
+		if quick {
+			verifyAll = filestore.VerifyAllQuick
+		}
+		next, err := verifyAll(fs, fileOrder)
 		if err != nil {
 			return err
 		}
 
+		var bad []cid.Cid
 		for {
 			r := next()
 			if r == nil {
@@ -145,9 +197,16 @@ For ERROR entries the error will also be printed to stderr.
 			if err := res.Emit(r); err != nil {
 				return err
 			}
+			if removeBad && isBadRef(r) {
+				bad = append(bad, r.Key)
+			}
 		}
 
-		return nil
+		// removed once the datastore query is done
+		if quick {
+			bad = confirmBadRefs(fs, bad)
+		}
+		return removeRefs(n, fs, bad, force)
 	},
 	PostRun: cmds.PostRunMap{
 		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
@@ -175,6 +234,261 @@ For ERROR entries the error will also be printed to stderr.
 	Type: filestore.ListRes{},
 }
 
+// isBadRef returns whether the verified reference points to a file which was
+// removed or changed. Other errors may be temporary, and are left alone.
+func isBadRef(r *filestore.ListRes) bool {
+	return r.Key.Defined() && (r.Status == filestore.StatusFileNotFound || r.Status == filestore.StatusFileChanged)
+}
+
+// confirmBadRefs reads the data of the references found bad by a quick
+// verification, whose files may only have been touched, and returns the ones
+// which are still bad.
+func confirmBadRefs(fs *filestore.Filestore, refs []cid.Cid) []cid.Cid {
+	out := refs[:0]
+	for _, c := range refs {
+		if isBadRef(filestore.Verify(fs, c)) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// removeRefs removes the given references under the GC lock, so that the
+// blocks can not be pinned meanwhile. The references to pinned blocks are
+// kept unless force is set.
+func removeRefs(n *core.IpfsNode, fs *filestore.Filestore, refs []cid.Cid, force bool) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	defer n.Blockstore.GCLock().Unlock()
+
+	refs, pinned, err := filterPinnedRefs(n, refs, force)
+	if err != nil {
+		return err
+	}
+	for _, c := range refs {
+		if err := fs.FileManager().DeleteBlock(c); err != nil && err != bstore.ErrNotFound {
+			return fmt.Errorf("removing the reference to %s: %s", c, err)
+		}
+	}
+	if len(pinned) > 0 {
+		return fmt.Errorf("kept %d references to pinned blocks, use --%s to remove them", len(pinned), forceOptionName)
+	}
+	return nil
+}
+
+// filterPinnedRefs returns the given references without the pinned blocks,
+// and the pinned blocks along with the reason they are pinned. Nothing is
+// filtered out when force is set. The GC lock must be held.
+func filterPinnedRefs(n *core.IpfsNode, refs []cid.Cid, force bool) ([]cid.Cid, []*util.RemovedBlock, error) {
+	if force {
+		return refs, nil, nil
+	}
+
+	out := make(chan interface{}, len(refs))
+	refs = util.FilterPinned(n.Pinning, out, refs)
+	close(out)
+
+	var pinned []*util.RemovedBlock
+	for v := range out {
+		r := v.(*util.RemovedBlock)
+		if r.Hash == "" {
+			return nil, nil, errors.New(r.Error)
+		}
+		pinned = append(pinned, r)
+	}
+	return refs, pinned, nil
+}
+
+// FilestoreRmOutput is a reference removed by 'ipfs filestore rm', or the
+// argument which could not be removed along with the error.
+type FilestoreRmOutput struct {
+	Ref   string
+	Error string `json:",omitempty"`
+}
+
+var rmFileStore = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove references from the filestore.",
+		LongDescription: `
+Remove references from the filestore, without touching the referenced files.
+
+Each argument is either the cid of a block, or the path of a file or URL, in
+which case the references to all its blocks are removed. The references to
+the files under a directory are removed as well. The removed blocks can no
+longer be read, unless they are also stored in the repo.
+
+The references to pinned blocks are kept unless --force is given.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("obj", true, true, "Cids of blocks, or paths of files or directories, to remove the references of."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(forceOptionName, "f", "remove the references to pinned blocks too"),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		for i, arg := range req.Arguments {
+			if _, err := cid.Decode(arg); err == nil {
+				continue
+			}
+			p, err := absFilestorePath(arg)
+			if err != nil {
+				return err
+			}
+			req.Arguments[i] = p
+		}
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, fs, err := getFilestore(env)
+		if err != nil {
+			return err
+		}
+		force, _ := req.Options[forceOptionName].(bool)
+
+		// the blocks can not be pinned while their references are removed
+		defer n.Blockstore.GCLock().Unlock()
+
+		for _, arg := range req.Arguments {
+			outs, err := removeFilestoreArg(n, fs, arg, force)
+			if err != nil {
+				outs = append(outs, &FilestoreRmOutput{Ref: arg, Error: err.Error()})
+			}
+			for _, out := range outs {
+				if err := res.Emit(out); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilestoreRmOutput) error {
+			if out.Error != "" {
+				fmt.Fprintf(w, "cannot remove %s: %s\n", out.Ref, out.Error)
+			} else {
+				fmt.Fprintf(w, "removed %s\n", out.Ref)
+			}
+			return nil
+		}),
+	},
+	Type: FilestoreRmOutput{},
+}
+
+// removeFilestoreArg removes the reference of the block with the given cid,
+// or the references of the blocks of the given file or URL. The references
+// to pinned blocks are kept unless force is set, and reported along with the
+// reason they are pinned. The GC lock must be held.
+func removeFilestoreArg(n *core.IpfsNode, fs *filestore.Filestore, arg string, force bool) ([]*FilestoreRmOutput, error) {
+	var refs []cid.Cid
+	if c, err := cid.Decode(arg); err == nil {
+		has, err := fs.FileManager().Has(c)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, fmt.Errorf("not in the filestore")
+		}
+		refs = []cid.Cid{c}
+	} else {
+		refs, err = fs.FileManager().PathRefs(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) == 0 {
+			return nil, fmt.Errorf("no references to this path in the filestore")
+		}
+	}
+
+	refs, pinned, err := filterPinnedRefs(n, refs, force)
+	if err != nil {
+		return nil, err
+	}
+
+	outs := make([]*FilestoreRmOutput, 0, len(pinned)+len(refs))
+	for _, r := range pinned {
+		outs = append(outs, &FilestoreRmOutput{Ref: r.Hash, Error: r.Error})
+	}
+	for _, c := range refs {
+		if err := fs.FileManager().DeleteBlock(c); err != nil && err != bstore.ErrNotFound {
+			return outs, err
+		}
+		outs = append(outs, &FilestoreRmOutput{Ref: c.String()})
+	}
+	return outs, nil
+}
+
+// absFilestorePath makes file paths absolute, relative to the working
+// directory of the client, as the filestore references are checked by the
+// daemon. URLs are returned as is.
+func absFilestorePath(p string) (string, error) {
+	if filestore.IsURL(p) {
+		return p, nil
+	}
+	return filepath.Abs(p)
+}
+
+// FilestoreMvOutput is the number of references rewritten by
+// 'ipfs filestore mv'.
+type FilestoreMvOutput struct {
+	Moved int
+}
+
+var mvFileStore = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Update the filestore references after files were moved.",
+		LongDescription: `
+Update the filestore references after a file or directory was moved or
+renamed, so that its blocks can be read from the new location.
+
+The references to <old-path>, or to the files under the directory
+<old-path>, are rewritten to point to the same files under <new-path>. The
+paths can also be URL prefixes, for references added with 'ipfs urlstore'.
+The files are not checked: use 'ipfs filestore verify' afterwards.
+
+Example:
+
+    > mv photos archive/photos
+    > ipfs filestore mv photos archive/photos
+    moved 1024 references
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("old-path", true, false, "Previous path of the file or directory."),
+		cmdkit.StringArg("new-path", true, false, "New path of the file or directory."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		for i, arg := range req.Arguments {
+			p, err := absFilestorePath(arg)
+			if err != nil {
+				return err
+			}
+			req.Arguments[i] = p
+		}
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, fs, err := getFilestore(env)
+		if err != nil {
+			return err
+		}
+
+		moved, err := fs.FileManager().MovePath(req.Arguments[0], req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &FilestoreMvOutput{Moved: moved})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilestoreMvOutput) error {
+			fmt.Fprintf(w, "moved %d references\n", out.Moved)
+			return nil
+		}),
+	},
+	Type: FilestoreMvOutput{},
+}
+
 var dupsFileStore = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "List blocks that are both in the filestore and standard block storage.",
@@ -219,7 +533,7 @@ func getFilestore(env cmds.Environment) (*core.IpfsNode, *filestore.Filestore, e
 	return n, fs, err
 }
 
-func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string) error {
+func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string, verify func(*filestore.Filestore, cid.Cid) *filestore.ListRes) error {
 	for _, arg := range args {
 		c, err := cid.Decode(arg)
 		if err != nil {
@@ -232,7 +546,7 @@ func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string
 			}
 			continue
 		}
-		r := filestore.Verify(fs, c)
+		r := verify(fs, c)
 		if err := res.Emit(r); err != nil {
 			return err
 		}
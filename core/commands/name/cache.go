@@ -0,0 +1,145 @@
+package name
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+// NameCacheEntry is a cached name resolution.
+type NameCacheEntry struct {
+	Name  string
+	Value string
+	EOL   time.Time
+	// Persistent is whether the IPNS record of the name is kept across
+	// restarts
+	Persistent bool
+}
+
+// NameCacheClearOutput is the number of names removed by
+// 'ipfs name cache clear'.
+type NameCacheClearOutput struct {
+	Cleared int
+}
+
+// NameCacheCmd is the subcommand that allows us to inspect and flush the
+// resolve cache.
+var NameCacheCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the cache of resolved names.",
+		ShortDescription: `
+The resolved names are cached in memory until their TTL expires. When
+Names.PersistentResolveCache is enabled, the IPNS records of the resolved
+names are also kept in the datastore, so that they are not resolved again
+after a restart.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":    nameCacheLsCmd,
+		"clear": nameCacheClearCmd,
+	},
+}
+
+func getNameCache(env cmds.Environment) (namesys.Cache, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.OnlineMode() {
+		if err := n.SetupOfflineRouting(); err != nil {
+			return nil, err
+		}
+	}
+
+	cache, ok := n.Namesys.(namesys.Cache)
+	if !ok {
+		return nil, fmt.Errorf("the name system has no cache")
+	}
+	return cache, nil
+}
+
+var nameCacheLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the cached names.",
+		ShortDescription: `
+List the cached names, along with their value and the time until which the
+value is used without resolving the name again. The persistent entries may
+have expired, but they can still be used while they are resolved again when
+Names.ResolveCacheStaleTime is set.
+
+The output is:
+
+<name> <value> <eol> [persistent]
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cache, err := getNameCache(env)
+		if err != nil {
+			return err
+		}
+
+		entries, err := cache.CacheEntries()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err := res.Emit(&NameCacheEntry{
+				Name:       e.Name,
+				Value:      e.Value.String(),
+				EOL:        e.EOL,
+				Persistent: e.Record != nil,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: NameCacheEntry{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *NameCacheEntry) error {
+			var persistent string
+			if e.Persistent {
+				persistent = " persistent"
+			}
+			_, err := fmt.Fprintf(w, "%s %s %s%s\n", e.Name, e.Value, e.EOL.Format(time.RFC3339), persistent)
+			return err
+		}),
+	},
+}
+
+var nameCacheClearCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove all the cached names.",
+		ShortDescription: `
+Remove all the cached names, from memory and from the persistent cache. They
+are resolved again the next time they are used.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cache, err := getNameCache(env)
+		if err != nil {
+			return err
+		}
+
+		cleared, err := cache.ClearCache()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &NameCacheClearOutput{Cleared: cleared})
+	},
+	Type: NameCacheClearOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *NameCacheClearOutput) error {
+			_, err := fmt.Fprintf(w, "cleared %d names\n", out.Cleared)
+			return err
+		}),
+	},
+}
@@ -0,0 +1,205 @@
+package name
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	iface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	peer "gx/ipfs/QmcqU6QUDSXprb1518vYDGczrTJTyGwLG9eUa5iNX4xUtS/go-libp2p-peer"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+const toOptionName = "to"
+
+// IpnsHistoryEntry is a value published for a name.
+type IpnsHistoryEntry struct {
+	Sequence  uint64
+	Value     string
+	Published time.Time
+}
+
+var HistoryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the values published for an IPNS name.",
+		ShortDescription: `
+List the values published by this node for a name, along with their sequence
+number and the time they were first published. The name is the name of a key,
+as listed by 'ipfs key list', or its PeerID. The default is 'self'.
+
+The output is:
+
+<sequence> <time> <value>
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("key", false, false, "Name of the key or PeerID to list the history of."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		id, err := keyID(req.Context, api, keyArg(req))
+		if err != nil {
+			return err
+		}
+
+		entries, err := namesys.PublishHistory(n.Repo.Datastore(), id)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err := res.Emit(&IpnsHistoryEntry{
+				Sequence:  e.Sequence,
+				Value:     e.Value.String(),
+				Published: e.Published,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: IpnsHistoryEntry{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *IpnsHistoryEntry) error {
+			_, err := fmt.Fprintf(w, "%d %s %s\n", e.Sequence, e.Published.Format(time.RFC3339), e.Value)
+			return err
+		}),
+	},
+}
+
+var RollbackCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Publish a previous value of an IPNS name again.",
+		ShortDescription: `
+Publish the value a name had with the given sequence number, as listed by
+'ipfs name history', again. The value is published with a new sequence number,
+so that it replaces the current one. The name is the name of a key, as listed
+by 'ipfs key list', or its PeerID. The default is 'self'.
+
+Example:
+
+  > ipfs name history
+  0 2018-10-02T10:15:00Z /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  1 2018-10-03T09:20:00Z /ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz
+  > ipfs name rollback --to=0
+  Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("key", false, false, "Name of the key or PeerID to roll back."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option(toOptionName, "Sequence number of the value to publish again."),
+		cmdkit.StringOption(lifeTimeOptionName, "t",
+			`Time duration that the record will be valid for. <<default>>
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("24h"),
+		cmdkit.BoolOption(allowOfflineOptionName, "When offline, save the IPNS record to the the local datastore without broadcasting to the network instead of simply failing."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		seq, ok := req.Options[toOptionName].(uint64)
+		if !ok {
+			return fmt.Errorf("missing the --%s option", toOptionName)
+		}
+		allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
+		validTimeOpt, _ := req.Options[lifeTimeOptionName].(string)
+		validTime, err := time.ParseDuration(validTimeOpt)
+		if err != nil {
+			return fmt.Errorf("error parsing lifetime option: %s", err)
+		}
+
+		kname := keyArg(req)
+		id, err := keyID(req.Context, api, kname)
+		if err != nil {
+			return err
+		}
+
+		e, err := namesys.GetPublishHistory(n.Repo.Datastore(), id, seq)
+		if err == ds.ErrNotFound {
+			return fmt.Errorf("no value was published for %s with the sequence number %d", id.Pretty(), seq)
+		}
+		if err != nil {
+			return err
+		}
+
+		p, err := iface.ParsePath(e.Value.String())
+		if err != nil {
+			return err
+		}
+		out, err := api.Name().Publish(req.Context, p,
+			options.Name.AllowOffline(allowOffline),
+			options.Name.Key(kname),
+			options.Name.ValidTime(validTime),
+		)
+		if err != nil {
+			if err == iface.ErrOffline {
+				err = errAllowOffline
+			}
+			return err
+		}
+
+		return cmds.EmitOnce(res, &IpnsEntry{
+			Name:  out.Name(),
+			Value: out.Value().String(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ie *IpnsEntry) error {
+			_, err := fmt.Fprintf(w, "Published to %s: %s\n", ie.Name, ie.Value)
+			return err
+		}),
+	},
+	Type: IpnsEntry{},
+}
+
+// keyArg returns the key argument of the history commands, 'self' by default.
+func keyArg(req *cmds.Request) string {
+	if len(req.Arguments) > 0 {
+		return req.Arguments[0]
+	}
+	return "self"
+}
+
+// keyID returns the PeerID of the key with the given name, or the given
+// PeerID.
+func keyID(ctx context.Context, api iface.CoreAPI, k string) (peer.ID, error) {
+	keys, err := api.Key().List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		if key.Name() == k {
+			return key.ID(), nil
+		}
+	}
+
+	id, err := peer.IDB58Decode(k)
+	if err != nil {
+		return "", fmt.Errorf("no key by the given name or PeerID was found")
+	}
+	return id, nil
+}
@@ -1,10 +1,12 @@
 package commands
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
@@ -13,6 +15,7 @@ import (
 	iface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	dagutils "github.com/ipfs/go-ipfs/dagutils"
 	pin "github.com/ipfs/go-ipfs/pin"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -30,11 +33,16 @@ var PinCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"add":    addPinCmd,
-		"rm":     rmPinCmd,
-		"ls":     listPinCmd,
-		"verify": verifyPinCmd,
-		"update": updatePinCmd,
+		"add":     addPinCmd,
+		"rm":      rmPinCmd,
+		"ls":      listPinCmd,
+		"verify":  verifyPinCmd,
+		"update":  updatePinCmd,
+		"reindex": reindexPinCmd,
+		"status":  statusPinCmd,
+		"remote":  remotePinCmd,
+		"export":  exportPinCmd,
+		"import":  importPinCmd,
 	},
 }
 
@@ -48,8 +56,13 @@ type AddPinOutput struct {
 }
 
 const (
-	pinRecursiveOptionName = "recursive"
-	pinProgressOptionName  = "progress"
+	pinRecursiveOptionName  = "recursive"
+	pinProgressOptionName   = "progress"
+	pinNameOptionName       = "name"
+	pinMetaOptionName       = "meta"
+	pinExpireInOptionName   = "expire-in"
+	pinMaxDepthOptionName   = "max-depth"
+	pinBackgroundOptionName = "background"
 )
 
 var addPinCmd = &cmds.Command{
@@ -63,7 +76,12 @@ var addPinCmd = &cmds.Command{
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
+		cmdkit.IntOption(pinMaxDepthOptionName, "Only pin recursively down to the given depth below the object(s). -1 pins the entire tree.").WithDefault(-1),
 		cmdkit.BoolOption(pinProgressOptionName, "Show progress"),
+		cmdkit.BoolOption(pinBackgroundOptionName, "Queue the pin(s) and return immediately. See 'ipfs pin status'."),
+		cmdkit.StringOption(pinNameOptionName, "An optional name for the pin(s)."),
+		cmdkit.StringOption(pinMetaOptionName, "Comma separated key=value metadata to attach to the pin(s)."),
+		cmdkit.StringOption(pinExpireInOptionName, "Remove the pin(s) automatically after the given duration (e.g. 72h). Existing pins without an expiry stay permanent."),
 	},
 	Type: AddPinOutput{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
@@ -81,14 +99,51 @@ var addPinCmd = &cmds.Command{
 
 		// set recursive flag
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
+		maxDepth, ok := req.Options[pinMaxDepthOptionName].(int)
+		if !ok {
+			maxDepth = -1
+		}
 		showProgress, _ := req.Options[pinProgressOptionName].(bool)
+		background, _ := req.Options[pinBackgroundOptionName].(bool)
+		name, _ := req.Options[pinNameOptionName].(string)
+		metaStr, _ := req.Options[pinMetaOptionName].(string)
+		expireIn, _ := req.Options[pinExpireInOptionName].(string)
+
+		meta, err := parsePinMeta(name, metaStr)
+		if err != nil {
+			return err
+		}
+
+		if expireIn != "" {
+			d, err := time.ParseDuration(expireIn)
+			if err != nil {
+				return fmt.Errorf("invalid expiry duration: %s", err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("expiry duration must be positive")
+			}
+			meta.Expires = time.Now().Add(d)
+		}
+
+		depth := 0
+		if recursive {
+			depth = maxDepth
+		}
 
 		if err := req.ParseBodyArgs(); err != nil {
 			return err
 		}
 
+		if background {
+			queued, err := corerepo.QueuePin(n, api, req.Context, req.Arguments, depth, meta)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, &AddPinOutput{Pins: cidsToStrings(queued)})
+		}
+
 		if !showProgress {
-			added, err := corerepo.Pin(n, api, req.Context, req.Arguments, recursive)
+			added, err := corerepo.Pin(n, api, req.Context, req.Arguments, depth, meta)
 			if err != nil {
 				return err
 			}
@@ -105,7 +160,7 @@ var addPinCmd = &cmds.Command{
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := corerepo.Pin(n, api, ctx, req.Arguments, recursive)
+			added, err := corerepo.Pin(n, api, ctx, req.Arguments, depth, meta)
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -138,11 +193,25 @@ var addPinCmd = &cmds.Command{
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AddPinOutput) error {
 			rec, found := req.Options["recursive"].(bool)
+			maxDepth, ok := req.Options[pinMaxDepthOptionName].(int)
+			if !ok {
+				maxDepth = -1
+			}
 			var pintype string
-			if rec || !found {
-				pintype = "recursively"
-			} else {
+			switch {
+			case found && !rec, maxDepth == 0:
 				pintype = "directly"
+			case maxDepth > 0:
+				pintype = fmt.Sprintf("recursively down to depth %d", maxDepth)
+			default:
+				pintype = "recursively"
+			}
+
+			if background, _ := req.Options[pinBackgroundOptionName].(bool); background {
+				for _, k := range out.Pins {
+					fmt.Fprintf(w, "queued %s to be pinned %s\n", k, pintype)
+				}
+				return nil
 			}
 
 			for _, k := range out.Pins {
@@ -258,8 +327,13 @@ Valid values are:
     * "recursive": pin that specific object, and indirectly pin all its
     	descendants
     * "indirect": pinned indirectly by an ancestor (like a refcount)
+    * "depth-limited": pin that specific object, and indirectly pin its
+    	descendants down to a maximum depth
     * "all"
 
+Use --name=<filter> to only list the direct and recursive pins whose name
+contains the given string. Names are attached with 'ipfs pin add --name'.
+
 With arguments, the command fails if any of the arguments is not a pinned
 object. And if --type=<type> is additionally used, the command will also fail
 if any of the arguments is not of the specified type.
@@ -285,8 +359,9 @@ Example:
 		cmdkit.StringArg("ipfs-path", false, true, "Path to object(s) to be listed."),
 	},
 	Options: []cmdkit.Option{
-		cmdkit.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").WithDefault("all"),
+		cmdkit.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", \"depth-limited\", or \"all\".").WithDefault("all"),
 		cmdkit.BoolOption(pinQuietOptionName, "q", "Write just hashes of objects."),
+		cmdkit.StringOption(pinNameOptionName, "n", "Only list pins whose name contains the given string."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -300,23 +375,24 @@ Example:
 		}
 
 		typeStr, _ := req.Options[pinTypeOptionName].(string)
+		nameFilter, _ := req.Options[pinNameOptionName].(string)
 		if err != nil {
 			return err
 		}
 
 		switch typeStr {
-		case "all", "direct", "indirect", "recursive":
+		case "all", "direct", "indirect", "recursive", "depth-limited":
 		default:
-			err = fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+			err = fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, depth-limited, all}", typeStr)
 			return err
 		}
 
 		var keys map[string]RefKeyObject
 
 		if len(req.Arguments) > 0 {
-			keys, err = pinLsKeys(req.Context, req.Arguments, typeStr, n, api)
+			keys, err = pinLsKeys(req.Context, req.Arguments, typeStr, nameFilter, n, api)
 		} else {
-			keys, err = pinLsAll(req.Context, typeStr, n)
+			keys, err = pinLsAll(req.Context, typeStr, nameFilter, n)
 		}
 
 		if err != nil {
@@ -333,9 +409,20 @@ Example:
 			for k, v := range out.Keys {
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
-				} else {
-					fmt.Fprintf(w, "%s %s\n", k, v.Type)
+					continue
+				}
+
+				line := fmt.Sprintf("%s %s", k, v.Type)
+				if v.MaxDepth > 0 {
+					line += fmt.Sprintf(" (max depth %d)", v.MaxDepth)
+				}
+				if v.Name != "" {
+					line += " " + v.Name
 				}
+				if v.Expires != nil {
+					line += " (expires " + v.Expires.Format(time.RFC3339) + ")"
+				}
+				fmt.Fprintln(w, line)
 			}
 
 			return nil
@@ -400,15 +487,26 @@ new pin and removing the old one.
 
 const (
 	pinVerboseOptionName = "verbose"
+	pinRepairOptionName  = "repair"
 )
 
 var verifyPinCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
-		Tagline: "Verify that recursive pins are complete.",
+		Tagline: "Verify that recursive and depth limited pins are complete.",
+		ShortDescription: `
+Checks that all the blocks of recursive and depth limited pins are stored
+locally.
+
+With --repair, the blocks of all pins, including direct pins, are also checked
+against their hash. Missing or corrupt blocks are removed and fetched again
+from the network when the node is online. Pins which could not be fully
+repaired are reported as broken.
+`,
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(pinVerboseOptionName, "Also write the hashes of non-broken pins."),
 		cmdkit.BoolOption(pinQuietOptionName, "q", "Write just hashes of broken pins."),
+		cmdkit.BoolOption(pinRepairOptionName, "Remove missing or corrupt blocks and fetch them again."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -427,6 +525,15 @@ var verifyPinCmd = &cmds.Command{
 			explain:   !quiet,
 			includeOk: verbose,
 		}
+
+		if repair, _ := req.Options[pinRepairOptionName].(bool); repair {
+			api, err := cmdenv.GetApi(env)
+			if err != nil {
+				return err
+			}
+			return pinRepair(req.Context, api, res, opts)
+		}
+
 		out := pinVerify(req.Context, n, opts)
 
 		return res.Emit(out)
@@ -447,15 +554,302 @@ var verifyPinCmd = &cmds.Command{
 	},
 }
 
+var reindexPinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Rebuild the index used to look up indirect pins.",
+		ShortDescription: `
+Rebuilds the persistent index mapping the descendants of recursive pins to
+those pins from scratch. The index is only maintained when the
+Pinning.RefIndex config option is set, and is only used to answer indirect
+pin lookups once it has been built with this command.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		defer n.Blockstore.PinLock().Unlock()
+
+		if err := n.Pinning.RebuildRefIndex(req.Context); err != nil {
+			if err == pin.ErrNoRefIndex {
+				return fmt.Errorf("%s, set Pinning.RefIndex to enable it", err)
+			}
+			return err
+		}
+		return nil
+	},
+}
+
+// PinQueueEntry is the state of a pin in the background pin queue, as
+// returned by "pin status"
+type PinQueueEntry struct {
+	Cid     string
+	State   string
+	Name    string `json:",omitempty"`
+	Fetched int    `json:",omitempty"`
+	Err     string `json:",omitempty"`
+}
+
+var statusPinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the state of pins added in the background.",
+		ShortDescription: `
+Lists the pins added with 'ipfs pin add --background' which are still queued,
+being fetched, or which failed. Pins are removed from the list once they are
+complete. Failed pins are retried by adding them again.
+
+The queue is processed by the daemon. Queued pins are resumed when the daemon
+restarts.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", false, true, "Only show the state of the given object(s)."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		queued, err := api.Pin().Queue(req.Context)
+		if err != nil {
+			return err
+		}
+
+		var filter map[string]bool
+		if len(req.Arguments) > 0 {
+			filter = make(map[string]bool)
+			for _, a := range req.Arguments {
+				p, err := iface.ParsePath(a)
+				if err != nil {
+					return err
+				}
+				rp, err := api.ResolvePath(req.Context, p)
+				if err != nil {
+					return err
+				}
+				filter[rp.Cid().String()] = true
+			}
+		}
+
+		for _, q := range queued {
+			c := q.Path().Cid().String()
+			if filter != nil {
+				if !filter[c] {
+					continue
+				}
+				delete(filter, c)
+			}
+
+			entry := &PinQueueEntry{
+				Cid:     c,
+				State:   q.State(),
+				Name:    q.Name(),
+				Fetched: q.Fetched(),
+			}
+			if err := q.Err(); err != nil {
+				entry.Err = err.Error()
+			}
+			if err := res.Emit(entry); err != nil {
+				return err
+			}
+		}
+
+		if len(filter) > 0 {
+			missing := make([]string, 0, len(filter))
+			for c := range filter {
+				missing = append(missing, c)
+			}
+			return fmt.Errorf("not in the pin queue: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	},
+	Type: PinQueueEntry{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinQueueEntry) error {
+			line := fmt.Sprintf("%s %s", out.Cid, out.State)
+			if out.Fetched > 0 {
+				line += fmt.Sprintf(" (%d blocks fetched)", out.Fetched)
+			}
+			if out.Name != "" {
+				line += " " + out.Name
+			}
+			if out.Err != "" {
+				line += ": " + out.Err
+			}
+			fmt.Fprintln(w, line)
+			return nil
+		}),
+	},
+}
+
+const (
+	pinFormatOptionName = "format"
+	pinFetchOptionName  = "fetch"
+	pinDryRunOptionName = "dry-run"
+)
+
+var exportPinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Export the pin set.",
+		ShortDescription: `
+Writes the direct, recursive and depth limited pins, along with their names
+and metadata, to stdout. The export can be re-created on another node with
+'ipfs pin import'. Expired pins are not exported.
+
+Example:
+	$ ipfs pin export > pins.json
+	$ ipfs pin import pins.json
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(pinFormatOptionName, "f", "Format of the export: \"json\" or \"cbor\".").WithDefault(pin.ExportJSON),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		format, _ := req.Options[pinFormatOptionName].(string)
+
+		var buf bytes.Buffer
+		if err := pin.WriteExport(&buf, pin.ExportPins(n.Pinning), format); err != nil {
+			return err
+		}
+		return res.Emit(&buf)
+	},
+}
+
+// PinImportOutput is the outcome of importing a single pin with
+// "pin import"
+type PinImportOutput struct {
+	Cid    string
+	Mode   string
+	Status string
+}
+
+var importPinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Import pins exported with 'ipfs pin export'.",
+		ShortDescription: `
+Re-creates the pins of a pin export, along with their names and metadata.
+
+By default, only the pins whose content is entirely stored locally are
+created, the others are reported as missing. Use --fetch to fetch the missing
+content from the network instead. Use --dry-run to only report which pinned
+objects are present locally, without pinning anything.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("file", true, false, "The pin export to import.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(pinFormatOptionName, "f", "Format of the export: \"json\" or \"cbor\".").WithDefault(pin.ExportJSON),
+		cmdkit.BoolOption(pinFetchOptionName, "Fetch the content of the pins which is not stored locally."),
+		cmdkit.BoolOption(pinDryRunOptionName, "Only report which pinned objects are missing locally."),
+	},
+	Type: PinImportOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		format, _ := req.Options[pinFormatOptionName].(string)
+		fetch, _ := req.Options[pinFetchOptionName].(bool)
+		dryRun, _ := req.Options[pinDryRunOptionName].(bool)
+
+		if fetch && dryRun {
+			return fmt.Errorf("the --fetch and --dry-run options can not be used at the same time")
+		}
+
+		file, err := req.Files.NextFile()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		export, err := pin.ReadExport(file, format)
+		if err != nil {
+			return fmt.Errorf("invalid pin export: %s", err)
+		}
+
+		if dryRun {
+			for _, ep := range export.Pins {
+				complete, err := corerepo.HasExportedPinContent(n, req.Context, ep)
+				if err != nil {
+					return fmt.Errorf("checking %s: %s", ep.Cid, err)
+				}
+				status := "present"
+				if !complete {
+					status = "missing"
+				}
+				if err := res.Emit(&PinImportOutput{Cid: ep.Cid, Mode: ep.Mode, Status: status}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		defer n.Blockstore.PinLock().Unlock()
+
+		for _, ep := range export.Pins {
+			status := "pinned"
+			err := corerepo.ImportPin(n, req.Context, ep, fetch)
+			if err == corerepo.ErrPinContentMissing {
+				status = "missing"
+			} else if err != nil {
+				if ferr := n.Pinning.Flush(); ferr != nil {
+					log.Error(ferr)
+				}
+				return fmt.Errorf("importing %s: %s", ep.Cid, err)
+			}
+			if err := res.Emit(&PinImportOutput{Cid: ep.Cid, Mode: ep.Mode, Status: status}); err != nil {
+				return err
+			}
+		}
+
+		return n.Pinning.Flush()
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinImportOutput) error {
+			fmt.Fprintf(w, "%s %s %s\n", out.Cid, out.Mode, out.Status)
+			return nil
+		}),
+	},
+}
+
 type RefKeyObject struct {
-	Type string
+	Type     string
+	MaxDepth int               `json:",omitempty"`
+	Name     string            `json:",omitempty"`
+	Meta     map[string]string `json:",omitempty"`
+	Expires  *time.Time        `json:",omitempty"`
 }
 
 type RefKeyList struct {
 	Keys map[string]RefKeyObject
 }
 
-func pinLsKeys(ctx context.Context, args []string, typeStr string, n *core.IpfsNode, api iface.CoreAPI) (map[string]RefKeyObject, error) {
+func newRefKeyObject(typeStr string, meta pin.PinMeta) RefKeyObject {
+	o := RefKeyObject{
+		Type: typeStr,
+		Name: meta.Name,
+		Meta: meta.Meta,
+	}
+	if !meta.Expires.IsZero() {
+		expires := meta.Expires
+		o.Expires = &expires
+	}
+	return o
+}
+
+func pinLsKeys(ctx context.Context, args []string, typeStr string, nameFilter string, n *core.IpfsNode, api iface.CoreAPI) (map[string]RefKeyObject, error) {
 
 	mode, ok := pin.StringToMode(typeStr)
 	if !ok {
@@ -485,34 +879,43 @@ func pinLsKeys(ctx context.Context, args []string, typeStr string, n *core.IpfsN
 		}
 
 		switch pinType {
-		case "direct", "indirect", "recursive", "internal":
+		case "direct", "indirect", "recursive", "internal", "depth-limited":
 		default:
 			pinType = "indirect through " + pinType
 		}
-		keys[c.Cid().String()] = RefKeyObject{
-			Type: pinType,
+		meta, _ := n.Pinning.Meta(c.Cid())
+		if nameFilter != "" && !strings.Contains(meta.Name, nameFilter) {
+			continue
 		}
+		o := newRefKeyObject(pinType, meta)
+		if pinType == "depth-limited" {
+			o.MaxDepth = n.Pinning.DepthLimitedKeys()[c.Cid()]
+		}
+		keys[c.Cid().String()] = o
 	}
 
 	return keys, nil
 }
 
-func pinLsAll(ctx context.Context, typeStr string, n *core.IpfsNode) (map[string]RefKeyObject, error) {
+func pinLsAll(ctx context.Context, typeStr string, nameFilter string, n *core.IpfsNode) (map[string]RefKeyObject, error) {
 
 	keys := make(map[string]RefKeyObject)
 
 	AddToResultKeys := func(keyList []cid.Cid, typeStr string) {
 		for _, c := range keyList {
-			keys[c.String()] = RefKeyObject{
-				Type: typeStr,
+			meta, _ := n.Pinning.Meta(c)
+			if nameFilter != "" && !strings.Contains(meta.Name, nameFilter) {
+				continue
 			}
+			keys[c.String()] = newRefKeyObject(typeStr, meta)
 		}
 	}
 
 	if typeStr == "direct" || typeStr == "all" {
 		AddToResultKeys(n.Pinning.DirectKeys(), "direct")
 	}
-	if typeStr == "indirect" || typeStr == "all" {
+	// indirect pins carry no name, so they can never match a name filter
+	if (typeStr == "indirect" || typeStr == "all") && nameFilter == "" {
 		set := cid.NewSet()
 		for _, k := range n.Pinning.RecursiveKeys() {
 			err := dag.EnumerateChildren(ctx, dag.GetLinksWithDAG(n.DAG), k, set.Visit)
@@ -520,11 +923,31 @@ func pinLsAll(ctx context.Context, typeStr string, n *core.IpfsNode) (map[string
 				return nil, err
 			}
 		}
+		for k, depth := range n.Pinning.DepthLimitedKeys() {
+			err := dagutils.EnumerateChildrenDepth(ctx, dag.GetLinksWithDAG(n.DAG), k, depth, set.Visit)
+			if err != nil {
+				return nil, err
+			}
+		}
 		AddToResultKeys(set.Keys(), "indirect")
 	}
 	if typeStr == "recursive" || typeStr == "all" {
 		AddToResultKeys(n.Pinning.RecursiveKeys(), "recursive")
 	}
+	if typeStr == "depth-limited" || typeStr == "all" {
+		depthPins := n.Pinning.DepthLimitedKeys()
+		depthKeys := make([]cid.Cid, 0, len(depthPins))
+		for c := range depthPins {
+			depthKeys = append(depthKeys, c)
+		}
+		AddToResultKeys(depthKeys, "depth-limited")
+		for _, c := range depthKeys {
+			if o, ok := keys[c.String()]; ok {
+				o.MaxDepth = depthPins[c]
+				keys[c.String()] = o
+			}
+		}
+	}
 
 	return keys, nil
 }
@@ -539,6 +962,9 @@ type PinVerifyRes struct {
 type PinStatus struct {
 	Ok       bool
 	BadNodes []BadNode `json:",omitempty"`
+
+	// Repaired lists the nodes fetched again by 'pin verify --repair'
+	Repaired []string `json:",omitempty"`
 }
 
 // BadNode is used in PinVerifyRes
@@ -559,6 +985,7 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts) <-chan
 	DAG := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
 	getLinks := dag.GetLinksWithDAG(DAG)
 	recPins := n.Pinning.RecursiveKeys()
+	depthPins := n.Pinning.DepthLimitedKeys()
 
 	var checkPin func(root cid.Cid) PinStatus
 	checkPin = func(root cid.Cid) PinStatus {
@@ -599,17 +1026,72 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts) <-chan
 		return status
 	}
 
+	// checkPinDepth only checks the nodes down to the given depth below
+	// root. A node whose whole tree was already found complete is not
+	// walked again.
+	type depthKey struct {
+		c     cid.Cid
+		depth int
+	}
+	depthVisited := make(map[depthKey]PinStatus)
+
+	var checkPinDepth func(root cid.Cid, depth int) PinStatus
+	checkPinDepth = func(root cid.Cid, depth int) PinStatus {
+		key := root.String()
+		if status, ok := visited[key]; ok && status.Ok {
+			return status
+		}
+		if status, ok := depthVisited[depthKey{root, depth}]; ok {
+			return status
+		}
+
+		status := PinStatus{Ok: true}
+		links, err := getLinks(ctx, root)
+		if err == nil {
+			err = verifcid.ValidateCid(root)
+		}
+		if err != nil {
+			status.Ok = false
+			if opts.explain {
+				status.BadNodes = []BadNode{BadNode{Cid: key, Err: err.Error()}}
+			}
+		} else if depth > 0 {
+			for _, lnk := range links {
+				res := checkPinDepth(lnk.Cid, depth-1)
+				if !res.Ok {
+					status.Ok = false
+					status.BadNodes = append(status.BadNodes, res.BadNodes...)
+				}
+			}
+		}
+
+		depthVisited[depthKey{root, depth}] = status
+		return status
+	}
+
 	out := make(chan interface{})
 	go func() {
 		defer close(out)
+		emit := func(c cid.Cid, pinStatus PinStatus) bool {
+			if pinStatus.Ok && !opts.includeOk {
+				return true
+			}
+			select {
+			case out <- &PinVerifyRes{c.String(), pinStatus}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
 		for _, cid := range recPins {
-			pinStatus := checkPin(cid)
-			if !pinStatus.Ok || opts.includeOk {
-				select {
-				case out <- &PinVerifyRes{cid.String(), pinStatus}:
-				case <-ctx.Done():
-					return
-				}
+			if !emit(cid, checkPin(cid)) {
+				return
+			}
+		}
+		for cid, depth := range depthPins {
+			if !emit(cid, checkPinDepth(cid, depth)) {
+				return
 			}
 		}
 	}()
@@ -617,16 +1099,73 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts) <-chan
 	return out
 }
 
+// pinRepair emits a PinVerifyRes for every pin repaired by PinAPI.Repair
+func pinRepair(ctx context.Context, api iface.CoreAPI, res cmds.ResponseEmitter, opts pinVerifyOpts) error {
+	statuses, err := api.Pin().Repair(ctx)
+	if err != nil {
+		return err
+	}
+
+	for status := range statuses {
+		if status.Ok() && len(status.Repaired()) == 0 && !opts.includeOk {
+			continue
+		}
+
+		out := &PinVerifyRes{
+			Cid:       status.Path().Cid().String(),
+			PinStatus: PinStatus{Ok: status.Ok()},
+		}
+		if opts.explain {
+			for _, p := range status.Repaired() {
+				out.Repaired = append(out.Repaired, p.Cid().String())
+			}
+			for _, bad := range status.BadNodes() {
+				out.BadNodes = append(out.BadNodes, BadNode{Cid: bad.Path().Cid().String(), Err: bad.Err().Error()})
+			}
+		}
+
+		if err := res.Emit(out); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
 // Format formats PinVerifyRes
 func (r PinVerifyRes) Format(out io.Writer) {
-	if r.Ok {
+	switch {
+	case r.Ok && len(r.Repaired) > 0:
+		fmt.Fprintf(out, "%s repaired\n", r.Cid)
+	case r.Ok:
 		fmt.Fprintf(out, "%s ok\n", r.Cid)
-	} else {
+	default:
 		fmt.Fprintf(out, "%s broken\n", r.Cid)
-		for _, e := range r.BadNodes {
-			fmt.Fprintf(out, "  %s: %s\n", e.Cid, e.Err)
+	}
+	for _, c := range r.Repaired {
+		fmt.Fprintf(out, "  %s: fetched again\n", c)
+	}
+	for _, e := range r.BadNodes {
+		fmt.Fprintf(out, "  %s: %s\n", e.Cid, e.Err)
+	}
+}
+
+// parsePinMeta builds the pin metadata from the --name option and a
+// "key=value,key2=value2" --meta option.
+func parsePinMeta(name, metaStr string) (pin.PinMeta, error) {
+	meta := pin.PinMeta{Name: name}
+	if metaStr == "" {
+		return meta, nil
+	}
+
+	meta.Meta = make(map[string]string)
+	for _, kv := range strings.Split(metaStr, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return pin.PinMeta{}, fmt.Errorf("invalid pin metadata %q, expected key=value", kv)
 		}
+		meta.Meta[parts[0]] = parts[1]
 	}
+	return meta, nil
 }
 
 func cidsToStrings(cs []cid.Cid) []string {
@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	iface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+var remotePinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Pin (and unpin) objects to remote pinning services.",
+		ShortDescription: `
+Remote pinning services keep objects pinned on behalf of this node. They are
+configured by name under Pinning.RemoteServices, each with the Endpoint of
+the service API and the Key used to authenticate:
+
+  $ ipfs config --json Pinning.RemoteServices.mysvc \
+      '{"Endpoint": "https://pinning.example.com", "Key": "<token>"}'
+
+The service to use is given with --service.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"add": addRemotePinCmd,
+		"ls":  listRemotePinCmd,
+		"rm":  rmRemotePinCmd,
+	},
+}
+
+// RemotePinOutput is a pin request of a remote pinning service
+type RemotePinOutput struct {
+	RequestID string
+	Cid       string
+	Name      string `json:",omitempty"`
+	Status    string
+	Created   time.Time
+}
+
+const (
+	pinServiceOptionName = "service"
+	pinStatusOptionName  = "status"
+)
+
+func newRemotePinOutput(rp iface.RemotePin) *RemotePinOutput {
+	return &RemotePinOutput{
+		RequestID: rp.RequestID(),
+		Cid:       rp.Path().Cid().String(),
+		Name:      rp.Name(),
+		Status:    rp.Status(),
+		Created:   rp.Created(),
+	}
+}
+
+var remotePinTextEncoder = cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RemotePinOutput) error {
+	line := fmt.Sprintf("%s %s", out.Cid, out.Status)
+	if out.Name != "" {
+		line += " " + out.Name
+	}
+	fmt.Fprintln(w, line)
+	return nil
+})
+
+var addRemotePinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Pin an object to a remote pinning service.",
+		ShortDescription: `
+Asks the remote pinning service to pin the given object, and waits until it
+is pinned unless --background is given. The service fetches the object from
+the network, including from this node if it is online.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, false, "Path to the object to be pinned."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmdkit.StringOption(pinNameOptionName, "An optional name for the pin."),
+		cmdkit.BoolOption(pinBackgroundOptionName, "Return as soon as the service accepted the request."),
+	},
+	Type: RemotePinOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		service, _ := req.Options[pinServiceOptionName].(string)
+		name, _ := req.Options[pinNameOptionName].(string)
+		background, _ := req.Options[pinBackgroundOptionName].(bool)
+
+		p, err := iface.ParsePath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		rp, err := api.Pin().RemoteAdd(req.Context, service, p,
+			options.Pin.Remote.Name(name),
+			options.Pin.Remote.Background(background),
+		)
+		if err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, newRemotePinOutput(rp))
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: remotePinTextEncoder,
+	},
+}
+
+var listRemotePinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List objects pinned to a remote pinning service.",
+		ShortDescription: `
+Lists the pin requests known to the remote pinning service. By default only
+the pinned objects are listed, use --status to list the requests in other
+states.
+`,
+	},
+
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+		cmdkit.StringOption(pinNameOptionName, "Only list pins with the given name."),
+		cmdkit.StringOption(pinStatusOptionName, "Comma separated states of the pins to list: queued, pinning, pinned or failed.").WithDefault("pinned"),
+	},
+	Type: RemotePinOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		service, _ := req.Options[pinServiceOptionName].(string)
+		name, _ := req.Options[pinNameOptionName].(string)
+		status, _ := req.Options[pinStatusOptionName].(string)
+
+		opts := []options.PinRemoteLsOption{options.Pin.Remote.NameFilter(name)}
+		if status != "" {
+			opts = append(opts, options.Pin.Remote.Status(strings.Split(status, ",")...))
+		}
+
+		list, err := api.Pin().RemoteLs(req.Context, service, opts...)
+		if err != nil {
+			return err
+		}
+
+		for _, rp := range list {
+			if err := res.Emit(newRemotePinOutput(rp)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: remotePinTextEncoder,
+	},
+}
+
+var rmRemotePinCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove pinned objects from a remote pinning service.",
+		ShortDescription: `
+Removes all the pin requests for the given objects from the remote pinning
+service, whatever their state.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, true, "Path to object(s) to be unpinned."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(pinServiceOptionName, "Name of the remote pinning service to use."),
+	},
+	Type: PinOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		service, _ := req.Options[pinServiceOptionName].(string)
+
+		removed := make([]string, 0, len(req.Arguments))
+		for _, a := range req.Arguments {
+			p, err := iface.ParsePath(a)
+			if err != nil {
+				return err
+			}
+
+			if err := api.Pin().RemoteRm(req.Context, service, p); err != nil {
+				return err
+			}
+			removed = append(removed, a)
+		}
+
+		return cmds.EmitOnce(res, &PinOutput{Pins: removed})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinOutput) error {
+			for _, k := range out.Pins {
+				fmt.Fprintf(w, "unpinned %s remotely\n", k)
+			}
+			return nil
+		}),
+	},
+}
@@ -13,9 +13,12 @@ import (
 	"text/tabwriter"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	config "gx/ipfs/QmXctaABKwgzmQgNM4bucMJf7zJnxxvhmPM1Pw95dxUfB5/go-ipfs-config"
@@ -47,12 +50,15 @@ var RepoCmd = &cmds.Command{
 // GcResult is the result returned by "repo gc" command.
 type GcResult struct {
 	Key   cid.Cid
+	Size  uint64 `json:",omitempty"`
 	Error string `json:",omitempty"`
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoConcurrentOptionName   = "concurrent"
+	repoDryRunOptionName       = "dry-run"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -62,11 +68,25 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+With --concurrent, objects can be added while the garbage collection runs.
+The objects added during the run are not removed.
+
+With --dry-run, the objects which would be removed are listed along with
+their size, without removing them.
+
+The objects reachable from the files API root and from the paths listed by
+'ipfs repo gc protect ls' are not removed either.
 `,
 	},
+	Subcommands: map[string]*cmds.Command{
+		"protect": repoGcProtectCmd,
+	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmdkit.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmdkit.BoolOption(repoConcurrentOptionName, "Let objects be added while the garbage collection runs."),
+		cmdkit.BoolOption(repoDryRunOptionName, "List the objects which would be removed without removing them."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -74,9 +94,29 @@ order to reclaim hard disk space.
 			return err
 		}
 
-		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
+		// protected IPNS names are resolved with the local records when
+		// offline
+		if !n.OnlineMode() {
+			if err := n.SetupOfflineRouting(); err != nil {
+				return err
+			}
+		}
 
-		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
+		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
+		concurrent, _ := req.Options[repoConcurrentOptionName].(bool)
+		dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+
+		var gcOutChan <-chan gc.Result
+		switch {
+		case dryRun && concurrent:
+			return errors.New("the --dry-run and --concurrent options can not be used at the same time")
+		case dryRun:
+			gcOutChan = corerepo.GarbageCollectDryRunAsync(n, req.Context)
+		case concurrent:
+			gcOutChan = corerepo.ConcurrentGarbageCollectAsync(n, req.Context)
+		default:
+			gcOutChan = corerepo.GarbageCollectAsync(n, req.Context)
+		}
 
 		if streamErrors {
 			errs := false
@@ -87,7 +127,7 @@ order to reclaim hard disk space.
 					}
 					errs = true
 				} else {
-					if err := re.Emit(&GcResult{Key: res.KeyRemoved}); err != nil {
+					if err := re.Emit(&GcResult{Key: res.KeyRemoved, Size: res.Size}); err != nil {
 						return err
 					}
 				}
@@ -96,8 +136,8 @@ order to reclaim hard disk space.
 				return errors.New("encountered errors during gc run")
 			}
 		} else {
-			err := corerepo.CollectResult(req.Context, gcOutChan, func(k cid.Cid) {
-				re.Emit(&GcResult{Key: k})
+			err := corerepo.CollectResult(req.Context, gcOutChan, func(res gc.Result) {
+				re.Emit(&GcResult{Key: res.KeyRemoved, Size: res.Size})
 			})
 			if err != nil {
 				return err
@@ -110,21 +150,68 @@ order to reclaim hard disk space.
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, gcr *GcResult) error {
 			quiet, _ := req.Options[repoQuietOptionName].(bool)
+			dryRun, _ := req.Options[repoDryRunOptionName].(bool)
 
 			if gcr.Error != "" {
 				_, err := fmt.Fprintf(w, "Error: %s\n", gcr.Error)
 				return err
 			}
 
-			prefix := "removed "
 			if quiet {
-				prefix = ""
+				_, err := fmt.Fprintf(w, "%s\n", gcr.Key)
+				return err
+			}
+
+			if dryRun {
+				_, err := fmt.Fprintf(w, "would remove %s (%d bytes)\n", gcr.Key, gcr.Size)
+				return err
 			}
 
-			_, err := fmt.Fprintf(w, "%s%s\n", prefix, gcr.Key)
+			_, err := fmt.Fprintf(w, "removed %s\n", gcr.Key)
 			return err
 		}),
 	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			var blocks int
+			var size uint64
+			for {
+				v, err := res.Next()
+				if err != nil {
+					if err != io.EOF {
+						return err
+					}
+					break
+				}
+
+				gcr, ok := v.(*GcResult)
+				if !ok {
+					return e.TypeErr(gcr, v)
+				}
+				if gcr.Error == "" {
+					blocks++
+					size += gcr.Size
+				}
+
+				if err := re.Emit(gcr); err != nil {
+					return err
+				}
+			}
+
+			if quiet, _ := res.Request().Options[repoQuietOptionName].(bool); quiet {
+				return nil
+			}
+
+			verb := "removed"
+			if dryRun, _ := res.Request().Options[repoDryRunOptionName].(bool); dryRun {
+				verb = "would remove"
+			}
+			// the summary goes to stderr so that the list of removed blocks
+			// can still be piped
+			fmt.Fprintf(os.Stderr, "%s %d blocks, %s in total\n", verb, blocks, humanize.Bytes(size))
+			return nil
+		},
+	},
 }
 
 const (
@@ -132,6 +219,122 @@ const (
 	repoHumanOptionName    = "human"
 )
 
+// GcProtectOutput is the output of the "repo gc protect" commands.
+type GcProtectOutput struct {
+	Paths []string
+}
+
+var repoGcProtectCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the paths protected from garbage collection.",
+		ShortDescription: `
+Protected paths are kept by 'ipfs repo gc' like the files API root is: the
+objects they reference are not removed, but they are not pinned either. They
+are neither fetched when missing nor announced to the network.
+
+/ipns paths are resolved every time a garbage collection runs. When a path
+can not be resolved then, the object it last resolved to stays protected, and
+the garbage collection fails if it never resolved.
+
+The paths are stored in the GC.ProtectedRoots config key.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": repoGcProtectAddCmd,
+		"rm":  repoGcProtectRmCmd,
+		"ls":  repoGcProtectLsCmd,
+	},
+}
+
+var repoGcProtectAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Protect paths from garbage collection.",
+		ShortDescription: "Outputs the paths which were not protected yet.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, true, "/ipfs or /ipns path to protect.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		added, err := corerepo.AddProtectedRoots(n.Repo, req.Arguments)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &GcProtectOutput{Paths: added})
+	},
+	Type: GcProtectOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *GcProtectOutput) error {
+			return writeProtectedPaths(w, "protected ", out.Paths)
+		}),
+	},
+}
+
+var repoGcProtectRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Stop protecting paths from garbage collection.",
+		ShortDescription: "Outputs the paths which were protected.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, true, "Protected path to remove.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		removed, err := corerepo.RemoveProtectedRoots(n.Repo, req.Arguments)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &GcProtectOutput{Paths: removed})
+	},
+	Type: GcProtectOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *GcProtectOutput) error {
+			return writeProtectedPaths(w, "unprotected ", out.Paths)
+		}),
+	},
+}
+
+var repoGcProtectLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the paths protected from garbage collection.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		paths, err := corerepo.ProtectedRoots(n.Repo)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &GcProtectOutput{Paths: paths})
+	},
+	Type: GcProtectOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *GcProtectOutput) error {
+			return writeProtectedPaths(w, "", out.Paths)
+		}),
+	},
+}
+
+func writeProtectedPaths(w io.Writer, prefix string, paths []string) error {
+	for _, p := range paths {
+		if _, err := fmt.Fprintf(w, "%s%s\n", prefix, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var repoStatCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Get stats for the currently used repo.",
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
@@ -30,6 +31,7 @@ for your IPFS node.`,
 		"bw":      statBwCmd,
 		"repo":    repoStatCmd,
 		"bitswap": bitswapStatCmd,
+		"provide": statProvideCmd,
 	},
 }
 
@@ -192,3 +194,69 @@ func printStats(out io.Writer, bs *metrics.Stats) {
 	fmt.Fprintf(out, "RateIn: %s/s\n", humanize.Bytes(uint64(bs.RateIn)))
 	fmt.Fprintf(out, "RateOut: %s/s\n", humanize.Bytes(uint64(bs.RateOut)))
 }
+
+var statProvideCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the state of the reprovider.",
+		ShortDescription: `
+'ipfs stats provide' shows whether the reprovider, which periodically
+announces the content stored by the node, is running, when it runs next, and
+the last runs along with the number of CIDs they announced.
+
+It also shows the queue of the roots added to the node, when the reprovider
+strategy announces them. They are announced as soon as they are added, and
+retried with an increasing delay until they are, or until a reprovide has
+announced them. The queue is stored in the repo, so the roots added while
+offline or not announced yet when the daemon stops are announced once it
+starts again.
+
+Without a running daemon, the last runs and the queue are read from the repo.
+`,
+	},
+	Type: coreiface.ReprovideStat{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		stat, err := api.Dht().ReprovideStat(req.Context)
+		if err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &stat)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *coreiface.ReprovideStat) error {
+			fmt.Fprintln(w, "reprovider status")
+			switch {
+			case s.Offline:
+				fmt.Fprintln(w, "	offline")
+			case s.Running:
+				fmt.Fprintf(w, "	running since %s, %d provided, %d failed\n", s.Current.Start.Format(time.RFC3339), s.Current.Provided, s.Current.Failed)
+			default:
+				fmt.Fprintln(w, "	idle")
+			}
+			if !s.Offline {
+				if s.Next.IsZero() {
+					fmt.Fprintln(w, "	next run: on demand")
+				} else {
+					fmt.Fprintf(w, "	next run: %s\n", s.Next.Format(time.RFC3339))
+				}
+			}
+			fmt.Fprintf(w, "	last runs [%d]\n", len(s.History))
+			for _, run := range s.History {
+				fmt.Fprintf(w, "		%s took %s, %d provided, %d failed", run.Start.Format(time.RFC3339), run.End.Sub(run.Start).Round(time.Millisecond), run.Provided, run.Failed)
+				if run.Error != "" {
+					fmt.Fprintf(w, ", error: %s", run.Error)
+				}
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, "provide queue")
+			fmt.Fprintf(w, "	%d pending, %d retrying\n", s.Queue.Pending, s.Queue.Retrying)
+			fmt.Fprintf(w, "	%d provided, %d failed attempts since start\n", s.Queue.Provided, s.Queue.Failed)
+			return nil
+		}),
+	},
+}
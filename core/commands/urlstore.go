@@ -1,10 +1,12 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 
+	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 
@@ -13,17 +15,29 @@ import (
 	balanced "gx/ipfs/QmXAFxWtAB9YAMzMy9op6m95hWYu2CC5rmTsijkYL12Kvu/go-unixfs/importer/balanced"
 	ihelper "gx/ipfs/QmXAFxWtAB9YAMzMy9op6m95hWYu2CC5rmTsijkYL12Kvu/go-unixfs/importer/helpers"
 	trickle "gx/ipfs/QmXAFxWtAB9YAMzMy9op6m95hWYu2CC5rmTsijkYL12Kvu/go-unixfs/importer/trickle"
+	uio "gx/ipfs/QmXAFxWtAB9YAMzMy9op6m95hWYu2CC5rmTsijkYL12Kvu/go-unixfs/io"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 	mh "gx/ipfs/QmerPMzPk1mJVowm8KgmoknWa4yCYvvugMPsgWmDNUvDLW/go-multihash"
 )
 
 var urlStoreCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Interact with urlstore.",
+	},
 	Subcommands: map[string]*cmds.Command{
-		"add": urlAdd,
+		"add":    urlAdd,
+		"ls":     urlLs,
+		"verify": urlVerify,
+		"rm":     urlRm,
 	},
 }
 
+// maxURLDirDepth bounds the depth of the directories added by
+// 'ipfs urlstore add --recursive'.
+const maxURLDirDepth = 32
+
 var urlAdd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Add URL via urlstore.",
@@ -36,6 +50,13 @@ control.
 The file is added using raw-leaves but otherwise using the default
 settings for 'ipfs add'.
 
+With --recursive, the URL must point to an HTML directory listing, as
+served by most web servers for directories. The files and subdirectories
+it links to are added, and the cid of the resulting directory is printed.
+
+The headers configured for the host in Urlstore.Headers are sent along with
+the requests, and the failed requests are retried.
+
 The file is not pinned, so this command should be followed by an 'ipfs
 pin add'.
 
@@ -46,6 +67,7 @@ time.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(trickleOptionName, "t", "Use trickle-dag format for dag generation."),
+		cmdkit.BoolOption(recursiveOptionName, "r", "Add the directory listing at the URL recursively."),
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("url", true, false, "URL to add to IPFS"),
@@ -71,51 +93,287 @@ time.
 		if !cfg.Experimental.UrlstoreEnabled {
 			return filestore.ErrUrlstoreNotEnabled
 		}
+		if n.Filestore == nil {
+			return filestore.ErrFilestoreNotEnabled
+		}
 
 		useTrickledag, _ := req.Options[trickleOptionName].(bool)
+		recursive, _ := req.Options[recursiveOptionName].(bool)
 
-		hreq, err := http.NewRequest("GET", url, nil)
+		var root ipld.Node
+		var size int64
+		if recursive {
+			root, size, err = addURLDir(req.Context, n, url, useTrickledag, 0)
+		} else {
+			root, size, err = addURLFile(n, url, useTrickledag)
+		}
 		if err != nil {
 			return err
 		}
 
-		hres, err := http.DefaultClient.Do(hreq)
+		return cmds.EmitOnce(res, &BlockStat{
+			Key:  root.Cid().String(),
+			Size: int(size),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bs *BlockStat) error {
+			_, err := fmt.Fprintln(w, bs.Key)
+			return err
+		}),
+	},
+}
+
+// addURLFile adds the file at the given URL, and returns its root node and
+// size.
+func addURLFile(n *core.IpfsNode, url string, useTrickledag bool) (ipld.Node, int64, error) {
+	hreq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hres, err := n.Filestore.FileManager().DoURLRequest(hreq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer hres.Body.Close()
+	if hres.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%s: expected code 200, got: %d", url, hres.StatusCode)
+	}
+
+	chk := chunk.NewSizeSplitter(hres.Body, chunk.DefaultBlockSize)
+	prefix := cid.NewPrefixV1(cid.DagProtobuf, mh.SHA2_256)
+	dbp := &ihelper.DagBuilderParams{
+		Dagserv:    n.DAG,
+		RawLeaves:  true,
+		Maxlinks:   ihelper.DefaultLinksPerBlock,
+		NoCopy:     true,
+		CidBuilder: &prefix,
+		URL:        url,
+	}
+
+	layout := balanced.Layout
+	if useTrickledag {
+		layout = trickle.Layout
+	}
+	root, err := layout(dbp.New(chk))
+	if err != nil {
+		return nil, 0, err
+	}
+	return root, hres.ContentLength, nil
+}
+
+// addURLDir adds the files and directories linked from the directory
+// listing at the given URL, and returns the root node of the directory and
+// the total size of its files.
+func addURLDir(ctx context.Context, n *core.IpfsNode, url string, useTrickledag bool, depth int) (ipld.Node, int64, error) {
+	if depth >= maxURLDirDepth {
+		return nil, 0, fmt.Errorf("%s: directories nested too deep", url)
+	}
+
+	entries, err := n.Filestore.FileManager().ListURLDirectory(url)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	prefix := cid.NewPrefixV1(cid.DagProtobuf, mh.SHA2_256)
+	dir := uio.NewDirectory(n.DAG)
+	dir.SetCidBuilder(&prefix)
+
+	var size int64
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+
+		var nd ipld.Node
+		var esize int64
+		if e.Dir {
+			nd, esize, err = addURLDir(ctx, n, e.URL, useTrickledag, depth+1)
+		} else {
+			nd, esize, err = addURLFile(n, e.URL, useTrickledag)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := dir.AddChild(ctx, e.Name, nd); err != nil {
+			return nil, 0, err
+		}
+		size += esize
+	}
+
+	nd, err := dir.GetNode()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := n.DAG.Add(ctx, nd); err != nil {
+		return nil, 0, err
+	}
+	return nd, size, nil
+}
+
+var urlLs = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List objects in urlstore.",
+		LongDescription: `
+List the filestore objects backed by URLs, added with 'ipfs urlstore add'.
+
+The output is:
+
+<hash> <size> <url> <offset>
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(fileOrderOptionName, "sort the results based on the backing URL"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, fs, err := getFilestore(env)
 		if err != nil {
 			return err
 		}
-		if hres.StatusCode != http.StatusOK {
-			return fmt.Errorf("expected code 200, got: %d", hres.StatusCode)
+
+		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
+		next, err := filestore.ListAllURLs(fs, fileOrder)
+		if err != nil {
+			return err
 		}
 
-		chk := chunk.NewSizeSplitter(hres.Body, chunk.DefaultBlockSize)
-		prefix := cid.NewPrefixV1(cid.DagProtobuf, mh.SHA2_256)
-		dbp := &ihelper.DagBuilderParams{
-			Dagserv:    n.DAG,
-			RawLeaves:  true,
-			Maxlinks:   ihelper.DefaultLinksPerBlock,
-			NoCopy:     true,
-			CidBuilder: &prefix,
-			URL:        url,
+		for {
+			r := next()
+			if r == nil {
+				break
+			}
+			if err := res.Emit(r); err != nil {
+				return err
+			}
 		}
 
-		layout := balanced.Layout
-		if useTrickledag {
-			layout = trickle.Layout
+		return nil
+	},
+	PostRun: lsFileStore.PostRun,
+	Type:    filestore.ListRes{},
+}
+
+var urlVerify = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Verify objects in urlstore.",
+		LongDescription: `
+Verify the filestore objects backed by URLs, added with 'ipfs urlstore add'.
+
+The output is:
+
+<status> <hash> <size> <url> <offset>
+
+Where <status> is one of:
+ok:       the block can be reconstructed
+changed:  the contents at the URL have changed
+no-file:  the URL returned 404 Not Found or 410 Gone
+error:    there was some other problem fetching the URL
+ERROR:    internal error, most likely due to a corrupt database
+
+For ERROR entries the error will also be printed to stderr.
+
+With --quick, the blocks are not fetched: a HEAD request is sent for each URL,
+and a block is reported as changed when the content at the URL is too short
+to hold it.
+
+With --remove-bad, the references with the no-file and changed statuses are
+removed once they are all verified.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(fileOrderOptionName, "verify the objects based on the order of the backing URL"),
+		cmdkit.BoolOption(quickOptionName, "only check the length of the content at the URLs, without fetching the blocks"),
+		cmdkit.BoolOption(removeBadOptionName, "remove the references to missing or changed URLs"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, fs, err := getFilestore(env)
+		if err != nil {
+			return err
 		}
-		root, err := layout(dbp.New(chk))
+
+		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
+		quick, _ := req.Options[quickOptionName].(bool)
+		removeBad, _ := req.Options[removeBadOptionName].(bool)
+		next, err := filestore.VerifyAllURLs(fs, fileOrder, quick)
 		if err != nil {
 			return err
 		}
 
-		return cmds.EmitOnce(res, &BlockStat{
-			Key:  root.Cid().String(),
-			Size: int(hres.ContentLength),
-		})
+		var bad []cid.Cid
+		for {
+			r := next()
+			if r == nil {
+				break
+			}
+			if err := res.Emit(r); err != nil {
+				return err
+			}
+			if removeBad && isBadRef(r) {
+				bad = append(bad, r.Key)
+			}
+		}
+
+		// removed once the datastore query is done
+		return removeRefs(fs, bad)
 	},
-	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bs *BlockStat) error {
-			_, err := fmt.Fprintln(w, bs.Key)
+	PostRun: verifyFileStore.PostRun,
+	Type:    filestore.ListRes{},
+}
+
+var urlRm = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove references from urlstore.",
+		LongDescription: `
+Remove filestore references backed by URLs.
+
+Each argument is either the cid of a block added with 'ipfs urlstore add', or
+a URL, in which case the references to all the blocks fetched from it, or
+from the URLs under it, are removed.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("obj", true, true, "Cids of blocks, or URLs, to remove the references of."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, fs, err := getFilestore(env)
+		if err != nil {
 			return err
-		}),
+		}
+
+		for _, arg := range req.Arguments {
+			removed, err := removeURLArg(fs, arg)
+			if err != nil {
+				if err := res.Emit(&FilestoreRmOutput{Ref: arg, Error: err.Error()}); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, c := range removed {
+				if err := res.Emit(&FilestoreRmOutput{Ref: c.String()}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
 	},
+	Encoders: rmFileStore.Encoders,
+	Type:     FilestoreRmOutput{},
+}
+
+// removeURLArg removes the reference of the block with the given cid, which
+// must be backed by a URL, or the references of the blocks of the given URL.
+func removeURLArg(fs *filestore.Filestore, arg string) ([]cid.Cid, error) {
+	if c, err := cid.Decode(arg); err == nil {
+		r := filestore.List(fs, c)
+		if r.Status == filestore.StatusOk && !filestore.IsURL(r.FilePath) {
+			return nil, fmt.Errorf("not backed by a URL")
+		}
+		return removeFilestoreArg(fs, arg)
+	}
+
+	if !filestore.IsURL(arg) {
+		return nil, fmt.Errorf("unsupported url syntax: %s", arg)
+	}
+	return removeFilestoreArg(fs, arg)
 }
@@ -28,6 +28,8 @@ import (
 	ipnsrp "github.com/ipfs/go-ipfs/namesys/republisher"
 	p2p "github.com/ipfs/go-ipfs/p2p"
 	pin "github.com/ipfs/go-ipfs/pin"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+	pinqueue "github.com/ipfs/go-ipfs/pin/pinqueue"
 	repo "github.com/ipfs/go-ipfs/repo"
 
 	ic "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
@@ -38,6 +40,7 @@ import (
 	ifconnmgr "gx/ipfs/QmQSucBpqUVQ5Q1stDmm2Bon4Tq4KNhNXuVmLMraARoUoh/go-libp2p-interface-connmgr"
 	dht "gx/ipfs/QmQsw6Nq2A345PqChdtbWVoYbSno7uqRDHwYmYpbPHmZNc/go-libp2p-kad-dht"
 	dhtopts "gx/ipfs/QmQsw6Nq2A345PqChdtbWVoYbSno7uqRDHwYmYpbPHmZNc/go-libp2p-kad-dht/opts"
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
 	resolver "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path/resolver"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
@@ -107,10 +110,11 @@ type IpfsNode struct {
 	Repo repo.Repo
 
 	// Local node
-	Pinning         pin.Pinner // the pinning manager
-	Mounts          Mounts     // current mount state, if any.
-	PrivateKey      ic.PrivKey // the local node's private Key
-	PNetFingerprint []byte     // fingerprint of private network
+	Pinning         pin.Pinner      // the pinning manager
+	PinQueue        *pinqueue.Queue // pins fetched in the background
+	Mounts          Mounts          // current mount state, if any.
+	PrivateKey      ic.PrivKey      // the local node's private Key
+	PNetFingerprint []byte          // fingerprint of private network
 
 	// Services
 	Peerstore       pstore.Peerstore     // storage for other Peer instances
@@ -127,12 +131,15 @@ type IpfsNode struct {
 	RecordValidator record.Validator
 
 	// Online
-	PeerHost     p2phost.Host        // the network host (server+client)
-	Bootstrapper io.Closer           // the periodic bootstrapper
-	Routing      routing.IpfsRouting // the routing system. recommend ipfs-dht
-	Exchange     exchange.Interface  // the block exchange + strategy (bitswap)
-	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
-	Reprovider   *rp.Reprovider      // the value reprovider system
+	PeerHost     p2phost.Host            // the network host (server+client)
+	Bootstrapper io.Closer               // the periodic bootstrapper
+	Routing      routing.IpfsRouting     // the routing system. recommend ipfs-dht
+	Exchange     exchange.Interface      // the block exchange + strategy (bitswap)
+	Namesys      namesys.NameSystem      // the name system, resolves paths to hashes
+	StaticNames  *namesys.StaticResolver // the local static names, if any
+	DNSResolver  *namesys.DNSResolver    // the resolver of DNS links, if configured
+	Reprovider   *rp.Reprovider          // the value reprovider system
+	ProvideQueue *rp.Queue               // the new keys waiting to be provided
 	IpnsRepub    *ipnsrp.Republisher
 
 	PubSub   *pubsub.PubSub
@@ -317,21 +324,30 @@ func (n *IpfsNode) startLateOnlineServices(ctx context.Context) error {
 		return err
 	}
 
-	var keyProvider rp.KeyChanFunc
-
-	switch cfg.Reprovider.Strategy {
-	case "all":
-		fallthrough
-	case "":
-		keyProvider = rp.NewBlockstoreProvider(n.Blockstore)
-	case "roots":
-		keyProvider = rp.NewPinnedProvider(n.Pinning, n.DAG, true)
-	case "pinned":
-		keyProvider = rp.NewPinnedProvider(n.Pinning, n.DAG, false)
-	default:
-		return fmt.Errorf("unknown reprovider strategy '%s'", cfg.Reprovider.Strategy)
+	keyProvider, err := n.reproviderKeyProvider(cfg.Reprovider.Strategy)
+	if err != nil {
+		return err
 	}
 	n.Reprovider = rp.NewReprovider(ctx, n.Routing, keyProvider)
+	if err := n.Reprovider.PersistHistory(n.Repo.Datastore()); err != nil {
+		log.Errorf("loading the reprovider history: %s", err)
+	}
+
+	// numbers are decoded from the JSON config as float64
+	if v, _ := n.Repo.GetConfigKey(reproviderConcurrencyConfigKey); v != nil {
+		workers, ok := v.(float64)
+		if !ok || workers < 1 {
+			return fmt.Errorf("invalid %s %v, expected a positive number", reproviderConcurrencyConfigKey, v)
+		}
+		n.Reprovider.Workers = int(workers)
+	}
+	if v, _ := n.Repo.GetConfigKey(reproviderRateLimitConfigKey); v != nil {
+		rate, ok := v.(float64)
+		if !ok || rate < 0 {
+			return fmt.Errorf("invalid %s %v, expected a positive number or 0", reproviderRateLimitConfigKey, v)
+		}
+		n.Reprovider.RateLimit = rate
+	}
 
 	reproviderInterval := kReprovideFrequency
 	if cfg.Reprovider.Interval != "" {
@@ -342,12 +358,69 @@ func (n *IpfsNode) startLateOnlineServices(ctx context.Context) error {
 
 		reproviderInterval = dur
 	}
+	if reproviderInterval > 0 {
+		// the keys queued for longer are announced by the reprovider,
+		// which runs shortly after the node starts
+		n.ProvideQueue.MaxAge = reproviderInterval
+	}
 
 	go n.Reprovider.Run(reproviderInterval)
+	go n.ProvideQueue.Run(ctx, n.Routing)
 
 	return nil
 }
 
+// reproviderConcurrencyConfigKey is the number of keys the reprovider
+// provides concurrently, 1 by default. The Reprovider section is replaced by
+// its struct on every SetConfig, so the keys which are not part of it live in
+// the Provider section.
+const reproviderConcurrencyConfigKey = "Provider.Concurrency"
+
+// reproviderRateLimitConfigKey is the maximum number of keys the reprovider
+// provides per second, unlimited by default.
+const reproviderRateLimitConfigKey = "Provider.RateLimit"
+
+// reproviderKeyProvider returns the key provider of the given reprovider
+// strategy. Strategies can be combined with '+', as in "pinned+mfs", in
+// which case the keys of each strategy are announced once.
+func (n *IpfsNode) reproviderKeyProvider(strategy string) (rp.KeyChanFunc, error) {
+	if strategy == "all" || strategy == "" {
+		return rp.NewBlockstoreProvider(n.Blockstore), nil
+	}
+
+	var providers []rp.KeyChanFunc
+	for _, s := range strings.Split(strategy, "+") {
+		switch s {
+		case "all":
+			return nil, fmt.Errorf("reprovider strategy 'all' can not be combined with others")
+		case "roots":
+			providers = append(providers, rp.NewPinnedProvider(n.Pinning, n.DAG, true))
+		case "pinned":
+			providers = append(providers, rp.NewPinnedProvider(n.Pinning, n.DAG, false))
+		case "mfs":
+			// the files root is loaded after the reprovider is set up
+			getRoot := func(ctx context.Context) (cid.Cid, error) {
+				if n.FilesRoot == nil {
+					return cid.Cid{}, errors.New("files root not loaded")
+				}
+				nd, err := n.FilesRoot.GetDirectory().GetNode()
+				if err != nil {
+					return cid.Cid{}, err
+				}
+				return nd.Cid(), nil
+			}
+			providers = append(providers, rp.NewMFSProvider(getRoot, n.Blockstore))
+		default:
+			return nil, fmt.Errorf("unknown reprovider strategy '%s'", s)
+		}
+	}
+
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return rp.NewCombinedProvider(providers...), nil
+}
+
 func makeAddrsFactory(cfg config.Addresses) (p2pbhost.AddrsFactory, error) {
 	var annAddrs []ma.Multiaddr
 	for _, addr := range cfg.Announce {
@@ -552,14 +625,12 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.Routing)
 	n.Exchange = bitswap.New(ctx, bitswapNetwork, n.Blockstore)
 
-	size, err := n.getCacheSize()
+	// setup name system
+	n.Namesys, err = n.newNameSystem()
 	if err != nil {
 		return err
 	}
 
-	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
-
 	// setup ipns republishing
 	return n.setupIpnsRepublisher()
 }
@@ -581,6 +652,140 @@ func (n *IpfsNode) getCacheSize() (int, error) {
 	return cs, nil
 }
 
+// persistentResolveCacheConfigKey enables the persistent resolve cache,
+// keeping the resolved IPNS records in the datastore across restarts. The
+// Ipns section is replaced by its struct on every SetConfig, so the name
+// keys which are not part of it live in the Names section.
+const persistentResolveCacheConfigKey = "Names.PersistentResolveCache"
+
+// resolveCacheStaleTimeConfigKey is how long past their TTL the names in the
+// persistent resolve cache can still be used while they are resolved again.
+const resolveCacheStaleTimeConfigKey = "Names.ResolveCacheStaleTime"
+
+// staticNamesConfigKey maps local static names to paths, as in
+// {"wiki": "/ipfs/<hash>"}.
+const staticNamesConfigKey = "Names.Static"
+
+// staticNamesFileConfigKey is the path of a file mapping paths to local
+// static names, with the syntax of /etc/hosts.
+const staticNamesFileConfigKey = "Names.StaticFile"
+
+// newNameSystem creates the name system, along with its persistent resolve
+// cache and its static names when they are configured.
+func (n *IpfsNode) newNameSystem() (namesys.NameSystem, error) {
+	size, err := n.getCacheSize()
+	if err != nil {
+		return nil, err
+	}
+
+	var options []namesys.Option
+	n.StaticNames, err = n.newStaticResolver()
+	if err != nil {
+		return nil, err
+	}
+	if n.StaticNames != nil {
+		options = append(options, namesys.WithStaticResolver(n.StaticNames))
+	}
+
+	n.DNSResolver, err = n.newDNSResolver(size)
+	if err != nil {
+		return nil, err
+	}
+	if n.DNSResolver != nil {
+		options = append(options, namesys.WithDNSResolver(n.DNSResolver))
+	}
+
+	var pcache *namesys.PersistentCache
+	if repo.ConfigBool(n.Repo, persistentResolveCacheConfigKey) {
+		pcache = namesys.NewPersistentCache(n.Repo.Datastore())
+		if v, _ := n.Repo.GetConfigKey(resolveCacheStaleTimeConfigKey); v != nil && v != "" {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s %v, expected a duration", resolveCacheStaleTimeConfigKey, v)
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("failure to parse config setting %s: %s", resolveCacheStaleTimeConfigKey, err)
+			}
+			pcache.StaleTime = d
+		}
+		options = append(options, namesys.WithPersistentCache(pcache))
+	}
+
+	return namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size, options...), nil
+}
+
+// dnsResolversConfigKey maps domain suffixes to the resolvers of their DNS
+// links, as in {"example.com": "10.0.0.1", ".": "https://1.1.1.1/dns-query"}.
+const dnsResolversConfigKey = "DNS.Resolvers"
+
+// newDNSResolver creates the resolver of the DNS links, or returns nil when
+// the host resolver is used for all the domains.
+func (n *IpfsNode) newDNSResolver(cachesize int) (*namesys.DNSResolver, error) {
+	v, _ := n.Repo.GetConfigKey(dnsResolversConfigKey)
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s, expected an object mapping domain suffixes to resolvers", dnsResolversConfigKey)
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	resolvers := make(map[string]namesys.TXTResolver, len(m))
+	for suffix, rv := range m {
+		addr, ok := rv.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s for %s, expected a resolver address", dnsResolversConfigKey, suffix)
+		}
+		r, err := namesys.ParseTXTResolver(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for %s: %s", dnsResolversConfigKey, suffix, err)
+		}
+		resolvers[suffix] = r
+	}
+	return namesys.NewDNSResolverWithClient(namesys.NewDNSClient(resolvers, cachesize)), nil
+}
+
+// newStaticResolver creates the resolver of the static names, or returns nil
+// when none are configured.
+func (n *IpfsNode) newStaticResolver() (*namesys.StaticResolver, error) {
+	var file string
+	if v, _ := n.Repo.GetConfigKey(staticNamesFileConfigKey); v != nil && v != "" {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %v, expected a file path", staticNamesFileConfigKey, v)
+		}
+		file = s
+	}
+
+	names := make(map[string]path.Path)
+	if v, _ := n.Repo.GetConfigKey(staticNamesConfigKey); v != nil {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid %s, expected an object mapping names to paths", staticNamesConfigKey)
+		}
+		for name, pv := range m {
+			s, ok := pv.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s for %s, expected a path", staticNamesConfigKey, name)
+			}
+			p, err := path.ParsePath(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s for %s: %s", staticNamesConfigKey, name, err)
+			}
+			names[name] = p
+		}
+	}
+
+	if file == "" && len(names) == 0 {
+		return nil, nil
+	}
+	return namesys.NewStaticResolver(names, file)
+}
+
 func (n *IpfsNode) setupIpnsRepublisher() error {
 	cfg, err := n.Repo.Config()
 	if err != nil {
@@ -677,6 +882,11 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.PeerHost)
 	}
 
+	// the access records are written to the repo datastore
+	if abs := n.accessBlockstore(); abs != nil {
+		closers = append(closers, abs)
+	}
+
 	// Repo closed last, most things need to preserve state here
 	closers = append(closers, n.Repo)
 
@@ -692,6 +902,17 @@ func (n *IpfsNode) teardown() error {
 	return nil
 }
 
+// accessBlockstore returns the blockstore recording the block accesses, or
+// nil when no eviction policy is configured.
+func (n *IpfsNode) accessBlockstore() *gc.AccessBlockstore {
+	var bs bstore.GCBlockstore = n.Blockstore
+	if tbs, ok := bs.(*gc.TrackingBlockstore); ok {
+		bs = tbs.GCBlockstore
+	}
+	abs, _ := bs.(*gc.AccessBlockstore)
+	return abs
+}
+
 // OnlineMode returns whether or not the IpfsNode is in OnlineMode.
 func (n *IpfsNode) OnlineMode() bool {
 	return n.mode == onlineMode
@@ -880,13 +1101,11 @@ func (n *IpfsNode) SetupOfflineRouting() error {
 
 	n.Routing = offroute.NewOfflineRouter(n.Repo.Datastore(), n.RecordValidator)
 
-	size, err := n.getCacheSize()
+	n.Namesys, err = n.newNameSystem()
 	if err != nil {
 		return err
 	}
 
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
-
 	return nil
 }
 
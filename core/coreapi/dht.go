@@ -7,6 +7,7 @@ import (
 
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	reprovide "github.com/ipfs/go-ipfs/exchange/reprovide"
 
 	pstore "gx/ipfs/QmQAGG1zxfePqj2t7bLxyN8AFccZ889DDR9Gn8kVLDrGZo/go-libp2p-peerstore"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -127,6 +128,50 @@ func provideKeysRec(ctx context.Context, r routing.IpfsRouting, bs blockstore.Bl
 	}
 }
 
+func (api *DhtAPI) ReprovideStat(ctx context.Context) (coreiface.ReprovideStat, error) {
+	var stats reprovide.Stats
+	if api.node.Reprovider != nil {
+		stats = api.node.Reprovider.Stats()
+	} else {
+		// the reprovider only runs in online mode, the history of its
+		// runs is kept in the repo
+		history, err := reprovide.LoadHistory(api.node.Repo.Datastore())
+		if err != nil {
+			return coreiface.ReprovideStat{}, err
+		}
+		stats.History = history
+	}
+	out := coreiface.ReprovideStat{
+		Offline: api.node.Reprovider == nil,
+		Running: stats.Running,
+		Current: reprovideRun(stats.Current),
+		Next:    stats.Next,
+		History: make([]coreiface.ReprovideRun, len(stats.History)),
+	}
+	for i, run := range stats.History {
+		out.History[i] = reprovideRun(run)
+	}
+
+	queue := api.node.ProvideQueue.Stats()
+	out.Queue = coreiface.ProvideQueueStat{
+		Pending:  queue.Pending,
+		Retrying: queue.Retrying,
+		Provided: queue.Provided,
+		Failed:   queue.Failed,
+	}
+	return out, nil
+}
+
+func reprovideRun(s reprovide.RunStats) coreiface.ReprovideRun {
+	return coreiface.ReprovideRun{
+		Start:    s.Start,
+		End:      s.End,
+		Provided: s.Provided,
+		Failed:   s.Failed,
+		Error:    s.Error,
+	}
+}
+
 func (api *DhtAPI) core() coreiface.CoreAPI {
 	return (*CoreAPI)(api)
 }
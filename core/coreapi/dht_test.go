@@ -107,3 +107,37 @@ func TestDhtProvide(t *testing.T) {
 		t.Errorf("got wrong provider: %s != %s", provider.ID.String(), nds[0].Identity.String())
 	}
 }
+
+func TestDhtReprovideStat(t *testing.T) {
+	ctx := context.Background()
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := apis[0].Dht().ReprovideStat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Running || len(stat.History) != 0 {
+		t.Fatalf("expected no reprovide run yet, got %#v", stat)
+	}
+
+	if _, err := apis[0].Unixfs().Add(ctx, strFile("foo")()); err != nil {
+		t.Fatal(err)
+	}
+	if err := nds[0].Reprovider.Trigger(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err = apis[0].Dht().ReprovideStat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stat.History) != 1 {
+		t.Fatalf("expected one reprovide run, got %d", len(stat.History))
+	}
+	if run := stat.History[0]; run.Provided == 0 || run.Failed != 0 || run.Error != "" {
+		t.Errorf("unexpected reprovide run: %#v", run)
+	}
+}
@@ -2,6 +2,7 @@ package iface
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 
@@ -23,4 +24,60 @@ type DhtAPI interface {
 
 	// Provide announces to the network that you are providing given values
 	Provide(context.Context, Path, ...options.DhtProvideOption) error
+
+	// ReprovideStat returns the state of the reprovider, which periodically
+	// announces the content stored by the node, the history of its runs, and
+	// the state of the queue of the new keys to announce
+	ReprovideStat(context.Context) (ReprovideStat, error)
+}
+
+// ReprovideRun describes a run of the reprovider
+type ReprovideRun struct {
+	Start time.Time
+	// End is the zero time while the run is in progress
+	End time.Time
+
+	// Provided is the number of CIDs announced
+	Provided uint64
+	// Failed is the number of CIDs which could not be announced
+	Failed uint64
+
+	// Error is the error which ended the run, if any
+	Error string `json:",omitempty"`
+}
+
+// ReprovideStat describes the state of the reprovider
+type ReprovideStat struct {
+	// Offline is true when the node is offline, in which case the
+	// reprovider does not run, and only History and Queue are set
+	Offline bool
+
+	// Running is true while a run is in progress, described by Current
+	Running bool
+	Current ReprovideRun
+
+	// Next is the time of the next scheduled run, the zero time if runs
+	// are only triggered manually
+	Next time.Time
+
+	// History holds the last finished runs, most recent first
+	History []ReprovideRun
+
+	// Queue describes the queue of the new keys waiting to be provided
+	Queue ProvideQueueStat
+}
+
+// ProvideQueueStat describes the queue of the new keys, which are provided
+// as soon as they are added, and retried until they are
+type ProvideQueueStat struct {
+	// Pending is the number of keys waiting to be provided
+	Pending int
+	// Retrying is the number of pending keys which already failed to be
+	// provided
+	Retrying int
+
+	// Provided is the number of keys provided since the node started
+	Provided uint64
+	// Failed is the number of failed attempts since the node started
+	Failed uint64
 }
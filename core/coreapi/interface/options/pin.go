@@ -1,11 +1,31 @@
 package options
 
+import (
+	"time"
+)
+
 type PinAddSettings struct {
-	Recursive bool
+	Recursive  bool
+	MaxDepth   int
+	Name       string
+	Meta       map[string]string
+	ExpireIn   time.Duration
+	Background bool
 }
 
 type PinLsSettings struct {
 	Type string
+	Name string
+}
+
+type PinRemoteAddSettings struct {
+	Name       string
+	Background bool
+}
+
+type PinRemoteLsSettings struct {
+	Name   string
+	Status []string
 }
 
 type PinUpdateSettings struct {
@@ -15,10 +35,13 @@ type PinUpdateSettings struct {
 type PinAddOption func(*PinAddSettings) error
 type PinLsOption func(settings *PinLsSettings) error
 type PinUpdateOption func(*PinUpdateSettings) error
+type PinRemoteAddOption func(*PinRemoteAddSettings) error
+type PinRemoteLsOption func(*PinRemoteLsSettings) error
 
 func PinAddOptions(opts ...PinAddOption) (*PinAddSettings, error) {
 	options := &PinAddSettings{
 		Recursive: true,
+		MaxDepth:  -1,
 	}
 
 	for _, opt := range opts {
@@ -61,10 +84,41 @@ func PinUpdateOptions(opts ...PinUpdateOption) (*PinUpdateSettings, error) {
 	return options, nil
 }
 
+func PinRemoteAddOptions(opts ...PinRemoteAddOption) (*PinRemoteAddSettings, error) {
+	options := &PinRemoteAddSettings{}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+func PinRemoteLsOptions(opts ...PinRemoteLsOption) (*PinRemoteLsSettings, error) {
+	options := &PinRemoteLsSettings{
+		Status: []string{"pinned"},
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
 type pinType struct{}
 
+type pinRemoteOpts struct{}
+
 type pinOpts struct {
-	Type pinType
+	Type   pinType
+	Remote pinRemoteOpts
 }
 
 var Pin pinOpts
@@ -93,6 +147,12 @@ func (pinType) Indirect() PinLsOption {
 	return Pin.pinType("indirect")
 }
 
+// DepthLimited is an option for Pin.Ls which will make it only return pins
+// limited to a maximum depth
+func (pinType) DepthLimited() PinLsOption {
+	return Pin.pinType("depth-limited")
+}
+
 // Recursive is an option for Pin.Add which specifies whether to pin an entire
 // object tree or just one object. Default: true
 func (pinOpts) Recursive(recursive bool) PinAddOption {
@@ -102,6 +162,63 @@ func (pinOpts) Recursive(recursive bool) PinAddOption {
 	}
 }
 
+// MaxDepth is an option for Pin.Add which limits a recursive pin to the
+// given number of levels below the pinned object. A negative depth pins the
+// entire object tree. Default: -1
+func (pinOpts) MaxDepth(depth int) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.MaxDepth = depth
+		return nil
+	}
+}
+
+// Background is an option for Pin.Add which queues the pin and returns
+// without waiting for the object tree to be fetched. Progress is reported
+// by Pin.Queue. Default: false
+func (pinOpts) Background(background bool) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.Background = background
+		return nil
+	}
+}
+
+// Name is an option for Pin.Add which attaches a human readable name to the
+// pin. Default: ""
+func (pinOpts) Name(name string) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.Name = name
+		return nil
+	}
+}
+
+// Meta is an option for Pin.Add which attaches arbitrary key/value metadata
+// to the pin. Default: none
+func (pinOpts) Meta(meta map[string]string) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.Meta = meta
+		return nil
+	}
+}
+
+// ExpireIn is an option for Pin.Add which makes the pin expire after the
+// given duration, after which it is removed automatically. Default: 0
+// (never expires)
+func (pinOpts) ExpireIn(d time.Duration) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.ExpireIn = d
+		return nil
+	}
+}
+
+// NameFilter is an option for Pin.Ls which will make it only return pins
+// whose name contains the given string. Default: "" (no filtering)
+func (pinOpts) NameFilter(name string) PinLsOption {
+	return func(settings *PinLsSettings) error {
+		settings.Name = name
+		return nil
+	}
+}
+
 // Type is an option for Pin.Ls which allows to specify which pin types should
 // be returned
 //
@@ -126,3 +243,41 @@ func (pinOpts) Unpin(unpin bool) PinUpdateOption {
 		return nil
 	}
 }
+
+// Name is an option for Pin.RemoteAdd which attaches a human readable name
+// to the remote pin. Default: ""
+func (pinRemoteOpts) Name(name string) PinRemoteAddOption {
+	return func(settings *PinRemoteAddSettings) error {
+		settings.Name = name
+		return nil
+	}
+}
+
+// Background is an option for Pin.RemoteAdd which makes it return as soon as
+// the service accepted the request, instead of waiting for the pin to
+// complete. Default: false
+func (pinRemoteOpts) Background(background bool) PinRemoteAddOption {
+	return func(settings *PinRemoteAddSettings) error {
+		settings.Background = background
+		return nil
+	}
+}
+
+// NameFilter is an option for Pin.RemoteLs which only lists the remote pins
+// with the given name. Default: ""
+func (pinRemoteOpts) NameFilter(name string) PinRemoteLsOption {
+	return func(settings *PinRemoteLsSettings) error {
+		settings.Name = name
+		return nil
+	}
+}
+
+// Status is an option for Pin.RemoteLs which only lists the remote pins in
+// one of the given states: "queued", "pinning", "pinned" or "failed".
+// Default: "pinned"
+func (pinRemoteOpts) Status(status ...string) PinRemoteLsOption {
+	return func(settings *PinRemoteLsSettings) error {
+		settings.Status = status
+		return nil
+	}
+}
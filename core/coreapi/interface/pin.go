@@ -2,6 +2,7 @@ package iface
 
 import (
 	"context"
+	"time"
 
 	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 )
@@ -13,6 +14,16 @@ type Pin interface {
 
 	// Type of the pin
 	Type() string
+
+	// Name of the pin, empty if none was given
+	Name() string
+
+	// Meta returns the user metadata attached to the pin
+	Meta() map[string]string
+
+	// Expires returns the time at which the pin expires, the zero time if
+	// it never does
+	Expires() time.Time
 }
 
 // PinStatus holds information about pin health
@@ -33,6 +44,58 @@ type BadPinNode interface {
 	Err() error
 }
 
+// PinRepairStatus holds the outcome of repairing a pin
+type PinRepairStatus interface {
+	// Path of the pinned object
+	Path() ResolvedPath
+
+	// Ok indicates whether the pin is complete after the repair
+	Ok() bool
+
+	// Repaired returns the nodes which were missing or corrupt, and which
+	// have been fetched again
+	Repaired() []ResolvedPath
+
+	// BadNodes returns the nodes which are still missing or corrupt
+	BadNodes() []BadPinNode
+}
+
+// QueuedPin is a pin added in the background which is not complete yet
+type QueuedPin interface {
+	// Path to the object being pinned
+	Path() ResolvedPath
+
+	// State is one of "queued", "pinning" or "failed"
+	State() string
+
+	// Name of the pin, empty if none was given
+	Name() string
+
+	// Fetched is the number of blocks fetched so far while pinning
+	Fetched() int
+
+	// Err is the reason why the pin failed, if it did
+	Err() error
+}
+
+// RemotePin is a pin request tracked by a remote pinning service
+type RemotePin interface {
+	// RequestID identifies the request on the service
+	RequestID() string
+
+	// Path to the object pinned by the service
+	Path() ResolvedPath
+
+	// Name of the pin, empty if none was given
+	Name() string
+
+	// Status is one of "queued", "pinning", "pinned" or "failed"
+	Status() string
+
+	// Created is the time at which the request was made
+	Created() time.Time
+}
+
 // PinAPI specifies the interface to pining
 type PinAPI interface {
 	// Add creates new pin, be default recursive - pinning the whole referenced
@@ -51,4 +114,25 @@ type PinAPI interface {
 
 	// Verify verifies the integrity of pinned objects
 	Verify(context.Context) (<-chan PinStatus, error)
+
+	// Repair verifies the integrity of pinned objects, removes the missing
+	// or corrupt nodes and fetches them again when the node is online
+	Repair(context.Context) (<-chan PinRepairStatus, error)
+
+	// Queue returns the pins added in the background which are queued,
+	// being fetched, or which failed
+	Queue(context.Context) ([]QueuedPin, error)
+
+	// RemoteAdd asks the named remote pinning service to pin the object.
+	// Unless the Background option is set, it waits for the service to
+	// complete the pin
+	RemoteAdd(ctx context.Context, service string, p Path, opts ...options.PinRemoteAddOption) (RemotePin, error)
+
+	// RemoteLs lists the pin requests known to the named remote pinning
+	// service, by default only the pinned ones
+	RemoteLs(ctx context.Context, service string, opts ...options.PinRemoteLsOption) ([]RemotePin, error)
+
+	// RemoteRm removes the pin requests for the object from the named remote
+	// pinning service
+	RemoteRm(ctx context.Context, service string, p Path) error
 }
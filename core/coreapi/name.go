@@ -116,7 +116,14 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 	}
 
 	if !options.Cache {
-		resolver = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), 0)
+		var nsopts []namesys.Option
+		if n.StaticNames != nil {
+			nsopts = append(nsopts, namesys.WithStaticResolver(n.StaticNames))
+		}
+		if n.DNSResolver != nil {
+			nsopts = append(nsopts, namesys.WithDNSResolver(n.DNSResolver))
+		}
+		resolver = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), 0, nsopts...)
 	}
 
 	if !strings.HasPrefix(name, "/ipns/") {
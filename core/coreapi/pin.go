@@ -2,16 +2,24 @@ package coreapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	dagutils "github.com/ipfs/go-ipfs/dagutils"
+	pin "github.com/ipfs/go-ipfs/pin"
+	pinqueue "github.com/ipfs/go-ipfs/pin/pinqueue"
 	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
 	merkledag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 )
 
 type PinAPI CoreAPI
@@ -29,7 +37,20 @@ func (api *PinAPI) Add(ctx context.Context, p coreiface.Path, opts ...caopts.Pin
 
 	defer api.node.Blockstore.PinLock().Unlock()
 
-	_, err = corerepo.Pin(api.node, api.core(), ctx, []string{rp.Cid().String()}, settings.Recursive)
+	meta := pin.PinMeta{Name: settings.Name, Meta: settings.Meta}
+	if settings.ExpireIn > 0 {
+		meta.Expires = time.Now().Add(settings.ExpireIn)
+	}
+	depth := 0
+	if settings.Recursive {
+		depth = settings.MaxDepth
+	}
+
+	if settings.Background {
+		return api.node.PinQueue.Add(rp.Cid(), depth, meta)
+	}
+
+	_, err = corerepo.Pin(api.node, api.core(), ctx, []string{rp.Cid().String()}, depth, meta)
 	if err != nil {
 		return err
 	}
@@ -44,12 +65,12 @@ func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) ([]coreif
 	}
 
 	switch settings.Type {
-	case "all", "direct", "indirect", "recursive":
+	case "all", "direct", "indirect", "recursive", "depth-limited":
 	default:
-		return nil, fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", settings.Type)
+		return nil, fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, depth-limited, all}", settings.Type)
 	}
 
-	return api.pinLsAll(settings.Type, ctx)
+	return api.pinLsAll(settings.Type, settings.Name, ctx)
 }
 
 func (api *PinAPI) Rm(ctx context.Context, p coreiface.Path) error {
@@ -121,6 +142,7 @@ func (api *PinAPI) Verify(ctx context.Context) (<-chan coreiface.PinStatus, erro
 	DAG := merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
 	getLinks := merkledag.GetLinksWithDAG(DAG)
 	recPins := api.node.Pinning.RecursiveKeys()
+	depthPins := api.node.Pinning.DepthLimitedKeys()
 
 	var checkPin func(root cid.Cid) *pinStatus
 	checkPin = func(root cid.Cid) *pinStatus {
@@ -149,20 +171,277 @@ func (api *PinAPI) Verify(ctx context.Context) (<-chan coreiface.PinStatus, erro
 		return status
 	}
 
+	type depthKey struct {
+		c     cid.Cid
+		depth int
+	}
+	depthVisited := make(map[depthKey]*pinStatus)
+
+	// checkPinDepth only checks the nodes down to the given depth below root
+	var checkPinDepth func(root cid.Cid, depth int) *pinStatus
+	checkPinDepth = func(root cid.Cid, depth int) *pinStatus {
+		if status, ok := visited[root]; ok && status.ok {
+			return status
+		}
+		if status, ok := depthVisited[depthKey{root, depth}]; ok {
+			return status
+		}
+
+		status := &pinStatus{ok: true, cid: root}
+		links, err := getLinks(ctx, root)
+		if err != nil {
+			status.ok = false
+			status.badNodes = []coreiface.BadPinNode{&badNode{path: coreiface.IpldPath(root), err: err}}
+		} else if depth > 0 {
+			for _, lnk := range links {
+				res := checkPinDepth(lnk.Cid, depth-1)
+				if !res.ok {
+					status.ok = false
+					status.badNodes = append(status.badNodes, res.badNodes...)
+				}
+			}
+		}
+
+		depthVisited[depthKey{root, depth}] = status
+		return status
+	}
+
 	out := make(chan coreiface.PinStatus)
 	go func() {
 		defer close(out)
 		for _, c := range recPins {
 			out <- checkPin(c)
 		}
+		for c, depth := range depthPins {
+			out <- checkPinDepth(c, depth)
+		}
 	}()
 
 	return out, nil
 }
 
+type pinRepairStatus struct {
+	path     coreiface.ResolvedPath
+	ok       bool
+	repaired []coreiface.ResolvedPath
+	badNodes []coreiface.BadPinNode
+}
+
+func (s *pinRepairStatus) Path() coreiface.ResolvedPath {
+	return s.path
+}
+
+func (s *pinRepairStatus) Ok() bool {
+	return s.ok
+}
+
+func (s *pinRepairStatus) Repaired() []coreiface.ResolvedPath {
+	return s.repaired
+}
+
+func (s *pinRepairStatus) BadNodes() []coreiface.BadPinNode {
+	return s.badNodes
+}
+
+// errCorruptBlock is the reason given for stored blocks which do not match
+// their cid.
+var errCorruptBlock = errors.New("block does not match its cid")
+
+// repairFetchTimeout bounds the time spent fetching a single missing block
+// during Repair.
+const repairFetchTimeout = time.Minute
+
+func (api *PinAPI) Repair(ctx context.Context) (<-chan coreiface.PinRepairStatus, error) {
+	bs := api.node.Blockstore
+	recPins := api.node.Pinning.RecursiveKeys()
+	depthPins := api.node.Pinning.DepthLimitedKeys()
+	directPins := api.node.Pinning.DirectKeys()
+
+	type nodeResult struct {
+		links    []*ipld.Link
+		repaired bool
+		err      error
+	}
+	nodes := make(map[cid.Cid]*nodeResult)
+
+	// repairNode makes sure the block of c is stored locally and is valid,
+	// removing it and fetching it again if it is not, and returns its links.
+	repairNode := func(c cid.Cid) *nodeResult {
+		if res, ok := nodes[c]; ok {
+			return res
+		}
+		res := &nodeResult{}
+		nodes[c] = res
+
+		nd, err := localNode(bs, c)
+		if err == nil {
+			res.links = nd.Links()
+			return res
+		}
+
+		if err != blockstore.ErrNotFound {
+			if derr := bs.DeleteBlock(c); derr != nil {
+				res.err = derr
+				return res
+			}
+		}
+
+		fctx, cancel := context.WithTimeout(ctx, repairFetchTimeout)
+		defer cancel()
+		blk, ferr := api.node.Blocks.GetBlock(fctx, c)
+		if ferr != nil {
+			res.err = ferr
+			return res
+		}
+
+		nd, err = ipld.Decode(blk)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		res.links = nd.Links()
+		res.repaired = true
+		return res
+	}
+
+	type treeKey struct {
+		c     cid.Cid
+		depth int
+	}
+	trees := make(map[treeKey]*pinRepairStatus)
+
+	// repairTree repairs the nodes down to the given depth below root, a
+	// negative depth meaning the whole tree
+	var repairTree func(root cid.Cid, depth int) *pinRepairStatus
+	repairTree = func(root cid.Cid, depth int) *pinRepairStatus {
+		if status, ok := trees[treeKey{root, depth}]; ok {
+			return status
+		}
+
+		status := &pinRepairStatus{path: coreiface.IpldPath(root), ok: true}
+		res := repairNode(root)
+		if res.repaired {
+			status.repaired = []coreiface.ResolvedPath{coreiface.IpldPath(root)}
+		}
+
+		next := depth - 1
+		if depth < 0 {
+			next = depth
+		}
+
+		if res.err != nil {
+			status.ok = false
+			status.badNodes = []coreiface.BadPinNode{&badNode{path: coreiface.IpldPath(root), err: res.err}}
+		} else if depth != 0 {
+			for _, lnk := range res.links {
+				sub := repairTree(lnk.Cid, next)
+				status.repaired = append(status.repaired, sub.repaired...)
+				if !sub.ok {
+					status.ok = false
+					status.badNodes = append(status.badNodes, sub.badNodes...)
+				}
+			}
+		}
+
+		trees[treeKey{root, depth}] = status
+		return status
+	}
+
+	out := make(chan coreiface.PinRepairStatus)
+	go func() {
+		defer close(out)
+		// the garbage collector must not run while blocks are removed and
+		// fetched again
+		defer api.node.Blockstore.PinLock().Unlock()
+
+		emit := func(status *pinRepairStatus) bool {
+			select {
+			case out <- status:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, c := range recPins {
+			if !emit(repairTree(c, -1)) {
+				return
+			}
+		}
+		for c, depth := range depthPins {
+			if !emit(repairTree(c, depth)) {
+				return
+			}
+		}
+		for _, c := range directPins {
+			if !emit(repairTree(c, 0)) {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// localNode reads and decodes the block of c from the blockstore, checking
+// that it matches c.
+func localNode(bs blockstore.Blockstore, c cid.Cid) (ipld.Node, error) {
+	blk, err := bs.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	chk, err := c.Prefix().Sum(blk.RawData())
+	if err != nil {
+		return nil, err
+	}
+	if !chk.Equals(c) {
+		return nil, errCorruptBlock
+	}
+
+	return ipld.Decode(blk)
+}
+
+type queuedPin struct {
+	req pinqueue.Request
+}
+
+func (q *queuedPin) Path() coreiface.ResolvedPath {
+	return coreiface.IpldPath(q.req.Cid)
+}
+
+func (q *queuedPin) State() string {
+	return q.req.State.String()
+}
+
+func (q *queuedPin) Name() string {
+	return q.req.Meta.Name
+}
+
+func (q *queuedPin) Fetched() int {
+	return q.req.Fetched
+}
+
+func (q *queuedPin) Err() error {
+	if q.req.Err == "" {
+		return nil
+	}
+	return errors.New(q.req.Err)
+}
+
+func (api *PinAPI) Queue(ctx context.Context) ([]coreiface.QueuedPin, error) {
+	reqs := api.node.PinQueue.Status()
+	out := make([]coreiface.QueuedPin, 0, len(reqs))
+	for _, req := range reqs {
+		out = append(out, &queuedPin{req: req})
+	}
+	return out, nil
+}
+
 type pinInfo struct {
 	pinType string
 	path    coreiface.ResolvedPath
+	meta    pin.PinMeta
 }
 
 func (p *pinInfo) Path() coreiface.ResolvedPath {
@@ -173,15 +452,32 @@ func (p *pinInfo) Type() string {
 	return p.pinType
 }
 
-func (api *PinAPI) pinLsAll(typeStr string, ctx context.Context) ([]coreiface.Pin, error) {
+func (p *pinInfo) Name() string {
+	return p.meta.Name
+}
+
+func (p *pinInfo) Meta() map[string]string {
+	return p.meta.Meta
+}
+
+func (p *pinInfo) Expires() time.Time {
+	return p.meta.Expires
+}
+
+func (api *PinAPI) pinLsAll(typeStr string, nameFilter string, ctx context.Context) ([]coreiface.Pin, error) {
 
 	keys := make(map[cid.Cid]*pinInfo)
 
 	AddToResultKeys := func(keyList []cid.Cid, typeStr string) {
 		for _, c := range keyList {
+			meta, _ := api.node.Pinning.Meta(c)
+			if nameFilter != "" && !strings.Contains(meta.Name, nameFilter) {
+				continue
+			}
 			keys[c] = &pinInfo{
 				pinType: typeStr,
 				path:    coreiface.IpldPath(c),
+				meta:    meta,
 			}
 		}
 	}
@@ -189,7 +485,8 @@ func (api *PinAPI) pinLsAll(typeStr string, ctx context.Context) ([]coreiface.Pi
 	if typeStr == "direct" || typeStr == "all" {
 		AddToResultKeys(api.node.Pinning.DirectKeys(), "direct")
 	}
-	if typeStr == "indirect" || typeStr == "all" {
+	// indirect pins carry no name, so they can never match a name filter
+	if (typeStr == "indirect" || typeStr == "all") && nameFilter == "" {
 		set := cid.NewSet()
 		for _, k := range api.node.Pinning.RecursiveKeys() {
 			err := merkledag.EnumerateChildren(ctx, merkledag.GetLinksWithDAG(api.dag), k, set.Visit)
@@ -197,11 +494,24 @@ func (api *PinAPI) pinLsAll(typeStr string, ctx context.Context) ([]coreiface.Pi
 				return nil, err
 			}
 		}
+		for k, depth := range api.node.Pinning.DepthLimitedKeys() {
+			err := dagutils.EnumerateChildrenDepth(ctx, merkledag.GetLinksWithDAG(api.dag), k, depth, set.Visit)
+			if err != nil {
+				return nil, err
+			}
+		}
 		AddToResultKeys(set.Keys(), "indirect")
 	}
 	if typeStr == "recursive" || typeStr == "all" {
 		AddToResultKeys(api.node.Pinning.RecursiveKeys(), "recursive")
 	}
+	if typeStr == "depth-limited" || typeStr == "all" {
+		var depthKeys []cid.Cid
+		for c := range api.node.Pinning.DepthLimitedKeys() {
+			depthKeys = append(depthKeys, c)
+		}
+		AddToResultKeys(depthKeys, "depth-limited")
+	}
 
 	out := make([]coreiface.Pin, 0, len(keys))
 	for _, v := range keys {
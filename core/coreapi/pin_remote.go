@@ -0,0 +1,193 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// remoteServicesConfigKey holds the remote pinning services, as a map from
+// service name to an object with the Endpoint and Key of the service.
+const remoteServicesConfigKey = "Pinning.RemoteServices"
+
+type remotePin struct {
+	st *remote.PinStatus
+	c  cid.Cid
+}
+
+func (p *remotePin) RequestID() string {
+	return p.st.RequestID
+}
+
+func (p *remotePin) Path() coreiface.ResolvedPath {
+	return coreiface.IpldPath(p.c)
+}
+
+func (p *remotePin) Name() string {
+	return p.st.Pin.Name
+}
+
+func (p *remotePin) Status() string {
+	return string(p.st.Status)
+}
+
+func (p *remotePin) Created() time.Time {
+	return p.st.Created
+}
+
+func newRemotePin(st *remote.PinStatus) (*remotePin, error) {
+	c, err := cid.Decode(st.Pin.Cid)
+	if err != nil {
+		return nil, fmt.Errorf("remote pin %s has an invalid cid: %s", st.RequestID, err)
+	}
+	return &remotePin{st: st, c: c}, nil
+}
+
+func (api *PinAPI) RemoteAdd(ctx context.Context, service string, p coreiface.Path, opts ...caopts.PinRemoteAddOption) (coreiface.RemotePin, error) {
+	settings, err := caopts.PinRemoteAddOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := api.remoteService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := client.Add(ctx, rp.Cid(), remote.AddOptions{
+		Name:    settings.Name,
+		Origins: api.origins(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !settings.Background {
+		st, err = client.Wait(ctx, st.RequestID)
+		if err != nil {
+			return nil, err
+		}
+		if st.Status == remote.Failed {
+			return nil, fmt.Errorf("remote pinning service %q failed to pin %s", service, rp.Cid())
+		}
+	}
+
+	return newRemotePin(st)
+}
+
+func (api *PinAPI) RemoteLs(ctx context.Context, service string, opts ...caopts.PinRemoteLsOption) ([]coreiface.RemotePin, error) {
+	settings, err := caopts.PinRemoteLsOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := api.remoteService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	lsOpts := remote.LsOptions{Name: settings.Name}
+	for _, s := range settings.Status {
+		st, err := remote.ParseStatus(s)
+		if err != nil {
+			return nil, err
+		}
+		lsOpts.Status = append(lsOpts.Status, st)
+	}
+
+	list, err := client.Ls(ctx, lsOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]coreiface.RemotePin, 0, len(list))
+	for i := range list {
+		rp, err := newRemotePin(&list[i])
+		if err != nil {
+			log.Warning(err)
+			continue
+		}
+		out = append(out, rp)
+	}
+	return out, nil
+}
+
+func (api *PinAPI) RemoteRm(ctx context.Context, service string, p coreiface.Path) error {
+	client, err := api.remoteService(service)
+	if err != nil {
+		return err
+	}
+
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	list, err := client.Ls(ctx, remote.LsOptions{
+		Cids:   []cid.Cid{rp.Cid()},
+		Status: []remote.Status{remote.Queued, remote.Pinning, remote.Pinned, remote.Failed},
+	})
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("%s is not pinned on remote pinning service %q", rp.Cid(), service)
+	}
+
+	for _, st := range list {
+		if err := client.Rm(ctx, st.RequestID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteService returns a client for the remote pinning service configured
+// under the given name.
+func (api *PinAPI) remoteService(name string) (*remote.Client, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no remote pinning service given")
+	}
+
+	v, err := api.node.Repo.GetConfigKey(remoteServicesConfigKey + "." + name)
+	if err != nil {
+		return nil, fmt.Errorf("remote pinning service %q is not configured in %s", name, remoteServicesConfigKey)
+	}
+
+	svc, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid configuration for remote pinning service %q", name)
+	}
+	endpoint, _ := svc["Endpoint"].(string)
+	key, _ := svc["Key"].(string)
+	if endpoint == "" {
+		return nil, fmt.Errorf("remote pinning service %q has no Endpoint", name)
+	}
+
+	return remote.NewClient(endpoint, key), nil
+}
+
+// origins returns the addresses the remote service can fetch the pinned
+// objects from, if the node is online.
+func (api *PinAPI) origins() []string {
+	if !api.node.OnlineMode() || api.node.PeerHost == nil {
+		return nil
+	}
+
+	var out []string
+	for _, a := range api.node.PeerHost.Addrs() {
+		out = append(out, fmt.Sprintf("%s/ipfs/%s", a, api.node.Identity.Pretty()))
+	}
+	return out
+}
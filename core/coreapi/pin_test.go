@@ -2,10 +2,14 @@ package coreapi_test
 
 import (
 	"context"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	opt "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	remote "github.com/ipfs/go-ipfs/pin/remote"
 )
 
 func TestPinAdd(t *testing.T) {
@@ -209,3 +213,334 @@ func TestPinRecursive(t *testing.T) {
 		t.Errorf("unexpected verify result count: %d", n)
 	}
 }
+
+func TestPinName(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p1, err := api.Unixfs().Add(ctx, strFile("foo")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := api.Unixfs().Add(ctx, strFile("bar")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = api.Pin().Add(ctx, p1, opt.Pin.Name("project-foo"), opt.Pin.Meta(map[string]string{"owner": "ci"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = api.Pin().Add(ctx, p2, opt.Pin.Name("project-bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := api.Pin().Ls(ctx, opt.Pin.NameFilter("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("unexpected pin list len: %d", len(list))
+	}
+
+	if list[0].Path().Cid().String() != p1.Cid().String() {
+		t.Error("unexpected pin")
+	}
+
+	if list[0].Name() != "project-foo" {
+		t.Errorf("unexpected pin name: %s", list[0].Name())
+	}
+
+	if list[0].Meta()["owner"] != "ci" {
+		t.Errorf("unexpected pin meta: %v", list[0].Meta())
+	}
+}
+
+func TestPinExpiry(t *testing.T) {
+	ctx := context.Background()
+	nd, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	temp, err := api.Unixfs().Add(ctx, strFile("temporary")())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := api.Unixfs().Add(ctx, strFile("permanent")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := api.Pin().Add(ctx, temp, opt.Pin.ExpireIn(time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Pin().Add(ctx, kept); err != nil {
+		t.Fatal(err)
+	}
+	// pinning a permanent pin again with an expiry keeps it permanent
+	if err := api.Pin().Add(ctx, kept, opt.Pin.ExpireIn(time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// the expired pin does not protect its blocks, even before it is reaped
+	if err := corerepo.GarbageCollect(nd, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := nd.Blockstore.Has(temp.Cid()); has {
+		t.Error("expected the block of the expired pin to be collected")
+	}
+	if has, _ := nd.Blockstore.Has(kept.Cid()); !has {
+		t.Error("expected the block of the permanent pin to be kept")
+	}
+
+	reaped, err := corerepo.ReapExpiredPins(nd, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reaped) != 1 || !reaped[0].Equals(temp.Cid()) {
+		t.Fatalf("expected only %s to be reaped, got %v", temp.Cid(), reaped)
+	}
+
+	list, err := api.Pin().Ls(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Path().Cid().String() != kept.Cid().String() {
+		t.Fatalf("expected only the permanent pin to remain, got %v", list)
+	}
+	if !list[0].Expires().IsZero() {
+		t.Errorf("expected the permanent pin not to expire, got %s", list[0].Expires())
+	}
+}
+
+func TestPinBackground(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := api.Unixfs().Add(ctx, strFile("foo")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = api.Pin().Add(ctx, p, opt.Pin.Background(true), opt.Pin.Name("later"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue is only processed by the daemon
+	queued, err := api.Pin().Queue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queued) != 1 {
+		t.Fatalf("unexpected queue len: %d", len(queued))
+	}
+
+	if queued[0].Path().Cid().String() != p.Cid().String() {
+		t.Error("unexpected queued pin")
+	}
+
+	if queued[0].State() != "queued" {
+		t.Errorf("unexpected state: %s", queued[0].State())
+	}
+
+	if queued[0].Name() != "later" {
+		t.Errorf("unexpected pin name: %s", queued[0].Name())
+	}
+}
+
+func TestPinRemote(t *testing.T) {
+	ctx := context.Background()
+	nd, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(remote.NewMockService("secret"))
+	defer srv.Close()
+
+	err = nd.Repo.SetConfigKey("Pinning.RemoteServices", map[string]interface{}{
+		"test": map[string]interface{}{
+			"Endpoint": srv.URL,
+			"Key":      "secret",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := api.Unixfs().Add(ctx, strFile("foo")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.Pin().RemoteAdd(ctx, "missing", p); err == nil {
+		t.Fatal("expected an unknown service to fail")
+	}
+
+	rp, err := api.Pin().RemoteAdd(ctx, "test", p, opt.Pin.Remote.Name("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rp.Status() != "pinned" {
+		t.Errorf("unexpected remote pin status: %s", rp.Status())
+	}
+
+	if rp.Path().Cid().String() != p.Cid().String() {
+		t.Error("unexpected remote pin")
+	}
+
+	list, err := api.Pin().RemoteLs(ctx, "test", opt.Pin.Remote.NameFilter("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].RequestID() != rp.RequestID() {
+		t.Fatalf("unexpected remote pin list: %v", list)
+	}
+
+	err = api.Pin().RemoteRm(ctx, "test", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err = api.Pin().RemoteLs(ctx, "test", opt.Pin.Remote.Status("queued", "pinning", "pinned", "failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 0 {
+		t.Errorf("unexpected remote pin list len: %d", len(list))
+	}
+}
+
+func TestPinRepair(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first node holds a copy of the content repaired by the second
+	if _, err := apis[0].Unixfs().Add(ctx, strFile("foo")()); err != nil {
+		t.Fatal(err)
+	}
+
+	p0, err := apis[1].Unixfs().Add(ctx, strFile("foo")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p1, err := apis[1].Dag().Put(ctx, strings.NewReader(`{"lnk": {"/": "`+p0.Cid().String()+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := apis[1].Pin().Add(ctx, p1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nds[1].Blockstore.DeleteBlock(p0.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := apis[1].Pin().Repair(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for r := range res {
+		n++
+		if r.Path().Cid().String() != p1.Cid().String() {
+			t.Fatalf("unexpected pin: %s", r.Path())
+		}
+
+		if !r.Ok() {
+			t.Errorf("expected the pin to be repaired: %v", r.BadNodes())
+		}
+
+		if len(r.Repaired()) != 1 || r.Repaired()[0].Cid().String() != p0.Cid().String() {
+			t.Errorf("unexpected repaired nodes: %v", r.Repaired())
+		}
+	}
+
+	if n != 1 {
+		t.Errorf("unexpected repair result count: %d", n)
+	}
+
+	has, err := nds[1].Blockstore.Has(p0.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Error("expected the repaired block to be stored")
+	}
+}
+
+func TestPinRepairOffline(t *testing.T) {
+	ctx := context.Background()
+	nd, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p0, err := api.Unixfs().Add(ctx, strFile("foo")())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p1, err := api.Dag().Put(ctx, strings.NewReader(`{"lnk": {"/": "`+p0.Cid().String()+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := api.Pin().Add(ctx, p1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nd.Blockstore.DeleteBlock(p0.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := api.Pin().Repair(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for r := range res {
+		n++
+		if r.Ok() {
+			t.Error("expected the pin to stay broken when offline")
+		}
+
+		if len(r.Repaired()) != 0 {
+			t.Errorf("unexpected repaired nodes: %v", r.Repaired())
+		}
+
+		if len(r.BadNodes()) != 1 || r.BadNodes()[0].Path().Cid().String() != p0.Cid().String() {
+			t.Errorf("unexpected bad nodes: %v", r.BadNodes())
+		}
+	}
+
+	if n != 1 {
+		t.Errorf("unexpected repair result count: %d", n)
+	}
+}
@@ -3,6 +3,7 @@ package coreapi
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/filestore"
@@ -130,9 +131,31 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.File, opts ...options
 	if err != nil {
 		return nil, err
 	}
+
+	if !settings.Local && !settings.OnlyHash && announcesRoot(cfg.Reprovider.Strategy, fileAdder.Pin) {
+		if err := n.ProvideQueue.Enqueue(nd.Cid()); err != nil {
+			log.Errorf("cannot queue %s to be provided: %s", nd.Cid(), err)
+		}
+	}
 	return coreiface.IpfsPath(nd.Cid()), nil
 }
 
+// announcesRoot returns whether the given reprovider strategy announces the
+// root of an addition, pinned or not.
+func announcesRoot(strategy string, pinned bool) bool {
+	for _, s := range strings.Split(strategy, "+") {
+		switch s {
+		case "", "all":
+			return true
+		case "roots", "pinned":
+			if pinned {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (api *UnixfsAPI) Get(ctx context.Context, p coreiface.Path) (coreiface.UnixfsFile, error) {
 	ses := api.core().getSession(ctx)
 
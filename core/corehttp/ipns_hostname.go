@@ -24,7 +24,7 @@ func IPNSHostnameOption() ServeOption {
 			defer cancel()
 
 			host := strings.SplitN(r.Host, ":", 2)[0]
-			if len(host) > 0 && isd.IsDomain(host) {
+			if len(host) > 0 && (isd.IsDomain(host) || hasStaticName(n, host)) {
 				name := "/ipns/" + host
 				_, err := n.Namesys.Resolve(ctx, name, nsopts.Depth(1))
 				if err == nil || err == namesys.ErrResolveRecursion {
@@ -37,3 +37,9 @@ func IPNSHostnameOption() ServeOption {
 		return childMux, nil
 	}
 }
+
+// hasStaticName reports whether host is one of the node's local static names.
+func hasStaticName(n *core.IpfsNode, host string) bool {
+	sn, ok := n.Namesys.(namesys.StaticNames)
+	return ok && sn.HasStaticName(host)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
@@ -12,6 +13,7 @@ import (
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	mfs "gx/ipfs/QmZw3dco7GvZkuZ9pEHTHJ2DNXFxTtquraF3d2JYa5vP6q/go-mfs"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 )
@@ -20,6 +22,42 @@ var log = logging.Logger("corerepo")
 
 var ErrMaxStorageExceeded = errors.New("maximum storage limit exceeded. Try to unpin some files")
 
+// concurrentGCConfigKey is the config key enabling concurrent garbage
+// collections in PeriodicGC and ConditionalGC. The garbage collection keys
+// are not part of the config struct, so they live in their own GC section,
+// which SetConfig leaves untouched.
+const concurrentGCConfigKey = "GC.Concurrent"
+
+// storageGCTargetConfigKey is the percentage of StorageMax eviction brings
+// the storage usage down to. It defaults to 10 points below the watermark.
+const storageGCTargetConfigKey = "GC.StorageTarget"
+
+// gcMarkingConfigKey selects where garbage collections keep the set of
+// blocks to keep, "memory" (the default) or "disk".
+const gcMarkingConfigKey = "GC.Marking"
+
+// gcOptions returns the garbage collection options set in the config.
+func gcOptions(n *core.IpfsNode) ([]gc.Option, error) {
+	v, _ := n.Repo.GetConfigKey(gcMarkingConfigKey)
+	marking, _ := v.(string)
+	switch marking {
+	case "", "memory":
+		return nil, nil
+	case "disk":
+		return []gc.Option{gc.DiskMarking(n.Repo.Datastore())}, nil
+	default:
+		return nil, fmt.Errorf("invalid %s %q, expected \"memory\" or \"disk\"", gcMarkingConfigKey, marking)
+	}
+}
+
+// gcError returns a garbage collection output holding the given error.
+func gcError(err error) <-chan gc.Result {
+	out := make(chan gc.Result, 1)
+	out <- gc.Result{Error: err}
+	close(out)
+	return out
+}
+
 type GC struct {
 	Node       *core.IpfsNode
 	Repo       repo.Repo
@@ -27,6 +65,16 @@ type GC struct {
 	StorageGC  uint64
 	SlackGB    uint64
 	Storage    uint64
+
+	// Concurrent makes the garbage collection let blocks be added while
+	// it runs, see ConcurrentGarbageCollectAsync
+	Concurrent bool
+
+	// Eviction is the eviction policy, if any. When set, only the least
+	// used unpinned blocks are removed until the storage usage drops below
+	// StorageTarget. It takes precedence over Concurrent.
+	Eviction      string
+	StorageTarget uint64
 }
 
 func NewGC(n *core.IpfsNode) (*GC, error) {
@@ -61,12 +109,39 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 		slackGB = 1
 	}
 
+	// missing on most configs, which leaves concurrent collections disabled
+	concurrent := repo.ConfigBool(r, concurrentGCConfigKey)
+
+	v, _ := r.GetConfigKey(core.GCEvictionConfigKey)
+	eviction, _ := v.(string)
+	switch eviction {
+	case "", gc.EvictLRU, gc.EvictLFU:
+	default:
+		return nil, fmt.Errorf("invalid %s %q, expected %q or %q", core.GCEvictionConfigKey, eviction, gc.EvictLRU, gc.EvictLFU)
+	}
+
+	targetPercent := int64(cfg.Datastore.StorageGCWatermark) - 10
+	if v, _ := r.GetConfigKey(storageGCTargetConfigKey); v != nil {
+		// numbers are decoded from the JSON config as float64
+		p, ok := v.(float64)
+		if !ok || p < 0 || int64(p) > cfg.Datastore.StorageGCWatermark {
+			return nil, fmt.Errorf("invalid %s %v, expected a percentage below the watermark", storageGCTargetConfigKey, v)
+		}
+		targetPercent = int64(p)
+	}
+	if targetPercent < 0 {
+		targetPercent = 0
+	}
+
 	return &GC{
-		Node:       n,
-		Repo:       r,
-		StorageMax: storageMax,
-		StorageGC:  storageGC,
-		SlackGB:    slackGB,
+		Node:          n,
+		Repo:          r,
+		StorageMax:    storageMax,
+		StorageGC:     storageGC,
+		SlackGB:       slackGB,
+		Concurrent:    concurrent,
+		Eviction:      eviction,
+		StorageTarget: storageMax * uint64(targetPercent) / 100,
 	}, nil
 }
 
@@ -82,11 +157,15 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // in case error occurs during operation
-	roots, err := BestEffortRoots(n.FilesRoot)
+	roots, err := gcRoots(ctx, n)
+	if err != nil {
+		return err
+	}
+	opts, err := gcOptions(n)
 	if err != nil {
 		return err
 	}
-	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, opts...)
 
 	return CollectResult(ctx, rmed, nil)
 }
@@ -94,7 +173,7 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 // CollectResult collects the output of a garbage collection run and calls the
 // given callback for each object removed.  It also collects all errors into a
 // MultiError which is returned after the gc is completed.
-func CollectResult(ctx context.Context, gcOut <-chan gc.Result, cb func(cid.Cid)) error {
+func CollectResult(ctx context.Context, gcOut <-chan gc.Result, cb func(gc.Result)) error {
 	var errors []error
 loop:
 	for {
@@ -106,7 +185,7 @@ loop:
 			if res.Error != nil {
 				errors = append(errors, res.Error)
 			} else if res.KeyRemoved.Defined() && cb != nil {
-				cb(res.KeyRemoved)
+				cb(res)
 			}
 		case <-ctx.Done():
 			errors = append(errors, ctx.Err())
@@ -146,15 +225,86 @@ func (e *MultiError) Error() string {
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
-	roots, err := BestEffortRoots(n.FilesRoot)
+	roots, err := gcRoots(ctx, n)
 	if err != nil {
-		out := make(chan gc.Result)
-		out <- gc.Result{Error: err}
-		close(out)
-		return out
+		return gcError(err)
+	}
+	opts, err := gcOptions(n)
+	if err != nil {
+		return gcError(err)
 	}
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, opts...)
+}
+
+// GarbageCollectDryRunAsync returns the blocks a garbage collection would
+// remove, along with their size, without removing them.
+func GarbageCollectDryRunAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+	roots, err := gcRoots(ctx, n)
+	if err != nil {
+		return gcError(err)
+	}
+	opts, err := gcOptions(n)
+	if err != nil {
+		return gcError(err)
+	}
+
+	return gc.DryRun(ctx, n.Blockstore, n.Pinning, roots, opts...)
+}
+
+// ConcurrentGarbageCollectAsync runs a garbage collection which only holds
+// the GC lock for short periods of time, so that blocks can be added while it
+// runs. The blocks added during the run are not removed.
+func ConcurrentGarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+	bs, ok := n.Blockstore.(*gc.TrackingBlockstore)
+	if !ok {
+		return gcError(errors.New("the blockstore does not support concurrent garbage collection"))
+	}
+	opts, err := gcOptions(n)
+	if err != nil {
+		return gcError(err)
+	}
+
+	// the protected roots are only resolved once, the files API root is
+	// taken again every time the roots are
+	protected, err := resolveProtectedRoots(ctx, n)
+	if err != nil {
+		return gcError(err)
+	}
+	roots := func() ([]cid.Cid, error) {
+		roots, err := BestEffortRoots(n.FilesRoot)
+		if err != nil {
+			return nil, err
+		}
+		return append(roots, protected...), nil
+	}
+	return gc.ConcurrentGC(ctx, bs, n.Repo.Datastore(), n.Pinning, roots, opts...)
+}
+
+// EvictAsync removes the unpinned blocks in the order given by the eviction
+// policy until at least toFree bytes were freed. The node must have been
+// built with an eviction policy configured, so that block accesses are
+// recorded.
+func EvictAsync(n *core.IpfsNode, ctx context.Context, policy string, toFree uint64) <-chan gc.Result {
+	var bs bstore.GCBlockstore = n.Blockstore
+	if tbs, ok := bs.(*gc.TrackingBlockstore); ok {
+		bs = tbs.GCBlockstore
+	}
+	abs, ok := bs.(*gc.AccessBlockstore)
+	if !ok {
+		return gcError(errors.New("block accesses are not recorded, restart the node after setting " + core.GCEvictionConfigKey))
+	}
+
+	roots, err := gcRoots(ctx, n)
+	if err != nil {
+		return gcError(err)
+	}
+	opts, err := gcOptions(n)
+	if err != nil {
+		return gcError(err)
+	}
+
+	return gc.Evict(ctx, abs, n.Pinning, roots, policy, toFree, opts...)
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -217,7 +367,17 @@ func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 		log.Info("Watermark exceeded. Starting repo GC...")
 		defer log.EventBegin(ctx, "repoGC").Done()
 
-		if err := GarbageCollect(gc.Node, ctx); err != nil {
+		switch {
+		case gc.Eviction != "":
+			// StorageTarget is below the watermark
+			toFree := storage + offset - gc.StorageTarget
+			err = CollectResult(ctx, EvictAsync(gc.Node, ctx, gc.Eviction, toFree), nil)
+		case gc.Concurrent:
+			err = CollectResult(ctx, ConcurrentGarbageCollectAsync(gc.Node, ctx), nil)
+		default:
+			err = GarbageCollect(gc.Node, ctx)
+		}
+		if err != nil {
 			return err
 		}
 		log.Infof("Repo GC done. See `ipfs repo stat` to see how much space got freed.\n")
@@ -15,15 +15,25 @@ package corerepo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coreapi/interface"
+	"github.com/ipfs/go-ipfs/dagutils"
+	"github.com/ipfs/go-ipfs/pin"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
 )
 
-func Pin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []string, recursive bool) ([]cid.Cid, error) {
+// Pin pins the given paths down to depth levels below them. A depth of 0
+// pins the paths directly, a negative depth pins them recursively.
+func Pin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []string, depth int, meta pin.PinMeta) ([]cid.Cid, error) {
 	out := make([]cid.Cid, len(paths))
 
 	for i, fpath := range paths {
@@ -36,8 +46,7 @@ func Pin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []strin
 		if err != nil {
 			return nil, fmt.Errorf("pin: %s", err)
 		}
-		err = n.Pinning.Pin(ctx, dagnode, recursive)
-		if err != nil {
+		if err := pin.PinWithMeta(ctx, n.Pinning, dagnode, depth, meta); err != nil {
 			return nil, fmt.Errorf("pin: %s", err)
 		}
 		out[i] = dagnode.Cid()
@@ -51,6 +60,32 @@ func Pin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []strin
 	return out, nil
 }
 
+// QueuePin adds the given paths to the background pin queue of the node and
+// returns without waiting for them to be fetched. depth is interpreted as by
+// Pin.
+func QueuePin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []string, depth int, meta pin.PinMeta) ([]cid.Cid, error) {
+	out := make([]cid.Cid, len(paths))
+
+	for i, fpath := range paths {
+		p, err := iface.ParsePath(fpath)
+		if err != nil {
+			return nil, err
+		}
+
+		rp, err := api.ResolvePath(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("pin: %s", err)
+		}
+
+		if err := n.PinQueue.Add(rp.Cid(), depth, meta); err != nil {
+			return nil, fmt.Errorf("pin: %s", err)
+		}
+		out[i] = rp.Cid()
+	}
+
+	return out, nil
+}
+
 func Unpin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []string, recursive bool) ([]cid.Cid, error) {
 	unpinned := make([]cid.Cid, len(paths))
 
@@ -78,3 +113,165 @@ func Unpin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []str
 	}
 	return unpinned, nil
 }
+
+// ErrPinContentMissing is returned by ImportPin when the content of a pin is
+// not stored locally and fetching it was not requested.
+var ErrPinContentMissing = errors.New("content not available locally")
+
+// ImportPin re-creates a pin read from a pin export, along with its name and
+// metadata. Unless fetch is set, the blocks to pin must all be stored locally,
+// otherwise ErrPinContentMissing is returned and nothing is pinned. The pin
+// state is not flushed.
+func ImportPin(n *core.IpfsNode, ctx context.Context, ep pin.ExportedPin, fetch bool) error {
+	c, err := ep.Key()
+	if err != nil {
+		return err
+	}
+
+	meta, err := ep.PinMeta()
+	if err != nil {
+		return err
+	}
+
+	mode, ok := pin.StringToMode(ep.Mode)
+	if !ok {
+		return fmt.Errorf("invalid pin mode %q", ep.Mode)
+	}
+
+	if !fetch {
+		complete, err := HasExportedPinContent(n, ctx, ep)
+		if err != nil {
+			return err
+		}
+		if !complete {
+			return ErrPinContentMissing
+		}
+	}
+
+	nd, err := n.DAG.Get(ctx, c)
+	if err != nil {
+		return fmt.Errorf("pin: %s", err)
+	}
+
+	var depth int
+	switch mode {
+	case pin.Recursive:
+		depth = -1
+	case pin.Direct:
+		depth = 0
+	case pin.DepthLimited:
+		if ep.MaxDepth <= 0 {
+			return fmt.Errorf("invalid max depth %d of depth-limited pin", ep.MaxDepth)
+		}
+		depth = ep.MaxDepth
+	default:
+		return fmt.Errorf("invalid pin mode %q", ep.Mode)
+	}
+
+	if err := pin.PinWithMeta(ctx, n.Pinning, nd, depth, meta); err != nil {
+		return fmt.Errorf("pin: %s", err)
+	}
+	return nil
+}
+
+// HasExportedPinContent returns whether all the blocks the given exported pin
+// would pin are stored locally.
+func HasExportedPinContent(n *core.IpfsNode, ctx context.Context, ep pin.ExportedPin) (bool, error) {
+	c, err := ep.Key()
+	if err != nil {
+		return false, err
+	}
+
+	mode, ok := pin.StringToMode(ep.Mode)
+	if !ok {
+		return false, fmt.Errorf("invalid pin mode %q", ep.Mode)
+	}
+
+	return hasPinContent(ctx, n, c, mode, ep.MaxDepth)
+}
+
+// hasPinContent returns whether all the blocks pinned by a pin of the given
+// mode on c are stored locally.
+func hasPinContent(ctx context.Context, n *core.IpfsNode, c cid.Cid, mode pin.Mode, maxDepth int) (bool, error) {
+	has, err := n.Blockstore.Has(c)
+	if err != nil || !has {
+		return false, err
+	}
+
+	bs := bserv.New(n.Blockstore, offline.Exchange(n.Blockstore))
+	getLinks := dag.GetLinksWithDAG(dag.NewDAGService(bs))
+	set := cid.NewSet()
+
+	switch mode {
+	case pin.Recursive:
+		err = dag.EnumerateChildren(ctx, getLinks, c, set.Visit)
+	case pin.DepthLimited:
+		err = dagutils.EnumerateChildrenDepth(ctx, getLinks, c, maxDepth, set.Visit)
+	default:
+		return true, nil
+	}
+	if err == ipld.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if mode == pin.DepthLimited {
+		// the nodes at the maximum depth are visited but not fetched
+		for _, k := range set.Keys() {
+			has, err := n.Blockstore.Has(k)
+			if err != nil || !has {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// pinReapInterval is how often PeriodicPinReaper looks for expired pins.
+const pinReapInterval = time.Minute
+
+// ReapExpiredPins removes the pins whose expiry time has passed and flushes
+// the pin state. It returns the cids which were unpinned.
+func ReapExpiredPins(n *core.IpfsNode, ctx context.Context) ([]cid.Cid, error) {
+	defer n.Blockstore.PinLock().Unlock()
+
+	expired := n.Pinning.Expired(time.Now())
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	for _, c := range expired {
+		err := n.Pinning.Unpin(ctx, c, true)
+		if err != nil && err != pin.ErrNotPinned {
+			return nil, err
+		}
+	}
+
+	err := n.Pinning.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// PeriodicPinReaper removes expired pins at regular intervals until the
+// given context is cancelled.
+func PeriodicPinReaper(ctx context.Context, n *core.IpfsNode) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pinReapInterval):
+			removed, err := ReapExpiredPins(n, ctx)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			for _, c := range removed {
+				log.Infof("removed expired pin %s", c)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package corerepo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+	resolver "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path/resolver"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	base32 "gx/ipfs/QmfVj3x4D6Jkq9SEoi5n2NmoUomLwoeiwnYz2KQa15wRw6/base32"
+)
+
+// gcProtectConfigKey is the config key listing the paths protected from
+// garbage collections, in addition to the files API root.
+const gcProtectConfigKey = "GC.ProtectedRoots"
+
+// protectedRootsPrefix is the prefix under which the cid each protected path
+// last resolved to is stored.
+var protectedRootsPrefix = ds.NewKey("/local/gc/protected")
+
+func protectedRootKey(p string) ds.Key {
+	return protectedRootsPrefix.ChildString(base32.RawStdEncoding.EncodeToString([]byte(p)))
+}
+
+// ProtectedRoots returns the paths protected from garbage collections. Like
+// the files API root, they are best effort roots: they are not pinned, and
+// their blocks which are not stored locally are not fetched.
+func ProtectedRoots(r repo.Repo) ([]string, error) {
+	v, err := r.GetConfigKey(gcProtectConfigKey)
+	if err != nil || v == nil {
+		// the key is missing on most configs
+		return nil, nil
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s, expected a list of paths", gcProtectConfigKey)
+	}
+	paths := make([]string, 0, len(list))
+	for _, p := range list {
+		s, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s, expected a list of paths", gcProtectConfigKey)
+		}
+		paths = append(paths, s)
+	}
+	return paths, nil
+}
+
+// AddProtectedRoots adds the given paths to the paths protected from
+// garbage collections, and returns the ones which were not protected yet.
+// The /ipns paths are resolved every time a garbage collection runs.
+func AddProtectedRoots(r repo.Repo, paths []string) ([]string, error) {
+	current, err := ProtectedRoots(r)
+	if err != nil {
+		return nil, err
+	}
+	protected := make(map[string]bool)
+	for _, p := range current {
+		protected[p] = true
+	}
+
+	var added []string
+	for _, p := range paths {
+		parsed, err := path.ParsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		if protected[parsed.String()] {
+			continue
+		}
+		protected[parsed.String()] = true
+		added = append(added, parsed.String())
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	return added, r.SetConfigKey(gcProtectConfigKey, append(current, added...))
+}
+
+// RemoveProtectedRoots removes the given paths from the paths protected
+// from garbage collections, and returns the ones which were protected.
+func RemoveProtectedRoots(r repo.Repo, paths []string) ([]string, error) {
+	current, err := ProtectedRoots(r)
+	if err != nil {
+		return nil, err
+	}
+	remove := make(map[string]bool)
+	for _, p := range paths {
+		parsed, err := path.ParsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		remove[parsed.String()] = true
+	}
+
+	kept := make([]string, 0, len(current))
+	var removed []string
+	for _, p := range current {
+		if remove[p] {
+			removed = append(removed, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	if err := r.SetConfigKey(gcProtectConfigKey, kept); err != nil {
+		return nil, err
+	}
+	for _, p := range removed {
+		if err := r.Datastore().Delete(protectedRootKey(p)); err != nil && err != ds.ErrNotFound {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// resolveProtectedRoots resolves the protected paths to the cids of their
+// roots, and stores them. When a path can not be resolved, for instance
+// because an IPNS name could not be found offline, the cid it last resolved
+// to is protected instead. If it never resolved, an error is returned, so
+// that the garbage collection does not remove what it protects.
+func resolveProtectedRoots(ctx context.Context, n *core.IpfsNode) ([]cid.Cid, error) {
+	paths, err := ProtectedRoots(n.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	d := n.Repo.Datastore()
+	roots := make([]cid.Cid, 0, len(paths))
+	for _, s := range paths {
+		p, err := path.ParsePath(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protected root %q: %s", s, err)
+		}
+		c, err := resolveProtectedRoot(ctx, n, p)
+		if err != nil {
+			last, lerr := lastProtectedRoot(d, s)
+			if lerr != nil {
+				return nil, fmt.Errorf("cannot resolve the protected root %s: %s", s, err)
+			}
+			log.Warningf("cannot resolve the protected root %s, protecting %s which it last resolved to: %s", s, last, err)
+			roots = append(roots, last)
+			continue
+		}
+		if err := d.Put(protectedRootKey(s), c.Bytes()); err != nil {
+			return nil, err
+		}
+		roots = append(roots, c)
+	}
+	return roots, nil
+}
+
+// lastProtectedRoot returns the cid the given protected path last resolved
+// to.
+func lastProtectedRoot(d ds.Datastore, p string) (cid.Cid, error) {
+	b, err := d.Get(protectedRootKey(p))
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return cid.Cast(b)
+}
+
+func resolveProtectedRoot(ctx context.Context, n *core.IpfsNode, p path.Path) (cid.Cid, error) {
+	p, err := core.ResolveIPNS(ctx, n.Namesys, p)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	// the root of the path does not need to be stored locally
+	c, rest, err := path.SplitAbsPath(p)
+	if err != nil || len(rest) == 0 {
+		return c, err
+	}
+
+	// the nodes along the path are not fetched either
+	bs := bserv.New(n.Blockstore, offline.Exchange(n.Blockstore))
+	r := resolver.NewBasicResolver(dag.NewDAGService(bs))
+	nd, err := r.ResolvePath(ctx, p)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return nd.Cid(), nil
+}
+
+// gcRoots returns the best effort roots of a garbage collection: the files
+// API root and the protected roots.
+func gcRoots(ctx context.Context, n *core.IpfsNode) ([]cid.Cid, error) {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := resolveProtectedRoots(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	return append(roots, protected...), nil
+}
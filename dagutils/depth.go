@@ -0,0 +1,44 @@
+package dagutils
+
+import (
+	"context"
+
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// EnumerateChildrenDepth works like merkledag.EnumerateChildren but only
+// walks the graph down to maxDepth levels below root, root being at depth
+// 0. The links of the nodes found at maxDepth are not requested.
+//
+// visit is called for every cid reached. A node seen again at a smaller
+// depth than before is walked again, so every node within maxDepth of root
+// is visited regardless of the order in which the graph is explored.
+func EnumerateChildrenDepth(ctx context.Context, getLinks mdag.GetLinks, root cid.Cid, maxDepth int, visit func(cid.Cid) bool) error {
+	depths := make(map[cid.Cid]int)
+
+	var walk func(c cid.Cid, depth int) error
+	walk = func(c cid.Cid, depth int) error {
+		if depth >= maxDepth {
+			return nil
+		}
+		links, err := getLinks(ctx, c)
+		if err != nil {
+			return err
+		}
+		for _, lnk := range links {
+			d := depth + 1
+			if seen, ok := depths[lnk.Cid]; ok && seen <= d {
+				continue
+			}
+			depths[lnk.Cid] = d
+			visit(lnk.Cid)
+			if err := walk(lnk.Cid, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, 0)
+}
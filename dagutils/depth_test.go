@@ -0,0 +1,64 @@
+package dagutils
+
+import (
+	"context"
+	"testing"
+
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+	mdtest "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag/test"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// d is reachable both at depth 1 and at depth 3 from a
+var tgDepth = map[string]ndesc{
+	"a": ndesc{
+		"x": "b",
+		"y": "d",
+	},
+	"b": ndesc{
+		"x": "c",
+	},
+	"c": ndesc{
+		"x": "d",
+	},
+	"d": ndesc{
+		"x": "e",
+	},
+	"e": ndesc{},
+}
+
+func TestEnumerateChildrenDepth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nds := mkGraph(tgDepth)
+
+	ds := mdtest.Mock()
+	for _, nd := range nds {
+		if err := ds.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for depth, names := range map[int][]string{
+		0: nil,
+		1: {"b", "d"},
+		2: {"b", "c", "d", "e"},
+		4: {"b", "c", "d", "e"},
+	} {
+		set := cid.NewSet()
+		err := EnumerateChildrenDepth(ctx, dag.GetLinksWithDAG(ds), nds["a"].Cid(), depth, set.Visit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if set.Len() != len(names) {
+			t.Fatalf("depth %d: expected %d nodes, got %d", depth, len(names), set.Len())
+		}
+		for _, name := range names {
+			if !set.Has(nds[name].Cid()) {
+				t.Fatalf("depth %d: %s was not visited", depth, name)
+			}
+		}
+	}
+}
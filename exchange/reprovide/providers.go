@@ -3,10 +3,13 @@ package reprovide
 import (
 	"context"
 
+	dagutils "github.com/ipfs/go-ipfs/dagutils"
 	pin "github.com/ipfs/go-ipfs/pin"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	blocks "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
 	cidutil "gx/ipfs/QmbfKu17LbMWyGUxHEUns9Wf5Dkm8PT6be4uPhTkk4YvaV/go-cidutil"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 	merkledag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
@@ -44,6 +47,97 @@ func NewPinnedProvider(pinning pin.Pinner, dag ipld.DAGService, onlyRoots bool)
 	}
 }
 
+// NewMFSProvider returns provider supplying the files API root given by
+// getRoot and its descendants. Only the blocks stored in bstore are
+// supplied, the others are not fetched.
+func NewMFSProvider(getRoot func(context.Context) (cid.Cid, error), bstore blocks.Blockstore) KeyChanFunc {
+	dag := merkledag.NewDAGService(bserv.New(bstore, offline.Exchange(bstore)))
+
+	// getLinks leaves out the links to blocks which are not stored, so
+	// they are neither walked nor supplied
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := ipld.GetLinks(ctx, dag, c)
+		if err != nil {
+			return nil, err
+		}
+		var stored []*ipld.Link
+		for _, l := range links {
+			has, err := bstore.Has(l.Cid)
+			if err != nil {
+				return nil, err
+			}
+			if has {
+				stored = append(stored, l)
+			}
+		}
+		return stored, nil
+	}
+
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		root, err := getRoot(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		set := cidutil.NewStreamingSet()
+		go func() {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer close(set.New)
+
+			set.Visitor(ctx)(root)
+			err := merkledag.EnumerateChildren(ctx, getLinks, root, set.Visitor(ctx))
+			if err != nil {
+				log.Errorf("reprovide files: %s", err)
+			}
+		}()
+
+		return set.New, nil
+	}
+}
+
+// NewCombinedProvider returns provider supplying the keys of every given
+// provider, in order. Keys supplied by several providers are only supplied
+// once.
+func NewCombinedProvider(providers ...KeyChanFunc) KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		// stops the providers which already started if one fails
+		ctx, cancel := context.WithCancel(ctx)
+
+		chans := make([]<-chan cid.Cid, 0, len(providers))
+		for _, p := range providers {
+			ch, err := p(ctx)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			chans = append(chans, ch)
+		}
+
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer cancel()
+			defer close(outCh)
+
+			seen := cid.NewSet()
+			for _, ch := range chans {
+				for c := range ch {
+					if !seen.Visit(c) {
+						continue
+					}
+					select {
+					case <-ctx.Done():
+						return
+					case outCh <- c:
+					}
+				}
+			}
+		}()
+
+		return outCh, nil
+	}
+}
+
 func pinSet(ctx context.Context, pinning pin.Pinner, dag ipld.DAGService, onlyRoots bool) (*cidutil.StreamingSet, error) {
 	set := cidutil.NewStreamingSet()
 
@@ -67,6 +161,18 @@ func pinSet(ctx context.Context, pinning pin.Pinner, dag ipld.DAGService, onlyRo
 				}
 			}
 		}
+
+		for key, depth := range pinning.DepthLimitedKeys() {
+			set.Visitor(ctx)(key)
+
+			if !onlyRoots {
+				err := dagutils.EnumerateChildrenDepth(ctx, merkledag.GetLinksWithDAG(dag), key, depth, set.Visitor(ctx))
+				if err != nil {
+					log.Errorf("reprovide depth limited pins: %s", err)
+					return
+				}
+			}
+		}
 	}()
 
 	return set, nil
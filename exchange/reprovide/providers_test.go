@@ -0,0 +1,75 @@
+package reprovide_test
+
+import (
+	"context"
+	"testing"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	merkledag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+
+	. "github.com/ipfs/go-ipfs/exchange/reprovide"
+)
+
+func collectKeys(t *testing.T, kp KeyChanFunc) []cid.Cid {
+	ch, err := kp(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []cid.Cid
+	for c := range ch {
+		keys = append(keys, c)
+	}
+	return keys
+}
+
+func TestMFSAndCombinedProviders(t *testing.T) {
+	ctx := context.Background()
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dag := merkledag.NewDAGService(bserv.New(bstore, offline.Exchange(bstore)))
+
+	stored := merkledag.NodeWithData([]byte("stored"))
+	missing := merkledag.NodeWithData([]byte("missing"))
+	root := merkledag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("stored", stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("missing", missing); err != nil {
+		t.Fatal(err)
+	}
+	other := merkledag.NodeWithData([]byte("other"))
+	for _, nd := range []*merkledag.ProtoNode{root, stored, other} {
+		if err := dag.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mfsProvider := NewMFSProvider(func(context.Context) (cid.Cid, error) {
+		return root.Cid(), nil
+	}, bstore)
+
+	keys := collectKeys(t, mfsProvider)
+	if len(keys) != 2 || !keys[0].Equals(root.Cid()) || !keys[1].Equals(stored.Cid()) {
+		t.Fatalf("expected the root and its stored child, got %v", keys)
+	}
+
+	// the blockstore provides every key of the mfs provider again
+	keys = collectKeys(t, NewCombinedProvider(mfsProvider, NewBlockstoreProvider(bstore)))
+	if len(keys) != 3 {
+		t.Fatalf("expected the 3 stored keys once, got %v", keys)
+	}
+	seen := cid.NewSet()
+	for _, c := range keys {
+		if !seen.Visit(c) {
+			t.Fatalf("%s was provided twice", c)
+		}
+	}
+	if !seen.Has(other.Cid()) {
+		t.Fatalf("expected %s to be provided", other.Cid())
+	}
+}
@@ -0,0 +1,354 @@
+package reprovide
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmYMQuypUbgsdNHmuCBSUJV6wdQVsBHRivNAp3efHJwZJD/go-verifcid"
+	routing "gx/ipfs/QmZBH87CAPFHcc7cYmBqeSQ98zQ3SX9KUxiYgzPmLWNVKz/go-libp2p-routing"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// queueDatastorePrefix is the prefix under which queued keys are stored, one
+// datastore key per cid.
+var queueDatastorePrefix = ds.NewKey("/local/provide/queue")
+
+// provideTimeout bounds a single attempt to provide a queued key.
+const provideTimeout = time.Minute
+
+// ErrQueueFull is returned by Enqueue when the queue holds MaxEntries keys.
+var ErrQueueFull = errors.New("provide queue is full")
+
+// QueueEntry is a key waiting to be provided.
+type QueueEntry struct {
+	Cid   cid.Cid
+	Added time.Time
+
+	// Attempts is the number of failed attempts to provide the key
+	Attempts int
+	// Next is the time of the next attempt
+	Next time.Time
+	// Err is the error of the last failed attempt
+	Err string `json:",omitempty"`
+
+	index int
+}
+
+// QueueStats describes the state of the provide queue.
+type QueueStats struct {
+	// Pending is the number of keys waiting to be provided, including the
+	// Retrying ones
+	Pending int
+	// Retrying is the number of keys which failed to be provided at least
+	// once
+	Retrying int
+
+	// Provided is the number of keys provided since the queue was started
+	Provided uint64
+	// Failed is the number of failed attempts since the queue was started
+	Failed uint64
+}
+
+// entryHeap orders the queued entries by the time of their next attempt.
+type entryHeap []*QueueEntry
+
+func (h entryHeap) Len() int { return len(h) }
+func (h entryHeap) Less(i, j int) bool {
+	return h[i].Next.Before(h[j].Next)
+}
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*QueueEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Queue announces the keys added to it in the background, until they are
+// provided. The keys are stored in the datastore, so the ones which could
+// not be provided yet, for instance because the routing system was not
+// reachable, are announced after a restart instead of waiting for the next
+// reprovide. Failed attempts are retried with an exponential backoff.
+//
+// The queue is bounded: it holds at most MaxEntries keys, and the keys
+// queued for longer than MaxAge are dropped instead of being retried.
+type Queue struct {
+	dstore ds.Datastore
+
+	// RetryDelay is the delay before the first retry of a key, doubled
+	// after each failed attempt up to MaxRetryDelay. They must be set
+	// before Run is called.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// MaxEntries is the maximum number of queued keys. The keys stored
+	// beyond it are dropped when the queue is loaded.
+	MaxEntries int
+	// MaxAge is the time after which a queued key which still could not be
+	// provided is dropped, 0 to keep retrying it. It must be set before Run
+	// is called.
+	MaxAge time.Duration
+
+	lock     sync.Mutex
+	entries  map[cid.Cid]*QueueEntry
+	order    entryHeap
+	retrying int
+	provided uint64
+	failed   uint64
+	wake     chan struct{}
+}
+
+// NewQueue creates a Queue and loads the keys stored in the given
+// datastore.
+func NewQueue(d ds.Datastore) (*Queue, error) {
+	q := &Queue{
+		dstore:        d,
+		RetryDelay:    10 * time.Second,
+		MaxRetryDelay: time.Hour,
+		MaxEntries:    1 << 16,
+		MaxAge:        24 * time.Hour,
+		entries:       make(map[cid.Cid]*QueueEntry),
+		wake:          make(chan struct{}, 1),
+	}
+
+	res, err := d.Query(dsq.Query{Prefix: queueDatastorePrefix.String()})
+	if err != nil {
+		return nil, fmt.Errorf("cannot load provide queue: %v", err)
+	}
+	defer res.Close()
+
+	var dropped []ds.Key
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, fmt.Errorf("cannot load provide queue: %v", r.Error)
+		}
+		if len(q.entries) >= q.MaxEntries {
+			dropped = append(dropped, ds.RawKey(r.Key))
+			continue
+		}
+		e := new(QueueEntry)
+		if err := json.Unmarshal(r.Value, e); err != nil {
+			log.Errorf("decoding provide queue entry %s: %s", r.Key, err)
+			continue
+		}
+		q.entries[e.Cid] = e
+		q.order = append(q.order, e)
+		if e.Attempts > 0 {
+			q.retrying++
+		}
+	}
+	for i, e := range q.order {
+		e.index = i
+	}
+	heap.Init(&q.order)
+
+	if len(dropped) > 0 {
+		log.Warningf("dropping %d keys beyond the %d keys of the provide queue", len(dropped), q.MaxEntries)
+		for _, k := range dropped {
+			if err := d.Delete(k); err != nil {
+				log.Errorf("cannot remove provide queue entry: %s", err)
+			}
+		}
+	}
+	return q, nil
+}
+
+func queueKey(c cid.Cid) ds.Key {
+	return queueDatastorePrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// put persists the given entry. The queue lock must be held.
+func (q *Queue) put(e *QueueEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return q.dstore.Put(queueKey(e.Cid), b)
+}
+
+// Enqueue adds the given key to the queue. Adding a key which is already
+// queued does nothing. ErrQueueFull is returned when the queue holds
+// MaxEntries keys.
+func (q *Queue) Enqueue(c cid.Cid) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.entries[c]; ok {
+		return nil
+	}
+	if len(q.entries) >= q.MaxEntries {
+		return ErrQueueFull
+	}
+
+	now := time.Now()
+	e := &QueueEntry{
+		Cid:   c,
+		Added: now,
+		Next:  now,
+	}
+	if err := q.put(e); err != nil {
+		return fmt.Errorf("cannot store provide queue entry: %v", err)
+	}
+	q.entries[c] = e
+	heap.Push(&q.order, e)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Stats returns the state of the queue.
+func (q *Queue) Stats() QueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return QueueStats{
+		Pending:  len(q.entries),
+		Retrying: q.retrying,
+		Provided: q.provided,
+		Failed:   q.failed,
+	}
+}
+
+// next returns the entry to provide next, or the time to wait before one is
+// due. The entry stays in the queue until done is called.
+func (q *Queue) next() (*QueueEntry, time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.order) == 0 {
+		return nil, -1
+	}
+	e := q.order[0]
+	if wait := time.Until(e.Next); wait > 0 {
+		return nil, wait
+	}
+	return e, 0
+}
+
+// done removes a provided entry from the queue, or schedules the next
+// attempt of a failed one.
+func (q *Queue) done(e *QueueEntry, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err == nil {
+		q.provided++
+		q.remove(e)
+		return
+	}
+
+	q.failed++
+	if e.Attempts == 0 {
+		q.retrying++
+	}
+	e.Attempts++
+	e.Err = err.Error()
+	e.Next = time.Now().Add(q.retryDelay(e.Attempts))
+	heap.Fix(&q.order, e.index)
+	if err := q.put(e); err != nil {
+		log.Errorf("cannot store provide queue entry: %s", err)
+	}
+}
+
+// remove removes an entry from the queue. The queue lock must be held.
+func (q *Queue) remove(e *QueueEntry) {
+	if e.Attempts > 0 {
+		q.retrying--
+	}
+	heap.Remove(&q.order, e.index)
+	delete(q.entries, e.Cid)
+	if err := q.dstore.Delete(queueKey(e.Cid)); err != nil && err != ds.ErrNotFound {
+		log.Errorf("cannot remove provide queue entry: %s", err)
+	}
+}
+
+// retryDelay returns the delay before the next attempt of a key which
+// failed to be provided the given number of times.
+func (q *Queue) retryDelay(attempts int) time.Duration {
+	delay := q.RetryDelay
+	for i := 1; i < attempts && delay < q.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.MaxRetryDelay {
+		delay = q.MaxRetryDelay
+	}
+	return delay
+}
+
+// Run provides the queued keys with the given routing system until the
+// context is cancelled.
+func (q *Queue) Run(ctx context.Context, rsys routing.ContentRouting) {
+	for {
+		e, wait := q.next()
+		if e == nil {
+			// wait for the first key to be due, or for a key to be added
+			var timer *time.Timer
+			var due <-chan time.Time
+			if wait >= 0 {
+				timer = time.NewTimer(wait)
+				due = timer.C
+			}
+			select {
+			case <-q.wake:
+			case <-due:
+			case <-ctx.Done():
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		if q.MaxAge > 0 && time.Since(e.Added) > q.MaxAge {
+			log.Debugf("dropping %s from the provide queue, queued since %s", e.Cid, e.Added)
+			q.lock.Lock()
+			q.remove(e)
+			q.lock.Unlock()
+			continue
+		}
+
+		// hash security
+		if err := verifcid.ValidateCid(e.Cid); err != nil {
+			log.Errorf("insecure hash in provide queue, %s (%s)", e.Cid, err)
+			q.lock.Lock()
+			q.remove(e)
+			q.lock.Unlock()
+			continue
+		}
+
+		pctx, cancel := context.WithTimeout(ctx, provideTimeout)
+		err := rsys.Provide(pctx, e.Cid, true)
+		cancel()
+		if ctx.Err() != nil {
+			// interrupted by shutdown, the key is provided on the next start
+			return
+		}
+		if err != nil {
+			log.Debugf("failed to provide %s, retrying later: %s", e.Cid, err)
+		}
+		q.done(e, err)
+	}
+}
@@ -0,0 +1,138 @@
+package reprovide_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	routing "gx/ipfs/QmZBH87CAPFHcc7cYmBqeSQ98zQ3SX9KUxiYgzPmLWNVKz/go-libp2p-routing"
+	testutil "gx/ipfs/QmZXjR5X1p4KrQ967cTsy4MymMzUM8mZECF3PV8UcN4o3g/go-testutil"
+	mock "gx/ipfs/QmdxhyAwBrnmJFsYPK6tyHh4Yy3gK8gbULErX1dRnpUMqu/go-ipfs-routing/mock"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+
+	. "github.com/ipfs/go-ipfs/exchange/reprovide"
+)
+
+// flakyRouting fails the given number of provides before using the wrapped
+// routing system.
+type flakyRouting struct {
+	routing.ContentRouting
+
+	lk       sync.Mutex
+	failures int
+}
+
+func (r *flakyRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	r.lk.Lock()
+	if r.failures > 0 {
+		r.failures--
+		r.lk.Unlock()
+		return errors.New("routing not reachable")
+	}
+	r.lk.Unlock()
+	return r.ContentRouting.Provide(ctx, c, announce)
+}
+
+func TestProvideQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+	clB := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	q, err := NewQueue(dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk := blocks.NewBlock([]byte("queued"))
+	if err := q.Enqueue(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if s := q.Stats(); s.Pending != 1 {
+		t.Fatalf("expected one pending key, got %#v", s)
+	}
+
+	// the queue is reloaded from the datastore, as after a restart
+	q, err = NewQueue(dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.RetryDelay = 10 * time.Millisecond
+	q.MaxRetryDelay = 20 * time.Millisecond
+
+	go q.Run(ctx, &flakyRouting{ContentRouting: clA, failures: 3})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().Pending != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the key was not provided: %#v", q.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if s := q.Stats(); s.Provided != 1 || s.Failed != 3 || s.Retrying != 0 {
+		t.Fatalf("unexpected queue stats: %#v", s)
+	}
+	if _, ok := <-clB.FindProvidersAsync(ctx, blk.Cid(), 1); !ok {
+		t.Fatalf("%s was not provided", blk.Cid())
+	}
+
+	q, err = NewQueue(dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := q.Stats(); s.Pending != 0 {
+		t.Fatalf("expected the provided key to be removed from the datastore, got %#v", s)
+	}
+}
+
+func TestProvideQueueBounds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	q, err := NewQueue(dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.MaxEntries = 1
+
+	first := blocks.NewBlock([]byte("first"))
+	second := blocks.NewBlock([]byte("second"))
+	if err := q.Enqueue(first.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(second.Cid()); err != ErrQueueFull {
+		t.Fatalf("expected the queue to be full, got %v", err)
+	}
+
+	// the key is dropped instead of being retried once it is too old
+	q.MaxAge = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	go q.Run(ctx, &flakyRouting{ContentRouting: clA, failures: 1})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stats().Pending != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the key was not dropped: %#v", q.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := q.Stats(); s.Provided != 0 || s.Failed != 0 {
+		t.Fatalf("expected the key to be dropped without being provided, got %#v", s)
+	}
+}
@@ -2,7 +2,9 @@ package reprovide
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	backoff "gx/ipfs/QmPJUtEJsm5YLUWhF6imvyCH8KZXRJa9Wup7FDMwTy5Ufz/backoff"
@@ -10,14 +12,59 @@ import (
 	"gx/ipfs/QmYMQuypUbgsdNHmuCBSUJV6wdQVsBHRivNAp3efHJwZJD/go-verifcid"
 	routing "gx/ipfs/QmZBH87CAPFHcc7cYmBqeSQ98zQ3SX9KUxiYgzPmLWNVKz/go-libp2p-routing"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
 )
 
 var log = logging.Logger("reprovider")
 
+// historyKey is the datastore key under which the history of the runs is
+// stored.
+var historyKey = ds.NewKey("/local/reprovider/history")
+
+// historySize is the number of finished runs kept in the history.
+const historySize = 16
+
 //KeyChanFunc is function streaming CIDs to pass to content routing
 type KeyChanFunc func(context.Context) (<-chan cid.Cid, error)
 type doneFunc func(error)
 
+// RunStats describes a run of the reprovider.
+type RunStats struct {
+	Start time.Time
+	// End is the zero time while the run is in progress
+	End time.Time
+
+	// Provided is the number of CIDs announced
+	Provided uint64
+	// Failed is the number of CIDs which could not be announced
+	Failed uint64
+
+	// Error is the error which ended the run, if any
+	Error string `json:",omitempty"`
+}
+
+// Duration returns how long the run took, or has been going on for.
+func (s RunStats) Duration() time.Duration {
+	if s.End.IsZero() {
+		return time.Since(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// Stats describes the state of the reprovider.
+type Stats struct {
+	// Running is true while a run is in progress, described by Current
+	Running bool
+	Current RunStats
+
+	// Next is the time of the next scheduled run, the zero time if runs
+	// are only triggered manually
+	Next time.Time
+
+	// History holds the last finished runs, most recent first
+	History []RunStats
+}
+
 type Reprovider struct {
 	ctx     context.Context
 	trigger chan doneFunc
@@ -26,6 +73,22 @@ type Reprovider struct {
 	rsys routing.ContentRouting
 
 	keyProvider KeyChanFunc
+
+	// Workers is the number of keys provided concurrently, at least 1. It
+	// must be set before Run is called.
+	Workers int
+	// RateLimit is the maximum number of keys provided per second, 0 for
+	// no limit. It must be set before Run is called.
+	RateLimit float64
+
+	// dstore persists the history of the runs, if not nil
+	dstore ds.Datastore
+
+	statsLk sync.Mutex
+	running bool
+	current RunStats
+	next    time.Time
+	history []RunStats
 }
 
 // NewReprovider creates new Reprovider instance.
@@ -36,6 +99,96 @@ func NewReprovider(ctx context.Context, rsys routing.ContentRouting, keyProvider
 
 		rsys:        rsys,
 		keyProvider: keyProvider,
+		Workers:     1,
+	}
+}
+
+// PersistHistory loads the history of the runs from the given datastore,
+// and stores the history there after every run. It must be called before
+// Run. When the stored history can not be loaded, the error is returned and
+// the history is replaced after the next run.
+func (rp *Reprovider) PersistHistory(dstore ds.Datastore) error {
+	history, err := LoadHistory(dstore)
+
+	rp.statsLk.Lock()
+	defer rp.statsLk.Unlock()
+	rp.dstore = dstore
+	rp.history = history
+	return err
+}
+
+// LoadHistory returns the history of the runs stored in the given datastore
+// by a reprovider, most recent first.
+func LoadHistory(dstore ds.Datastore) ([]RunStats, error) {
+	b, err := dstore.Get(historyKey)
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	var history []RunStats
+	if err := json.Unmarshal(b, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Stats returns the state of the reprovider and the history of its runs.
+func (rp *Reprovider) Stats() Stats {
+	rp.statsLk.Lock()
+	defer rp.statsLk.Unlock()
+
+	return Stats{
+		Running: rp.running,
+		Current: rp.current,
+		Next:    rp.next,
+		History: append([]RunStats(nil), rp.history...),
+	}
+}
+
+func (rp *Reprovider) startRun() {
+	rp.statsLk.Lock()
+	defer rp.statsLk.Unlock()
+
+	rp.running = true
+	rp.current = RunStats{Start: time.Now()}
+}
+
+func (rp *Reprovider) countRun(provided, failed uint64) {
+	rp.statsLk.Lock()
+	defer rp.statsLk.Unlock()
+
+	rp.current.Provided += provided
+	rp.current.Failed += failed
+}
+
+func (rp *Reprovider) endRun(err error) {
+	rp.statsLk.Lock()
+	defer rp.statsLk.Unlock()
+
+	rp.running = false
+	rp.current.End = time.Now()
+	if err != nil {
+		rp.current.Error = err.Error()
+	}
+
+	rp.history = append([]RunStats{rp.current}, rp.history...)
+	if len(rp.history) > historySize {
+		rp.history = rp.history[:historySize]
+	}
+
+	if rp.dstore == nil {
+		return
+	}
+	b, err := json.Marshal(rp.history)
+	if err == nil {
+		err = rp.dstore.Put(historyKey, b)
+	}
+	if err != nil {
+		log.Errorf("storing the reprovider history: %s", err)
 	}
 }
 
@@ -45,11 +198,16 @@ func (rp *Reprovider) Run(tick time.Duration) {
 	// may have just started the daemon and shutting it down immediately.
 	// probability( up another minute | uptime ) increases with uptime.
 	after := time.After(time.Minute)
+	next := time.Now().Add(time.Minute)
 	var done doneFunc
 	for {
 		if tick == 0 {
 			after = make(chan time.Time)
+			next = time.Time{}
 		}
+		rp.statsLk.Lock()
+		rp.next = next
+		rp.statsLk.Unlock()
 
 		select {
 		case <-rp.ctx.Done():
@@ -64,7 +222,7 @@ func (rp *Reprovider) Run(tick time.Duration) {
 
 		err := rp.Reprovide()
 		if err != nil {
-			log.Debug(err)
+			log.Warningf("reprovide: %s", err)
 		}
 
 		if done != nil {
@@ -74,37 +232,103 @@ func (rp *Reprovider) Run(tick time.Duration) {
 		unmute()
 
 		after = time.After(tick)
+		next = time.Now().Add(tick)
 	}
 }
 
-// Reprovide registers all keys given by rp.keyProvider to libp2p content routing
-func (rp *Reprovider) Reprovide() error {
-	keychan, err := rp.keyProvider(rp.ctx)
+// Reprovide registers all keys given by rp.keyProvider to libp2p content
+// routing. Keys are provided by rp.Workers workers, at most rp.RateLimit per
+// second. The run stops at the first key which can not be provided.
+func (rp *Reprovider) Reprovide() (err error) {
+	rp.startRun()
+	defer func() {
+		rp.endRun(err)
+	}()
+
+	ctx, cancel := context.WithCancel(rp.ctx)
+	defer cancel()
+
+	keychan, err := rp.keyProvider(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get key chan: %s", err)
 	}
-	for c := range keychan {
-		// hash security
-		if err := verifcid.ValidateCid(c); err != nil {
-			log.Errorf("insecure hash in reprovider, %s (%s)", c, err)
-			continue
+
+	// wait blocks until the next key can be provided
+	wait := func() bool { return ctx.Err() == nil }
+	if rp.RateLimit > 0 {
+		// rates above one key per nanosecond round the interval down to 0,
+		// which tickers do not accept
+		interval := time.Duration(float64(time.Second) / rp.RateLimit)
+		if interval < 1 {
+			interval = 1
 		}
-		op := func() error {
-			err := rp.rsys.Provide(rp.ctx, c, true)
-			if err != nil {
-				log.Debugf("Failed to provide key: %s", err)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		wait = func() bool {
+			select {
+			case <-ticker.C:
+				return true
+			case <-ctx.Done():
+				return false
 			}
-			return err
 		}
+	}
+
+	workers := rp.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range keychan {
+				if !wait() {
+					return
+				}
+				if perr := rp.provide(ctx, c); perr != nil {
+					errOnce.Do(func() {
+						err = perr
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
 
-		// TODO: this backoff library does not respect our context, we should
-		// eventually work contexts into it. low priority.
-		err := backoff.Retry(op, backoff.NewExponentialBackOff())
+	return err
+}
+
+// provide provides a single key, retrying on failures.
+func (rp *Reprovider) provide(ctx context.Context, c cid.Cid) error {
+	// hash security
+	if err := verifcid.ValidateCid(c); err != nil {
+		log.Errorf("insecure hash in reprovider, %s (%s)", c, err)
+		rp.countRun(0, 1)
+		return nil
+	}
+	op := func() error {
+		err := rp.rsys.Provide(ctx, c, true)
 		if err != nil {
-			log.Debugf("Providing failed after number of retries: %s", err)
-			return err
+			log.Debugf("Failed to provide key: %s", err)
 		}
+		return err
+	}
+
+	// TODO: this backoff library does not respect our context, we should
+	// eventually work contexts into it. low priority.
+	err := backoff.Retry(op, backoff.NewExponentialBackOff())
+	if err != nil {
+		log.Debugf("Providing failed after number of retries: %s", err)
+		rp.countRun(0, 1)
+		return err
 	}
+	rp.countRun(1, 0)
 	return nil
 }
 
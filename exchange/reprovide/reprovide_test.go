@@ -2,7 +2,9 @@ package reprovide_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	pstore "gx/ipfs/QmQAGG1zxfePqj2t7bLxyN8AFccZ889DDR9Gn8kVLDrGZo/go-libp2p-peerstore"
 	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
@@ -55,3 +57,108 @@ func TestReprovide(t *testing.T) {
 		t.Fatal("Somehow got the wrong peer back as a provider.")
 	}
 }
+
+func TestReprovideHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	if err := bstore.Put(blocks.NewBlock([]byte("block"))); err != nil {
+		t.Fatal(err)
+	}
+
+	reprov := NewReprovider(ctx, clA, NewBlockstoreProvider(bstore))
+	if err := reprov.PersistHistory(dstore); err != nil {
+		t.Fatal(err)
+	}
+	if err := reprov.Reprovide(); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := LoadHistory(dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("expected one finished run in the stored history, got %#v", history)
+	}
+	if run := history[0]; run.Provided != 1 || run.Failed != 0 || run.End.Before(run.Start) {
+		t.Fatalf("unexpected run stats: %#v", run)
+	}
+
+	reprov = NewReprovider(ctx, clA, NewBlockstoreProvider(bstore))
+	if err := reprov.PersistHistory(dstore); err != nil {
+		t.Fatal(err)
+	}
+	if stats := reprov.Stats(); stats.Running || len(stats.History) != 1 {
+		t.Fatalf("expected the stored history to be loaded, got %#v", stats)
+	}
+}
+
+func TestReprovideWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+	clB := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+
+	var keys []blocks.Block
+	for i := 0; i < 20; i++ {
+		blk := blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+		if err := bstore.Put(blk); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, blk)
+	}
+
+	reprov := NewReprovider(ctx, clA, NewBlockstoreProvider(bstore))
+	reprov.Workers = 4
+	reprov.RateLimit = 100
+
+	start := time.Now()
+	if err := reprov.Reprovide(); err != nil {
+		t.Fatal(err)
+	}
+	// 20 keys at 100 per second take at least 190ms, whatever the workers
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Fatalf("the rate limit was not respected: 20 keys provided in %s", elapsed)
+	}
+
+	if run := reprov.Stats().History[0]; run.Provided != uint64(len(keys)) || run.Failed != 0 {
+		t.Fatalf("unexpected run stats: %#v", run)
+	}
+	for _, blk := range keys {
+		if _, ok := <-clB.FindProvidersAsync(ctx, blk.Cid(), 1); !ok {
+			t.Fatalf("%s was not provided", blk.Cid())
+		}
+	}
+}
+
+func TestReprovideHighRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mrserv := mock.NewServer()
+	clA := mrserv.Client(testutil.RandIdentityOrFatal(t))
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	if err := bstore.Put(blocks.NewBlock([]byte("block"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the interval between two keys rounds down to 0
+	reprov := NewReprovider(ctx, clA, NewBlockstoreProvider(bstore))
+	reprov.RateLimit = 1e12
+	if err := reprov.Reprovide(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"context"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
 
@@ -175,3 +178,177 @@ func TestIsURL(t *testing.T) {
 		t.Fatal("IsURL recognized non-url")
 	}
 }
+
+func TestVerifyQuick(t *testing.T) {
+	dir, fs := newTestFilestore(t)
+
+	buf := make([]byte, 100)
+	rand.Read(buf)
+
+	fname, err := makeFile(dir, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &posinfo.FilestoreNode{
+		PosInfo: &posinfo.PosInfo{
+			FullPath: fname,
+			Offset:   10,
+			Stat:     st,
+		},
+		Node: dag.NewRawNode(buf[10:20]),
+	}
+	if err := fs.Put(n); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := VerifyQuick(fs, n.Cid()); r.Status != StatusOk {
+		t.Fatalf("expected the block to be ok, got %s: %s", r.Status, r.ErrorMsg)
+	}
+
+	// same size, but a different modification time
+	later := st.ModTime().Add(time.Minute)
+	if err := os.Chtimes(fname, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if r := VerifyQuick(fs, n.Cid()); r.Status != StatusFileChanged {
+		t.Fatalf("expected the block to be changed, got %s", r.Status)
+	}
+	// the data itself did not change
+	if r := Verify(fs, n.Cid()); r.Status != StatusOk {
+		t.Fatalf("expected the block data to be ok, got %s: %s", r.Status, r.ErrorMsg)
+	}
+
+	if err := os.Remove(fname); err != nil {
+		t.Fatal(err)
+	}
+	next, err := VerifyAllQuick(fs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r == nil || r.Status != StatusFileNotFound {
+		t.Fatalf("expected the file to be missing, got %v", r)
+	}
+	if r := next(); r != nil {
+		t.Fatalf("expected a single block, got %v", r)
+	}
+}
+
+func TestMoveAndRemovePath(t *testing.T) {
+	dir, fs := newTestFilestore(t)
+
+	buf := make([]byte, 100)
+	rand.Read(buf)
+
+	if err := os.Mkdir(filepath.Join(dir, "old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fname, err := makeFile(filepath.Join(dir, "old"), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cids []cid.Cid
+	for i := 0; i < 10; i++ {
+		n := &posinfo.FilestoreNode{
+			PosInfo: &posinfo.PosInfo{
+				FullPath: fname,
+				Offset:   uint64(i * 10),
+			},
+			Node: dag.NewRawNode(buf[i*10 : (i+1)*10]),
+		}
+		if err := fs.Put(n); err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, n.Node.Cid())
+	}
+
+	if err := os.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(cids[0]); err == nil {
+		t.Fatal("expected the moved file not to be found")
+	}
+
+	// "ol" is a prefix of "old", but not its parent directory
+	moved, err := fs.FileManager().MovePath(filepath.Join(dir, "ol"), filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 0 {
+		t.Fatalf("expected no reference to be moved, got %d", moved)
+	}
+	moved, err = fs.FileManager().MovePath(filepath.Join(dir, "old"), filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != len(cids) {
+		t.Fatalf("expected %d references to be moved, got %d", len(cids), moved)
+	}
+	for i, c := range cids {
+		blk, err := fs.Get(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(blk.RawData(), buf[i*10:(i+1)*10]) {
+			t.Fatal("data didnt match on the way out")
+		}
+	}
+
+	if _, err := fs.FileManager().MovePath(dir, filepath.Join(dir, "new")); err == nil {
+		t.Fatal("expected moving the root to fail")
+	}
+
+	removed, err := fs.FileManager().RemovePath(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != len(cids) {
+		t.Fatalf("expected %d references to be removed, got %d", len(cids), len(removed))
+	}
+	for _, c := range cids {
+		has, err := fs.Has(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			t.Fatalf("%s is still referenced", c)
+		}
+	}
+}
+
+func TestVerifyQuickWithoutStat(t *testing.T) {
+	dir, fs := newTestFilestore(t)
+
+	buf := make([]byte, 100)
+	rand.Read(buf)
+
+	fname, err := makeFile(dir, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// as for the files sent over HTTP, which come without a stat
+	n := &posinfo.FilestoreNode{
+		PosInfo: &posinfo.PosInfo{
+			FullPath: fname,
+			Offset:   0,
+		},
+		Node: dag.NewRawNode(buf[0:10]),
+	}
+	if err := fs.Put(n); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(fname, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if r := VerifyQuick(fs, n.Cid()); r.Status != StatusFileChanged {
+		t.Fatalf("expected the block to be changed, got %s", r.Status)
+	}
+}
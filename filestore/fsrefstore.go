@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	pb "github.com/ipfs/go-ipfs/filestore/pb"
 
@@ -31,8 +33,24 @@ var FilestorePrefix = ds.NewKey("filestore")
 type FileManager struct {
 	AllowFiles bool
 	AllowUrls  bool
-	ds         ds.Batching
-	root       string
+
+	// URLHeaders holds the HTTP headers sent along the requests to each
+	// host, with or without its port, for instance to authenticate to
+	// private origins.
+	URLHeaders map[string]http.Header
+	// URLRetries is the number of times a failed request to a URL is
+	// retried.
+	URLRetries int
+	// HTTPClient sends the requests to URLs, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	ds   ds.Batching
+	root string
+
+	// the last file stat'ed for the references lacking one
+	statLk   sync.Mutex
+	statPath string
+	statInfo os.FileInfo
 }
 
 // CorruptReferenceError implements the error interface.
@@ -54,7 +72,11 @@ func (c CorruptReferenceError) Error() string {
 // datastore and root. All FilestoreNodes paths are relative to the
 // root path given here, which is prepended for any operations.
 func NewFileManager(ds ds.Batching, root string) *FileManager {
-	return &FileManager{ds: dsns.Wrap(ds, FilestorePrefix), root: root}
+	return &FileManager{
+		URLRetries: DefaultURLRetries,
+		ds:         dsns.Wrap(ds, FilestorePrefix),
+		root:       root,
+	}
 }
 
 // AllKeysChan returns a channel from which to read the keys stored in
@@ -105,6 +127,161 @@ func (f *FileManager) DeleteBlock(c cid.Cid) error {
 	return err
 }
 
+// RefPath returns the path of the given file or URL as it is stored in the
+// references: relative to the root for files. It fails for the root itself
+// and the files outside of it.
+func (f *FileManager) RefPath(p string) (string, error) {
+	if IsURL(p) {
+		return strings.TrimSuffix(p, "/"), nil
+	}
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("%s is not an absolute path", p)
+	}
+	rel, err := filepath.Rel(f.root, p)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", fmt.Errorf("%s is the ipfs root", p)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside ipfs root (%s)", p, f.root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// underPath returns whether the stored path refPath is p, or a path under
+// the directory p.
+func underPath(refPath, p string) bool {
+	return refPath == p || strings.HasPrefix(refPath, p+"/")
+}
+
+// references returns the keys and references of the blocks whose backing
+// file is p, or is under the directory p, as returned by RefPath.
+func (f *FileManager) references(p string) ([]ds.Key, []*pb.DataObj, error) {
+	res, err := f.ds.Query(dsq.Query{})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Close()
+
+	var keys []ds.Key
+	var dobjs []*pb.DataObj
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, nil, r.Error
+		}
+		dobj, err := unmarshalDataObj(r.Value)
+		if err != nil {
+			log.Errorf("decoding filestore reference %s: %s", r.Key, err)
+			continue
+		}
+		if underPath(dobj.GetFilePath(), p) {
+			keys = append(keys, ds.RawKey(r.Key))
+			dobjs = append(dobjs, dobj)
+		}
+	}
+	return keys, dobjs, nil
+}
+
+// PathRefs returns the cids of the blocks backed by the given file, or by
+// the files under the given directory. The path is an absolute path or a URL.
+func (f *FileManager) PathRefs(p string) ([]cid.Cid, error) {
+	p, err := f.RefPath(p)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := f.references(p)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]cid.Cid, 0, len(keys))
+	for _, k := range keys {
+		c, err := dshelp.DsKeyToCid(k)
+		if err != nil {
+			log.Errorf("decoding cid from filestore: %s", err)
+			continue
+		}
+		refs = append(refs, c)
+	}
+	return refs, nil
+}
+
+// RemovePath removes the references to the blocks backed by the given file,
+// or by the files under the given directory, and returns their cids. The
+// path is an absolute path or a URL. The referenced data is not touched, and
+// the pins are not checked: see PathRefs.
+func (f *FileManager) RemovePath(p string) ([]cid.Cid, error) {
+	p, err := f.RefPath(p)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := f.references(p)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := f.ds.Batch()
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]cid.Cid, 0, len(keys))
+	for _, k := range keys {
+		c, err := dshelp.DsKeyToCid(k)
+		if err != nil {
+			log.Errorf("decoding cid from filestore: %s", err)
+		} else {
+			removed = append(removed, c)
+		}
+		if err := batch.Delete(k); err != nil {
+			return nil, err
+		}
+	}
+	return removed, batch.Commit()
+}
+
+// MovePath rewrites the references to the blocks backed by the file
+// oldPath, or by the files under the directory oldPath, so that they point
+// to the same data under newPath, after the files were moved. It returns the
+// number of rewritten references. The paths are absolute paths or URLs, and
+// neither file is checked: use Verify afterwards.
+func (f *FileManager) MovePath(oldPath, newPath string) (int, error) {
+	if IsURL(oldPath) != IsURL(newPath) {
+		return 0, fmt.Errorf("cannot move references between files and URLs")
+	}
+	oldPath, err := f.RefPath(oldPath)
+	if err != nil {
+		return 0, err
+	}
+	newPath, err = f.RefPath(newPath)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, dobjs, err := f.references(oldPath)
+	if err != nil {
+		return 0, err
+	}
+
+	batch, err := f.ds.Batch()
+	if err != nil {
+		return 0, err
+	}
+	for i, dobj := range dobjs {
+		dobj.FilePath = newPath + strings.TrimPrefix(dobj.FilePath, oldPath)
+
+		data, err := proto.Marshal(dobj)
+		if err != nil {
+			return 0, err
+		}
+		if err := batch.Put(keys[i], data); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), batch.Commit()
+}
+
 // Get reads a block from the datastore. Reading a block
 // is done in two steps: the first step retrieves the reference
 // block from the datastore. The second step uses the stored
@@ -164,6 +341,48 @@ func unmarshalDataObj(data []byte) (*pb.DataObj, error) {
 	return &dobj, nil
 }
 
+// statDataObj checks the backing file of the given reference without reading
+// it: the file must exist, be large enough to hold the block, and have the
+// size and modification time recorded when the block was added, if any.
+// URLs are only checked to exist and, when the server tells their length, to
+// be large enough.
+func (f *FileManager) statDataObj(c cid.Cid, d *pb.DataObj, stat func(string) (os.FileInfo, error), urlLength func(string) (int64, error)) error {
+	if IsURL(d.GetFilePath()) {
+		length, err := urlLength(d.GetFilePath())
+		if err != nil {
+			return err
+		}
+		if length >= 0 && uint64(length) < d.GetOffset()+d.GetSize_() {
+			return &CorruptReferenceError{StatusFileChanged,
+				fmt.Errorf("content too short to hold the block. %s offset %d", d.GetFilePath(), d.GetOffset())}
+		}
+		return nil
+	}
+	if !f.AllowFiles {
+		return ErrFilestoreNotEnabled
+	}
+
+	abspath := filepath.Join(f.root, filepath.FromSlash(d.GetFilePath()))
+	fi, err := stat(abspath)
+	if os.IsNotExist(err) {
+		return &CorruptReferenceError{StatusFileNotFound, err}
+	} else if err != nil {
+		return &CorruptReferenceError{StatusFileError, err}
+	}
+
+	if uint64(fi.Size()) < d.GetOffset()+d.GetSize_() {
+		return &CorruptReferenceError{StatusFileChanged,
+			fmt.Errorf("file too short to hold the block. %s offset %d", d.GetFilePath(), d.GetOffset())}
+	}
+	// the modification time is not recorded for the blocks added before
+	// it was
+	if d.GetModTime() != 0 && (uint64(fi.Size()) != d.GetFileSize() || fi.ModTime().UnixNano() != d.GetModTime()) {
+		return &CorruptReferenceError{StatusFileChanged,
+			fmt.Errorf("file size or modification time changed. %s offset %d", d.GetFilePath(), d.GetOffset())}
+	}
+	return nil
+}
+
 func (f *FileManager) readFileDataObj(c cid.Cid, d *pb.DataObj) ([]byte, error) {
 	if !f.AllowFiles {
 		return nil, ErrFilestoreNotEnabled
@@ -206,50 +425,6 @@ func (f *FileManager) readFileDataObj(c cid.Cid, d *pb.DataObj) ([]byte, error)
 	return outbuf, nil
 }
 
-// reads and verifies the block from URL
-func (f *FileManager) readURLDataObj(c cid.Cid, d *pb.DataObj) ([]byte, error) {
-	if !f.AllowUrls {
-		return nil, ErrUrlstoreNotEnabled
-	}
-
-	req, err := http.NewRequest("GET", d.GetFilePath(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", d.GetOffset(), d.GetOffset()+d.GetSize_()-1))
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, &CorruptReferenceError{StatusFileError, err}
-	}
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
-		return nil, &CorruptReferenceError{StatusFileError,
-			fmt.Errorf("expected HTTP 200 or 206 got %d", res.StatusCode)}
-	}
-
-	outbuf := make([]byte, d.GetSize_())
-	_, err = io.ReadFull(res.Body, outbuf)
-	if err == io.EOF || err == io.ErrUnexpectedEOF {
-		return nil, &CorruptReferenceError{StatusFileChanged, err}
-	} else if err != nil {
-		return nil, &CorruptReferenceError{StatusFileError, err}
-	}
-	res.Body.Close()
-
-	outcid, err := c.Prefix().Sum(outbuf)
-	if err != nil {
-		return nil, err
-	}
-
-	if !c.Equals(outcid) {
-		return nil, &CorruptReferenceError{StatusFileChanged,
-			fmt.Errorf("data in file did not match. %s offset %d", d.GetFilePath(), d.GetOffset())}
-	}
-
-	return outbuf, nil
-}
-
 // Has returns if the FileManager is storing a block reference. It does not
 // validate the data, nor checks if the reference is valid.
 func (f *FileManager) Has(c cid.Cid) (bool, error) {
@@ -291,6 +466,18 @@ func (f *FileManager) putTo(b *posinfo.FilestoreNode, to putter) error {
 		}
 
 		dobj.FilePath = filepath.ToSlash(p)
+
+		// recorded to detect changes of the file without reading it, see
+		// VerifyQuick
+		st := b.PosInfo.Stat
+		if st == nil {
+			// files sent over HTTP are not stat'ed by the client
+			st = f.statFile(b.PosInfo.FullPath, b.PosInfo.Offset)
+		}
+		if st != nil {
+			dobj.FileSize = uint64(st.Size())
+			dobj.ModTime = st.ModTime().UnixNano()
+		}
 	}
 	dobj.Offset = b.PosInfo.Offset
 	dobj.Size_ = uint64(len(b.RawData()))
@@ -303,6 +490,27 @@ func (f *FileManager) putTo(b *posinfo.FilestoreNode, to putter) error {
 	return to.Put(dshelp.CidToDsKey(b.Cid()), data)
 }
 
+// statFile returns the information of the file at the given path, nil if it
+// cannot be stat'ed. The blocks of a file are put in order, so the file is
+// only stat'ed again at its first block.
+func (f *FileManager) statFile(path string, offset uint64) os.FileInfo {
+	f.statLk.Lock()
+	defer f.statLk.Unlock()
+
+	if offset != 0 && path == f.statPath {
+		return f.statInfo
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		log.Warningf("cannot stat %s: %s", path, err)
+		st = nil
+	}
+	f.statPath = path
+	f.statInfo = st
+	return st
+}
+
 // PutMany is like Put() but takes a slice of blocks instead,
 // allowing it to create a batch transaction.
 func (f *FileManager) PutMany(bs []*posinfo.FilestoreNode) error {
@@ -24,6 +24,8 @@ type DataObj struct {
 	FilePath             string   `protobuf:"bytes,1,opt,name=FilePath" json:"FilePath"`
 	Offset               uint64   `protobuf:"varint,2,opt,name=Offset" json:"Offset"`
 	Size_                uint64   `protobuf:"varint,3,opt,name=Size" json:"Size"`
+	FileSize             uint64   `protobuf:"varint,4,opt,name=FileSize" json:"FileSize"`
+	ModTime              int64    `protobuf:"varint,5,opt,name=ModTime" json:"ModTime"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
@@ -32,7 +34,7 @@ func (m *DataObj) Reset()         { *m = DataObj{} }
 func (m *DataObj) String() string { return proto.CompactTextString(m) }
 func (*DataObj) ProtoMessage()    {}
 func (*DataObj) Descriptor() ([]byte, []int) {
-	return fileDescriptor_dataobj_216c555249812eeb, []int{0}
+	return fileDescriptor_dataobj_623214158ae3cd7f, []int{0}
 }
 func (m *DataObj) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -82,6 +84,20 @@ func (m *DataObj) GetSize_() uint64 {
 	return 0
 }
 
+func (m *DataObj) GetFileSize() uint64 {
+	if m != nil {
+		return m.FileSize
+	}
+	return 0
+}
+
+func (m *DataObj) GetModTime() int64 {
+	if m != nil {
+		return m.ModTime
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*DataObj)(nil), "datastore.pb.DataObj")
 }
@@ -110,6 +126,12 @@ func (m *DataObj) MarshalTo(dAtA []byte) (int, error) {
 	dAtA[i] = 0x18
 	i++
 	i = encodeVarintDataobj(dAtA, i, uint64(m.Size_))
+	dAtA[i] = 0x20
+	i++
+	i = encodeVarintDataobj(dAtA, i, uint64(m.FileSize))
+	dAtA[i] = 0x28
+	i++
+	i = encodeVarintDataobj(dAtA, i, uint64(m.ModTime))
 	return i, nil
 }
 
@@ -129,6 +151,8 @@ func (m *DataObj) Size() (n int) {
 	n += 1 + l + sovDataobj(uint64(l))
 	n += 1 + sovDataobj(uint64(m.Offset))
 	n += 1 + sovDataobj(uint64(m.Size_))
+	n += 1 + sovDataobj(uint64(m.FileSize))
+	n += 1 + sovDataobj(uint64(m.ModTime))
 	return n
 }
 
@@ -241,6 +265,44 @@ func (m *DataObj) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FileSize", wireType)
+			}
+			m.FileSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDataobj
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FileSize |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ModTime", wireType)
+			}
+			m.ModTime = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDataobj
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ModTime |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDataobj(dAtA[iNdEx:])
@@ -367,18 +429,19 @@ var (
 	ErrIntOverflowDataobj   = fmt.Errorf("proto: integer overflow")
 )
 
-func init() { proto.RegisterFile("filestore/pb/dataobj.proto", fileDescriptor_dataobj_216c555249812eeb) }
+func init() { proto.RegisterFile("filestore/pb/dataobj.proto", fileDescriptor_dataobj_623214158ae3cd7f) }
 
-var fileDescriptor_dataobj_216c555249812eeb = []byte{
-	// 151 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x92, 0x4a, 0xcb, 0xcc, 0x49,
+var fileDescriptor_dataobj_623214158ae3cd7f = []byte{
+	// 170 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe3, 0x92, 0x4a, 0xcb, 0xcc, 0x49,
 	0x2d, 0x2e, 0xc9, 0x2f, 0x4a, 0xd5, 0x2f, 0x48, 0xd2, 0x4f, 0x49, 0x2c, 0x49, 0xcc, 0x4f, 0xca,
 	0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x01, 0x71, 0xc1, 0x72, 0x7a, 0x05, 0x49, 0x4a,
-	0xc9, 0x5c, 0xec, 0x2e, 0x89, 0x25, 0x89, 0xfe, 0x49, 0x59, 0x42, 0x0a, 0x5c, 0x1c, 0x6e, 0x99,
-	0x39, 0xa9, 0x01, 0x89, 0x25, 0x19, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x4e, 0x2c, 0x27, 0xee,
-	0xc9, 0x33, 0x04, 0xc1, 0x45, 0x85, 0x64, 0xb8, 0xd8, 0xfc, 0xd3, 0xd2, 0x8a, 0x53, 0x4b, 0x24,
-	0x98, 0x14, 0x18, 0x35, 0x58, 0xa0, 0xf2, 0x50, 0x31, 0x21, 0x09, 0x2e, 0x96, 0xe0, 0xcc, 0xaa,
-	0x54, 0x09, 0x66, 0x24, 0x39, 0xb0, 0x88, 0x93, 0xc0, 0x89, 0x47, 0x72, 0x8c, 0x17, 0x1e, 0xc9,
-	0x31, 0x3e, 0x78, 0x24, 0xc7, 0x38, 0xe1, 0xb1, 0x1c, 0x03, 0x20, 0x00, 0x00, 0xff, 0xff, 0x8c,
-	0xe7, 0x83, 0xa2, 0xa1, 0x00, 0x00, 0x00,
+	0x4b, 0x19, 0xb9, 0xd8, 0x5d, 0x80, 0x02, 0xfe, 0x49, 0x59, 0x42, 0x0a, 0x5c, 0x1c, 0x6e, 0x40,
+	0x7d, 0x01, 0x89, 0x25, 0x19, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x4e, 0x2c, 0x27, 0xee, 0xc9,
+	0x33, 0x04, 0xc1, 0x45, 0x85, 0x64, 0xb8, 0xd8, 0xfc, 0xd3, 0xd2, 0x8a, 0x53, 0x4b, 0x24, 0x98,
+	0x80, 0xf2, 0x2c, 0x50, 0x79, 0xa8, 0x98, 0x90, 0x04, 0x17, 0x4b, 0x70, 0x66, 0x55, 0xaa, 0x04,
+	0x33, 0x92, 0x1c, 0x58, 0x04, 0x66, 0x32, 0x58, 0x96, 0x05, 0x49, 0x16, 0x2e, 0x2a, 0x24, 0xc7,
+	0xc5, 0xee, 0x9b, 0x9f, 0x12, 0x92, 0x99, 0x9b, 0x2a, 0xc1, 0x0a, 0x54, 0xc0, 0x0c, 0x55, 0x00,
+	0x13, 0x74, 0x12, 0x38, 0xf1, 0x48, 0x8e, 0xf1, 0x02, 0x10, 0x3f, 0x00, 0xe2, 0x09, 0x8f, 0xe5,
+	0x18, 0x00, 0x80, 0x1a, 0x1c, 0x18, 0xe4, 0x00, 0x00, 0x00,
 }
@@ -0,0 +1,260 @@
+package filestore
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/filestore/pb"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// DefaultURLRetries is the number of times a failed request to a URL is
+// retried, unless FileManager.URLRetries is changed.
+const DefaultURLRetries = 3
+
+// urlRetryDelay is the delay before the first retry of a request to a URL,
+// doubled after each retry.
+var urlRetryDelay = 500 * time.Millisecond
+
+// DoURLRequest sends the given request, along with the headers configured
+// for its host in URLHeaders. Requests which fail with a network error, a
+// server error or a 429 status are retried up to URLRetries times, with an
+// increasing delay. The request must not have a body.
+func (f *FileManager) DoURLRequest(req *http.Request) (*http.Response, error) {
+	for k, v := range f.urlHeaders(req.URL) {
+		req.Header[k] = v
+	}
+
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	delay := urlRetryDelay
+	for attempt := 0; ; attempt++ {
+		res, err := client.Do(req)
+		if err == nil && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			return res, nil
+		}
+		if attempt >= f.URLRetries {
+			return res, err
+		}
+
+		if err != nil {
+			log.Debugf("request to %s failed, retrying: %s", req.URL, err)
+		} else {
+			log.Debugf("request to %s failed with HTTP %d, retrying", req.URL, res.StatusCode)
+			res.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+	}
+}
+
+// urlHeaders returns the headers configured for the host of the given URL,
+// with or without its port.
+func (f *FileManager) urlHeaders(u *url.URL) http.Header {
+	if h, ok := f.URLHeaders[u.Host]; ok {
+		return h
+	}
+	return f.URLHeaders[u.Hostname()]
+}
+
+// urlStatusError returns the error of a response with an unexpected status.
+func urlStatusError(res *http.Response, expected string) error {
+	err := fmt.Errorf("expected HTTP %s got %d", expected, res.StatusCode)
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return &CorruptReferenceError{StatusFileNotFound, err}
+	}
+	return &CorruptReferenceError{StatusFileError, err}
+}
+
+// reads and verifies the block from URL
+func (f *FileManager) readURLDataObj(c cid.Cid, d *pb.DataObj) ([]byte, error) {
+	if !f.AllowUrls {
+		return nil, ErrUrlstoreNotEnabled
+	}
+
+	req, err := http.NewRequest("GET", d.GetFilePath(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", d.GetOffset(), d.GetOffset()+d.GetSize_()-1))
+
+	res, err := f.DoURLRequest(req)
+	if err != nil {
+		return nil, &CorruptReferenceError{StatusFileError, err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		return nil, urlStatusError(res, "200 or 206")
+	}
+
+	outbuf := make([]byte, d.GetSize_())
+	_, err = io.ReadFull(res.Body, outbuf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, &CorruptReferenceError{StatusFileChanged, err}
+	} else if err != nil {
+		return nil, &CorruptReferenceError{StatusFileError, err}
+	}
+
+	outcid, err := c.Prefix().Sum(outbuf)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.Equals(outcid) {
+		return nil, &CorruptReferenceError{StatusFileChanged,
+			fmt.Errorf("data in file did not match. %s offset %d", d.GetFilePath(), d.GetOffset())}
+	}
+
+	return outbuf, nil
+}
+
+// urlLength returns the length of the content at the given URL, or -1 when
+// the server does not tell. It sends a HEAD request, or a request for the
+// first byte to the servers which do not support them.
+func (f *FileManager) urlLength(u string) (int64, error) {
+	if !f.AllowUrls {
+		return -1, ErrUrlstoreNotEnabled
+	}
+
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return -1, err
+	}
+	res, err := f.DoURLRequest(req)
+	if err != nil {
+		return -1, &CorruptReferenceError{StatusFileError, err}
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return res.ContentLength, nil
+	}
+	if res.StatusCode != http.StatusMethodNotAllowed && res.StatusCode != http.StatusNotImplemented {
+		return -1, urlStatusError(res, "200")
+	}
+
+	req, err = http.NewRequest("GET", u, nil)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Add("Range", "bytes=0-0")
+	res, err = f.DoURLRequest(req)
+	if err != nil {
+		return -1, &CorruptReferenceError{StatusFileError, err}
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.ContentLength, nil
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/<length>
+		cr := res.Header.Get("Content-Range")
+		i := strings.LastIndex(cr, "/")
+		if i < 0 {
+			return -1, nil
+		}
+		length, err := strconv.ParseInt(cr[i+1:], 10, 64)
+		if err != nil {
+			return -1, nil
+		}
+		return length, nil
+	default:
+		return -1, urlStatusError(res, "200 or 206")
+	}
+}
+
+// URLEntry is an entry of a directory listing served over HTTP.
+type URLEntry struct {
+	Name string
+	URL  string
+	Dir  bool
+}
+
+// maxListingSize bounds the size of the directory listings read by
+// ListURLDirectory.
+const maxListingSize = 16 << 20
+
+// hrefRegexp matches the links of a directory listing, ignoring the ones
+// with a query or a fragment, such as the sorting links.
+var hrefRegexp = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#?]+)["']`)
+
+// ListURLDirectory returns the entries of the HTML directory listing, as
+// served by most web servers for directories, at the given URL. Only the
+// links to the direct children of the directory are returned, the ones
+// ending with a slash being directories.
+func (f *FileManager) ListURLDirectory(u string) ([]URLEntry, error) {
+	if !f.AllowUrls {
+		return nil, ErrUrlstoreNotEnabled
+	}
+
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	// the links are relative to the directory
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	req, err := http.NewRequest("GET", base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.DoURLRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("expected HTTP 200 got %d", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		return nil, fmt.Errorf("%s is not a directory listing", u)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxListingSize))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var entries []URLEntry
+	for _, m := range hrefRegexp.FindAllSubmatch(body, -1) {
+		ref, err := url.Parse(html.UnescapeString(string(m[1])))
+		if err != nil {
+			continue
+		}
+		link := base.ResolveReference(ref)
+		if link.Scheme != base.Scheme || link.Host != base.Host || !strings.HasPrefix(link.Path, base.Path) {
+			continue
+		}
+
+		rel := strings.TrimPrefix(link.Path, base.Path)
+		name := strings.TrimSuffix(rel, "/")
+		if name == "" || strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, URLEntry{
+			Name: name,
+			URL:  link.String(),
+			Dir:  strings.HasSuffix(rel, "/"),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,243 @@
+package filestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	posinfo "gx/ipfs/QmR6YMs8EkXQLXNwQKxLnQp2VBZSepoEJ8KCZAyanJHhJu/go-ipfs-posinfo"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// testURLServer serves data, which can be changed, to the requests with
+// the expected token, after failing the given number of requests.
+type testURLServer struct {
+	lk       sync.Mutex
+	data     []byte
+	failures int
+	requests int
+}
+
+func (s *testURLServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.requests++
+	if s.failures > 0 {
+		s.failures--
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(s.data))
+}
+
+func (s *testURLServer) set(data []byte, failures int) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.data = data
+	s.failures = failures
+}
+
+func newTestURLFilestore(t *testing.T, ts *httptest.Server) (string, *Filestore) {
+	dir, fs := newTestFilestore(t)
+	fm := fs.FileManager()
+	fm.AllowUrls = true
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.URLHeaders = map[string]http.Header{
+		u.Hostname(): {"Authorization": {"Bearer secret"}},
+	}
+	return dir, fs
+}
+
+func addURLBlocks(t *testing.T, fs *Filestore, u string, buf []byte) []cid.Cid {
+	var cids []cid.Cid
+	for i := 0; i < len(buf)/10; i++ {
+		n := &posinfo.FilestoreNode{
+			PosInfo: &posinfo.PosInfo{
+				FullPath: u,
+				Offset:   uint64(i * 10),
+			},
+			Node: dag.NewRawNode(buf[i*10 : (i+1)*10]),
+		}
+		if err := fs.Put(n); err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, n.Cid())
+	}
+	return cids
+}
+
+func TestURLRetriesAndHeaders(t *testing.T) {
+	defer func(d time.Duration) { urlRetryDelay = d }(urlRetryDelay)
+	urlRetryDelay = time.Millisecond
+
+	srv := new(testURLServer)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	_, fs := newTestURLFilestore(t, ts)
+
+	buf := make([]byte, 100)
+	rand.Read(buf)
+	cids := addURLBlocks(t, fs, ts.URL+"/file", buf)
+
+	srv.set(buf, DefaultURLRetries)
+	blk, err := fs.Get(cids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(blk.RawData(), buf[10:20]) {
+		t.Fatal("data didnt match on the way out")
+	}
+	if srv.requests != DefaultURLRetries+1 {
+		t.Fatalf("expected %d requests, got %d", DefaultURLRetries+1, srv.requests)
+	}
+
+	// one failure too many
+	srv.set(buf, DefaultURLRetries+1)
+	if r := Verify(fs, cids[1]); r.Status != StatusFileError {
+		t.Fatalf("expected an error, got %s", r.Status)
+	}
+
+	// without the configured headers
+	srv.set(buf, 0)
+	fs.FileManager().URLHeaders = nil
+	if r := Verify(fs, cids[1]); r.Status != StatusFileError {
+		t.Fatalf("expected an error, got %s", r.Status)
+	}
+}
+
+func TestVerifyURLs(t *testing.T) {
+	srv := new(testURLServer)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	dir, fs := newTestURLFilestore(t, ts)
+	fs.FileManager().URLRetries = 0
+
+	buf := make([]byte, 100)
+	rand.Read(buf)
+	cids := addURLBlocks(t, fs, ts.URL+"/file", buf)
+	srv.set(buf, 0)
+
+	// the blocks backed by files are not listed
+	randomFileAdd(t, fs, dir, 20)
+
+	verifyAll := func(quick bool) map[Status]int {
+		next, err := VerifyAllURLs(fs, true, quick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses := make(map[Status]int)
+		for r := next(); r != nil; r = next() {
+			if !IsURL(r.FilePath) {
+				t.Fatalf("unexpected entry %s", r.FilePath)
+			}
+			statuses[r.Status]++
+		}
+		return statuses
+	}
+
+	if s := verifyAll(false); s[StatusOk] != len(cids) {
+		t.Fatalf("expected all the blocks to be ok, got %v", s)
+	}
+	if s := verifyAll(true); s[StatusOk] != len(cids) {
+		t.Fatalf("expected all the blocks to be ok, got %v", s)
+	}
+
+	// the content is too short for the last blocks
+	srv.set(buf[:55], 0)
+	if s := verifyAll(true); s[StatusOk] != 5 || s[StatusFileChanged] != 5 {
+		t.Fatalf("expected 5 ok and 5 changed blocks, got %v", s)
+	}
+
+	srv.set(nil, 0)
+	if s := verifyAll(true); s[StatusFileNotFound] != len(cids) {
+		t.Fatalf("expected all the blocks to be missing, got %v", s)
+	}
+	if s := verifyAll(false); s[StatusFileNotFound] != len(cids) {
+		t.Fatalf("expected all the blocks to be missing, got %v", s)
+	}
+
+	removed, err := fs.FileManager().RemovePath(ts.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != len(cids) {
+		t.Fatalf("expected %d references to be removed, got %d", len(cids), len(removed))
+	}
+	next, err := ListAllURLs(fs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r != nil {
+		t.Fatalf("expected no URL to be left, got %v", r)
+	}
+}
+
+func TestListURLDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urlstore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a.txt", "b c.txt", "sub/d.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, p), []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+	_, fs := newTestFilestore(t)
+	fm := fs.FileManager()
+	fm.AllowUrls = true
+
+	entries, err := fm.ListURLDirectory(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	expected := []URLEntry{
+		{Name: "a.txt", URL: ts.URL + "/a.txt"},
+		{Name: "b c.txt", URL: ts.URL + "/b%20c.txt"},
+		{Name: "sub", URL: ts.URL + "/sub/", Dir: true},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, entries)
+	}
+	for i, e := range entries {
+		if e != expected[i] {
+			t.Fatalf("expected %v, got %v", expected[i], e)
+		}
+	}
+
+	if _, err := fm.ListURLDirectory(ts.URL + "/a.txt"); err == nil {
+		t.Fatal("expected a file not to be a directory listing")
+	}
+}
@@ -2,6 +2,7 @@ package filestore
 
 import (
 	"fmt"
+	"os"
 	"sort"
 
 	pb "github.com/ipfs/go-ipfs/filestore/pb"
@@ -83,7 +84,7 @@ func (r *ListRes) FormatLong() string {
 // List does not verify that the reference is valid or whether the
 // raw data is accesible. See Verify().
 func List(fs *Filestore, key cid.Cid) *ListRes {
-	return list(fs, false, key)
+	return list(fs, verifyNone, key)
 }
 
 // ListAll returns a function as an iterator which, once invoked, returns
@@ -92,9 +93,9 @@ func List(fs *Filestore, key cid.Cid) *ListRes {
 // the raw data is accessible. See VerifyAll().
 func ListAll(fs *Filestore, fileOrder bool) (func() *ListRes, error) {
 	if fileOrder {
-		return listAllFileOrder(fs, false)
+		return listAllFileOrder(fs, verifyNone, nil)
 	}
-	return listAll(fs, false)
+	return listAll(fs, verifyNone, nil)
 }
 
 // Verify fetches the block with the given key from the Filemanager
@@ -102,7 +103,7 @@ func ListAll(fs *Filestore, fileOrder bool) (func() *ListRes, error) {
 // Verify makes sure that the reference is valid and the block data can be
 // read.
 func Verify(fs *Filestore, key cid.Cid) *ListRes {
-	return list(fs, true, key)
+	return list(fs, verifyFull, key)
 }
 
 // VerifyAll returns a function as an iterator which, once invoked,
@@ -111,35 +112,127 @@ func Verify(fs *Filestore, key cid.Cid) *ListRes {
 // can be read.
 func VerifyAll(fs *Filestore, fileOrder bool) (func() *ListRes, error) {
 	if fileOrder {
-		return listAllFileOrder(fs, true)
+		return listAllFileOrder(fs, verifyFull, nil)
 	}
-	return listAll(fs, true)
+	return listAll(fs, verifyFull, nil)
 }
 
-func list(fs *Filestore, verify bool, key cid.Cid) *ListRes {
+// VerifyQuick is like Verify, but it does not read the block data. It only
+// checks that the backing file exists and that its size and modification
+// time are the ones recorded when the block was added. The blocks added
+// before those were recorded are only checked to fit in the file. URLs are
+// checked with a HEAD request.
+func VerifyQuick(fs *Filestore, key cid.Cid) *ListRes {
+	return list(fs, verifyQuick, key)
+}
+
+// VerifyAllQuick is like VerifyAll, but checks the blocks like VerifyQuick.
+func VerifyAllQuick(fs *Filestore, fileOrder bool) (func() *ListRes, error) {
+	if fileOrder {
+		return listAllFileOrder(fs, verifyQuick, nil)
+	}
+	return listAll(fs, verifyQuick, nil)
+}
+
+// ListAllURLs is like ListAll, but only returns the blocks backed by URLs,
+// added with the urlstore.
+func ListAllURLs(fs *Filestore, fileOrder bool) (func() *ListRes, error) {
+	if fileOrder {
+		return listAllFileOrder(fs, verifyNone, IsURL)
+	}
+	return listAll(fs, verifyNone, IsURL)
+}
+
+// VerifyAllURLs is like VerifyAll, but only returns the blocks backed by
+// URLs. With quick, the blocks are checked like VerifyQuick does.
+func VerifyAllURLs(fs *Filestore, fileOrder, quick bool) (func() *ListRes, error) {
+	level := verifyFull
+	if quick {
+		level = verifyQuick
+	}
+	if fileOrder {
+		return listAllFileOrder(fs, level, IsURL)
+	}
+	return listAll(fs, level, IsURL)
+}
+
+// verifyLevel is how thoroughly the list functions check the references.
+type verifyLevel int
+
+const (
+	verifyNone verifyLevel = iota
+	verifyQuick
+	verifyFull
+)
+
+// checker returns the function checking references at the given level.
+func checker(fs *Filestore, level verifyLevel) func(cid.Cid, *pb.DataObj) error {
+	switch level {
+	case verifyFull:
+		return func(c cid.Cid, d *pb.DataObj) error {
+			_, err := fs.fm.readDataObj(c, d)
+			return err
+		}
+	case verifyQuick:
+		// the blocks of a file are mostly checked one after the other, so
+		// the last file is only stat'ed once
+		var lastPath string
+		var lastInfo os.FileInfo
+		var lastErr error
+		stat := func(p string) (os.FileInfo, error) {
+			if p != lastPath {
+				lastPath = p
+				lastInfo, lastErr = os.Stat(p)
+			}
+			return lastInfo, lastErr
+		}
+		var lastURL string
+		var lastLength int64
+		var lastURLErr error
+		urlLength := func(u string) (int64, error) {
+			if u != lastURL {
+				lastURL = u
+				lastLength, lastURLErr = fs.fm.urlLength(u)
+			}
+			return lastLength, lastURLErr
+		}
+		return func(c cid.Cid, d *pb.DataObj) error {
+			return fs.fm.statDataObj(c, d, stat, urlLength)
+		}
+	default:
+		return func(cid.Cid, *pb.DataObj) error {
+			return nil
+		}
+	}
+}
+
+func list(fs *Filestore, level verifyLevel, key cid.Cid) *ListRes {
 	dobj, err := fs.fm.getDataObj(key)
 	if err != nil {
 		return mkListRes(key, nil, err)
 	}
-	if verify {
-		_, err = fs.fm.readDataObj(key, dobj)
-	}
-	return mkListRes(key, dobj, err)
+	return mkListRes(key, dobj, checker(fs, level)(key, dobj))
 }
 
-func listAll(fs *Filestore, verify bool) (func() *ListRes, error) {
+// listAll lists the references in the order of their keys. When filter is
+// not nil, only the references to the paths it accepts are listed.
+func listAll(fs *Filestore, level verifyLevel, filter func(string) bool) (func() *ListRes, error) {
 	q := dsq.Query{}
 	qr, err := fs.fm.ds.Query(q)
 	if err != nil {
 		return nil, err
 	}
 
+	check := checker(fs, level)
 	return func() *ListRes {
 		cid, dobj, err := next(qr)
+		for filter != nil && dobj != nil && !filter(dobj.GetFilePath()) {
+			cid, dobj, err = next(qr)
+		}
 		if dobj == nil && err == nil {
 			return nil
-		} else if err == nil && verify {
-			_, err = fs.fm.readDataObj(cid, dobj)
+		} else if err == nil {
+			err = check(cid, dobj)
 		}
 		return mkListRes(cid, dobj, err)
 	}, nil
@@ -165,7 +258,7 @@ func next(qr dsq.Results) (cid.Cid, *pb.DataObj, error) {
 	return c, dobj, nil
 }
 
-func listAllFileOrder(fs *Filestore, verify bool) (func() *ListRes, error) {
+func listAllFileOrder(fs *Filestore, level verifyLevel, filter func(string) bool) (func() *ListRes, error) {
 	q := dsq.Query{}
 	qr, err := fs.fm.ds.Query(q)
 	if err != nil {
@@ -185,17 +278,20 @@ func listAllFileOrder(fs *Filestore, verify bool) (func() *ListRes, error) {
 				dsKey: v.Key,
 				err:   err,
 			})
-		} else {
+		} else if filter == nil || filter(dobj.GetFilePath()) {
 			entries = append(entries, &listEntry{
 				dsKey:    v.Key,
 				filePath: dobj.GetFilePath(),
 				offset:   dobj.GetOffset(),
 				size:     dobj.GetSize_(),
+				fileSize: dobj.GetFileSize(),
+				modTime:  dobj.GetModTime(),
 			})
 		}
 	}
 	sort.Sort(entries)
 
+	check := checker(fs, level)
 	i := 0
 	return func() *ListRes {
 		if i >= len(entries) {
@@ -215,6 +311,8 @@ func listAllFileOrder(fs *Filestore, verify bool) (func() *ListRes, error) {
 			FilePath: v.filePath,
 			Offset:   v.offset,
 			Size_:    v.size,
+			FileSize: v.fileSize,
+			ModTime:  v.modTime,
 		}
 		// now if we could not convert the datastore key return that
 		// error
@@ -222,11 +320,7 @@ func listAllFileOrder(fs *Filestore, verify bool) (func() *ListRes, error) {
 			return mkListRes(cid, &dobj, keyErr)
 		}
 		// finally verify the dataobj if requested
-		var err error
-		if verify {
-			_, err = fs.fm.readDataObj(cid, &dobj)
-		}
-		return mkListRes(cid, &dobj, err)
+		return mkListRes(cid, &dobj, check(cid, &dobj))
 	}, nil
 }
 
@@ -235,6 +329,8 @@ type listEntry struct {
 	offset   uint64
 	dsKey    string
 	size     uint64
+	fileSize uint64
+	modTime  int64
 	err      error
 }
 
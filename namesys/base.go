@@ -8,12 +8,16 @@ import (
 	opts "github.com/ipfs/go-ipfs/namesys/opts"
 
 	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+	pb "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns/pb"
 )
 
 type onceResult struct {
 	value path.Path
 	ttl   time.Duration
 	err   error
+
+	// record is the IPNS record the value was resolved from, if any
+	record *pb.IpnsEntry
 }
 
 type resolver interface {
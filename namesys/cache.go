@@ -1,47 +1,297 @@
 package namesys
 
 import (
+	"encoding/json"
+	"sort"
 	"time"
 
 	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+
+	ipns "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns"
+	pb "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns/pb"
+	proto "gx/ipfs/QmdxUuburamoF6zF9qjeQC4WYcWGbWuRmdLacMEsW8ioD8/gogo-protobuf/proto"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
 )
 
-func (ns *mpns) cacheGet(name string) (path.Path, bool) {
+// cacheGet returns the cached value of the given name, looking in the
+// memory cache first, then in the persistent cache. Stale values, only
+// returned by the persistent cache, should be resolved again.
+func (ns *mpns) cacheGet(name string) (val path.Path, stale bool, ok bool) {
 	if ns.cache == nil {
-		return "", false
+		return "", false, false
 	}
 
-	ientry, ok := ns.cache.Get(name)
-	if !ok {
-		return "", false
-	}
+	if ientry, ok := ns.cache.Get(name); ok {
+		entry, ok := ientry.(cacheEntry)
+		if !ok {
+			// should never happen, purely for sanity
+			log.Panicf("unexpected type %T in cache for %q.", ientry, name)
+		}
 
-	entry, ok := ientry.(cacheEntry)
-	if !ok {
-		// should never happen, purely for sanity
-		log.Panicf("unexpected type %T in cache for %q.", ientry, name)
-	}
+		if time.Now().Before(entry.eol) {
+			return entry.val, false, true
+		}
 
-	if time.Now().Before(entry.eol) {
-		return entry.val, true
+		ns.cache.Remove(name)
 	}
 
-	ns.cache.Remove(name)
+	if ns.pcache == nil {
+		return "", false, false
+	}
+	e, err := ns.pcache.Get(name)
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Errorf("reading the resolve cache entry of %s: %s", name, err)
+		}
+		return "", false, false
+	}
 
-	return "", false
+	now := time.Now()
+	if now.Before(e.EOL) {
+		ns.cache.Add(name, cacheEntry{
+			val: e.Value,
+			eol: e.EOL,
+		})
+		return e.Value, false, true
+	}
+	if ns.pcache.usable(e, now) {
+		return e.Value, true, true
+	}
+	return "", false, false
 }
 
-func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration) {
+// cacheSet caches the value of the given name for the given duration. The
+// names resolved from IPNS records are also kept in the persistent cache,
+// along with their record.
+func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration, rec *pb.IpnsEntry) {
 	if ns.cache == nil || ttl <= 0 {
 		return
 	}
+	eol := time.Now().Add(ttl)
 	ns.cache.Add(name, cacheEntry{
 		val: val,
-		eol: time.Now().Add(ttl),
+		eol: eol,
 	})
+
+	if ns.pcache == nil || rec == nil {
+		return
+	}
+	if err := ns.pcache.Put(name, val, eol, rec); err != nil {
+		log.Errorf("storing the resolve cache entry of %s: %s", name, err)
+	}
 }
 
 type cacheEntry struct {
 	val path.Path
 	eol time.Time
 }
+
+// Cache is implemented by the name systems which cache resolved names.
+type Cache interface {
+	// CacheEntries returns the cached names, sorted by name.
+	CacheEntries() ([]*CacheEntry, error)
+
+	// ClearCache removes all the cached names, and returns their number.
+	ClearCache() (int, error)
+}
+
+// CacheEntries implements Cache.
+func (ns *mpns) CacheEntries() ([]*CacheEntry, error) {
+	byName := make(map[string]*CacheEntry)
+	if ns.pcache != nil {
+		entries, err := ns.pcache.Entries()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			byName[e.Name] = e
+		}
+	}
+	if ns.cache != nil {
+		for _, k := range ns.cache.Keys() {
+			name := k.(string)
+			ientry, ok := ns.cache.Peek(name)
+			if _, persisted := byName[name]; !ok || persisted {
+				continue
+			}
+			entry := ientry.(cacheEntry)
+			byName[name] = &CacheEntry{
+				Name:  name,
+				Value: entry.val,
+				EOL:   entry.eol,
+			}
+		}
+	}
+
+	entries := make([]*CacheEntry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// ClearCache implements Cache.
+func (ns *mpns) ClearCache() (int, error) {
+	names := make(map[string]struct{})
+	if ns.cache != nil {
+		for _, k := range ns.cache.Keys() {
+			names[k.(string)] = struct{}{}
+		}
+		ns.cache.Purge()
+	}
+	if ns.pcache != nil {
+		entries, err := ns.pcache.Entries()
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range entries {
+			names[e.Name] = struct{}{}
+		}
+		if _, err := ns.pcache.Clear(); err != nil {
+			return 0, err
+		}
+	}
+	return len(names), nil
+}
+
+// persistentCachePrefix is the datastore prefix of the persistent cache
+// entries, one per name.
+var persistentCachePrefix = ds.NewKey("/local/namesys/cache")
+
+// CacheEntry is a cached name resolution.
+type CacheEntry struct {
+	Name  string
+	Value path.Path
+
+	// EOL is the time until which the value is used without resolving the
+	// name again
+	EOL time.Time
+	// Validity is the end of validity of the IPNS record, if any
+	Validity time.Time `json:",omitempty"`
+	// Record is the marshalled IPNS record the value was resolved from,
+	// only set for the persistent entries
+	Record []byte `json:",omitempty"`
+}
+
+// PersistentCache keeps the IPNS records of the resolved names in a
+// datastore, so that they are not resolved again after a restart while they
+// are fresh. The records were validated when they were resolved.
+type PersistentCache struct {
+	dstore ds.Datastore
+
+	// StaleTime is how long past their EOL the entries can still be
+	// returned, as long as their record is valid, while the name is
+	// resolved again in the background. Zero disables stale entries.
+	StaleTime time.Duration
+}
+
+// NewPersistentCache returns a PersistentCache storing its entries in the
+// given datastore.
+func NewPersistentCache(d ds.Datastore) *PersistentCache {
+	return &PersistentCache{dstore: d}
+}
+
+func persistentCacheKey(name string) ds.Key {
+	return persistentCachePrefix.ChildString(name)
+}
+
+// Get returns the cache entry of the given name, or ds.ErrNotFound.
+func (c *PersistentCache) Get(name string) (*CacheEntry, error) {
+	b, err := c.dstore.Get(persistentCacheKey(name))
+	if err != nil {
+		return nil, err
+	}
+	e := new(CacheEntry)
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Put stores the value of the given name, resolved from the given record
+// and fresh until eol.
+func (c *PersistentCache) Put(name string, val path.Path, eol time.Time, rec *pb.IpnsEntry) error {
+	b, err := proto.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	e := &CacheEntry{
+		Name:   name,
+		Value:  val,
+		EOL:    eol,
+		Record: b,
+	}
+	if validity, err := ipns.GetEOL(rec); err == nil {
+		e.Validity = validity
+	}
+
+	b, err = json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return c.dstore.Put(persistentCacheKey(name), b)
+}
+
+// Remove removes the cache entry of the given name, if any.
+func (c *PersistentCache) Remove(name string) error {
+	err := c.dstore.Delete(persistentCacheKey(name))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// usable returns whether the given expired entry can still be returned.
+func (c *PersistentCache) usable(e *CacheEntry, now time.Time) bool {
+	if c.StaleTime <= 0 || now.After(e.EOL.Add(c.StaleTime)) {
+		return false
+	}
+	return e.Validity.IsZero() || now.Before(e.Validity)
+}
+
+// Entries returns all the cache entries, including the expired ones.
+func (c *PersistentCache) Entries() ([]*CacheEntry, error) {
+	res, err := c.dstore.Query(dsq.Query{Prefix: persistentCachePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var entries []*CacheEntry
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		e := new(CacheEntry)
+		if err := json.Unmarshal(r.Value, e); err != nil {
+			log.Errorf("decoding resolve cache entry %s: %s", r.Key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Clear removes all the cache entries, and returns their number.
+func (c *PersistentCache) Clear() (int, error) {
+	res, err := c.dstore.Query(dsq.Query{
+		Prefix:   persistentCachePrefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range entries {
+		if err := c.dstore.Delete(ds.NewKey(e.Key)); err != nil && err != ds.ErrNotFound {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,145 @@
+package namesys
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	opts "github.com/ipfs/go-ipfs/namesys/opts"
+
+	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
+	lru "gx/ipfs/QmQjMHF8ptRgx4E57UFMiT4YM6kqaJeYxZ1MCDX23aw4rK/golang-lru"
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+	ipns "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns"
+	pb "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns/pb"
+	proto "gx/ipfs/QmdxUuburamoF6zF9qjeQC4WYcWGbWuRmdLacMEsW8ioD8/gogo-protobuf/proto"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+var errUnreachable = errors.New("routing not reachable")
+
+// recordResolver resolves every name to its value, from an IPNS record, or
+// fails when it has none.
+type recordResolver struct {
+	lk    sync.Mutex
+	value path.Path
+	calls int
+}
+
+func (r *recordResolver) set(value path.Path) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.value = value
+}
+
+func (r *recordResolver) resolveOnceAsync(ctx context.Context, name string, options opts.ResolveOpts) <-chan onceResult {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.calls++
+
+	out := make(chan onceResult, 1)
+	defer close(out)
+	if r.value == "" {
+		out <- onceResult{err: errUnreachable}
+		return out
+	}
+
+	sk, _, err := ci.GenerateKeyPair(ci.RSA, 512)
+	if err != nil {
+		out <- onceResult{err: err}
+		return out
+	}
+	rec, err := ipns.Create(sk, []byte(r.value), 1, time.Now().Add(24*time.Hour))
+	if err != nil {
+		out <- onceResult{err: err}
+		return out
+	}
+	out <- onceResult{value: r.value, ttl: time.Hour, record: rec}
+	return out
+}
+
+func newCachedNamesys(t *testing.T, res resolver, pcache *PersistentCache) *mpns {
+	cache, err := lru.New(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mpns{
+		ipnsResolver: res,
+		cache:        cache,
+		pcache:       pcache,
+		revalidating: make(map[string]struct{}),
+	}
+}
+
+func TestPersistentCache(t *testing.T) {
+	const name = "QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy"
+	v1 := path.FromString("/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj")
+	v2 := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	online := &recordResolver{value: v1}
+	testResolution(t, newCachedNamesys(t, online, NewPersistentCache(dstore)), "/ipns/"+name, opts.DefaultDepthLimit, v1.String(), nil)
+
+	// after a restart, the name is not resolved again
+	offline := new(recordResolver)
+	ns := newCachedNamesys(t, offline, NewPersistentCache(dstore))
+	testResolution(t, ns, "/ipns/"+name, opts.DefaultDepthLimit, v1.String(), nil)
+	if offline.calls != 0 {
+		t.Fatalf("expected the name to be read from the persistent cache, got %d resolutions", offline.calls)
+	}
+
+	entries, err := ns.CacheEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != name || entries[0].Value != v1 || entries[0].Record == nil {
+		t.Fatalf("unexpected cache entries %v", entries)
+	}
+
+	// the entry expired
+	pcache := NewPersistentCache(dstore)
+	rec := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(entries[0].Record, rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := pcache.Put(name, v1, time.Now().Add(-time.Minute), rec); err != nil {
+		t.Fatal(err)
+	}
+	testResolution(t, newCachedNamesys(t, offline, pcache), "/ipns/"+name, opts.DefaultDepthLimit, "", errUnreachable)
+
+	// the stale value is returned while the name is resolved again
+	pcache.StaleTime = time.Hour
+	online.set(v2)
+	ns = newCachedNamesys(t, online, pcache)
+	testResolution(t, ns, "/ipns/"+name, opts.DefaultDepthLimit, v1.String(), nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e, err := pcache.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Value == v2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stale entry was not updated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	testResolution(t, ns, "/ipns/"+name, opts.DefaultDepthLimit, v2.String(), nil)
+
+	cleared, err := ns.ClearCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared != 1 {
+		t.Fatalf("expected one name to be cleared, got %d", cleared)
+	}
+	if entries, err := pcache.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("expected the persistent cache to be empty, got %v (%v)", entries, err)
+	}
+}
@@ -17,8 +17,6 @@ type LookupTXTFunc func(name string) (txt []string, err error)
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
 	lookupTXT LookupTXTFunc
-	// TODO: maybe some sort of caching?
-	// cache would need a timeout
 }
 
 // NewDNSResolver constructs a name resolver using DNS TXT records.
@@ -26,6 +24,12 @@ func NewDNSResolver() *DNSResolver {
 	return &DNSResolver{lookupTXT: net.LookupTXT}
 }
 
+// NewDNSResolverWithClient constructs a name resolver using DNS TXT records
+// looked up, and cached, with the given client.
+func NewDNSResolverWithClient(c *DNSClient) *DNSResolver {
+	return &DNSResolver{lookupTXT: c.LookupTXT}
+}
+
 // Resolve implements Resolver.
 func (r *DNSResolver) Resolve(ctx context.Context, name string, options ...opts.ResolveOpt) (path.Path, error) {
 	return resolve(ctx, r, name, opts.ProcessOpts(options))
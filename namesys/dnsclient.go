@@ -0,0 +1,265 @@
+package namesys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	lru "gx/ipfs/QmQjMHF8ptRgx4E57UFMiT4YM6kqaJeYxZ1MCDX23aw4rK/golang-lru"
+)
+
+// dnsLookupTimeout bounds the lookups of a DNSClient.
+var dnsLookupTimeout = 10 * time.Second
+
+// dohMediaType is the media type of the DNS-over-HTTPS messages (RFC 8484).
+const dohMediaType = "application/dns-message"
+
+// TXTResolver looks up the TXT records of domain names.
+type TXTResolver interface {
+	// LookupTXT returns the TXT records of the given name, and how long
+	// they can be cached.
+	LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error)
+}
+
+// ParseTXTResolver parses the address of a TXT resolver: either the URL of
+// a DNS-over-HTTPS endpoint, as in https://cloudflare-dns.com/dns-query, or
+// the address of a nameserver, as in 10.0.0.1 or 10.0.0.1:5353.
+func ParseTXTResolver(addr string) (TXTResolver, error) {
+	if strings.HasPrefix(addr, "https://") || strings.HasPrefix(addr, "http://") {
+		if _, err := url.Parse(addr); err != nil {
+			return nil, err
+		}
+		return NewDoHResolver(addr), nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid nameserver address %q", addr)
+	}
+	return NewNameserverResolver(addr), nil
+}
+
+type nameserverResolver struct {
+	addr string
+}
+
+// NewNameserverResolver creates a TXTResolver querying the nameserver at the
+// given host:port address, over UDP, or over TCP for the responses too large
+// for UDP.
+func NewNameserverResolver(addr string) TXTResolver {
+	return &nameserverResolver{addr: addr}
+}
+
+func (r *nameserverResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(b[:])
+
+	query, err := packTXTQuery(id, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	txt, ttl, err := r.exchange(ctx, "udp", id, query)
+	if err == errDNSTruncated {
+		txt, ttl, err = r.exchange(ctx, "tcp", id, query)
+	}
+	return txt, ttl, err
+}
+
+func (r *nameserverResolver) exchange(ctx context.Context, network string, id uint16, query []byte) ([]string, time.Duration, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, r.addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		// messages are prefixed with their length over TCP
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, 0, err
+		}
+
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, 0, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, 0, err
+		}
+		return parseTXTResponse(resp, id)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		txt, ttl, err := parseTXTResponse(buf[:n], id)
+		if err == errDNSWrongID {
+			// a late response to a previous query
+			continue
+		}
+		return txt, ttl, err
+	}
+}
+
+type dohResolver struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHResolver creates a TXTResolver querying the DNS-over-HTTPS endpoint
+// at the given URL.
+func NewDoHResolver(url string) TXTResolver {
+	return &dohResolver{url: url, client: http.DefaultClient}
+}
+
+func (r *dohResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	// RFC 8484 recommends an ID of 0, for the responses to be cacheable
+	query, err := packTXTQuery(0, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS over HTTPS query to %s failed: %s", r.url, resp.Status)
+	}
+
+	msg, err := ioutil.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, 0, err
+	}
+	return parseTXTResponse(msg, 0)
+}
+
+// hostResolver looks up TXT records with the resolver of the host. Their TTL
+// is unknown, so they are not cached.
+type hostResolver struct{}
+
+func (hostResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	txt, err := net.DefaultResolver.LookupTXT(ctx, name)
+	return txt, 0, err
+}
+
+// DNSClient looks up TXT records with the resolver configured for the
+// longest suffix of their domain, and caches them for their TTL.
+type DNSClient struct {
+	resolvers map[string]TXTResolver
+	cache     *lru.Cache
+}
+
+type txtCacheEntry struct {
+	txt []string
+	eol time.Time
+}
+
+// NewDNSClient creates a DNSClient looking up the domains under each of the
+// given suffixes with its resolver. The other domains are looked up with the
+// resolver of the "." suffix, if any, or else with the resolver of the host.
+// No records are cached when the cache size is 0.
+func NewDNSClient(resolvers map[string]TXTResolver, cachesize int) *DNSClient {
+	c := &DNSClient{resolvers: make(map[string]TXTResolver, len(resolvers))}
+	for suffix, r := range resolvers {
+		c.resolvers[normalizeDomain(suffix)] = r
+	}
+	if cachesize > 0 {
+		c.cache, _ = lru.New(cachesize)
+	}
+	return c
+}
+
+// normalizeDomain lowercases the given domain name, and strips its leading
+// and trailing dots, the root domain becoming "".
+func normalizeDomain(name string) string {
+	return strings.Trim(strings.ToLower(name), ".")
+}
+
+// resolver returns the resolver of the longest suffix of the given
+// normalized domain name.
+func (c *DNSClient) resolver(name string) TXTResolver {
+	for {
+		if r, ok := c.resolvers[name]; ok {
+			return r
+		}
+		if name == "" {
+			return hostResolver{}
+		}
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		} else {
+			name = ""
+		}
+	}
+}
+
+// LookupTXT implements LookupTXTFunc.
+func (c *DNSClient) LookupTXT(name string) ([]string, error) {
+	name = normalizeDomain(name)
+	if c.cache != nil {
+		if e, ok := c.cache.Get(name); ok {
+			entry := e.(txtCacheEntry)
+			if time.Now().Before(entry.eol) {
+				return entry.txt, nil
+			}
+			c.cache.Remove(name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+	txt, ttl, err := c.resolver(name).LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cache != nil && ttl > 0 {
+		c.cache.Add(name, txtCacheEntry{
+			txt: txt,
+			eol: time.Now().Add(ttl),
+		})
+	}
+	return txt, nil
+}
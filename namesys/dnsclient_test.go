@@ -0,0 +1,273 @@
+package namesys
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	opts "github.com/ipfs/go-ipfs/namesys/opts"
+)
+
+// testDNSServer is a stand-in nameserver answering the TXT queries of its
+// records.
+type testDNSServer struct {
+	records map[string][]string
+	ttls    map[string]uint32
+
+	// truncate makes the UDP responses truncated, for the queries to be
+	// retried over TCP
+	truncate bool
+
+	lk      sync.Mutex
+	queries map[string]int
+}
+
+func newTestDNSServer(records map[string][]string) *testDNSServer {
+	return &testDNSServer{
+		records: records,
+		ttls:    make(map[string]uint32),
+		queries: make(map[string]int),
+	}
+}
+
+func (s *testDNSServer) queryCount(name string) int {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.queries[name]
+}
+
+func (s *testDNSServer) respond(query []byte, udp bool) []byte {
+	var labels []string
+	off := dnsHeaderLen
+	for off < len(query) && query[off] != 0 {
+		l := int(query[off])
+		labels = append(labels, string(query[off+1:off+1+l]))
+		off += 1 + l
+	}
+	off += 5 // root label, type and class
+	name := strings.Join(labels, ".")
+
+	s.lk.Lock()
+	s.queries[name]++
+	s.lk.Unlock()
+
+	resp := make([]byte, dnsHeaderLen)
+	copy(resp, query[:2])
+	flags := uint16(dnsFlagResponse | dnsFlagRecursionDesired)
+	txt, ok := s.records[name]
+	switch {
+	case !ok:
+		flags |= dnsRcodeNameError
+		txt = nil
+	case udp && s.truncate:
+		flags |= dnsFlagTruncated
+		txt = nil
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(txt)))
+	resp = append(resp, query[dnsHeaderLen:off]...)
+
+	ttl, ok := s.ttls[name]
+	if !ok {
+		ttl = 60
+	}
+	for _, t := range txt {
+		var rdata []byte
+		for len(t) > 255 {
+			rdata = append(append(rdata, 255), t[:255]...)
+			t = t[255:]
+		}
+		rdata = append(append(rdata, byte(len(t))), t...)
+
+		rr := make([]byte, 12)
+		binary.BigEndian.PutUint16(rr[0:], 0xc000|dnsHeaderLen) // the question name
+		binary.BigEndian.PutUint16(rr[2:], dnsTypeTXT)
+		binary.BigEndian.PutUint16(rr[4:], dnsClassINET)
+		binary.BigEndian.PutUint32(rr[6:], ttl)
+		binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+		resp = append(append(resp, rr...), rdata...)
+	}
+	return resp
+}
+
+// listen serves the DNS queries over UDP and TCP on the same local port, and
+// returns its address.
+func (s *testDNSServer) listen(t *testing.T) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(s.respond(buf[:n], true), from)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var lb [2]byte
+			if _, err := io.ReadFull(conn, lb[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(lb[:]))
+				if _, err := io.ReadFull(conn, query); err == nil {
+					resp := s.respond(query, false)
+					binary.BigEndian.PutUint16(lb[:], uint16(len(resp)))
+					conn.Write(append(lb[:], resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return addr, func() {
+		pc.Close()
+		l.Close()
+	}
+}
+
+func (s *testDNSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.Header.Get("Content-Type") != dohMediaType {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	query, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", dohMediaType)
+	w.Write(s.respond(query, false))
+}
+
+func TestParseTXTResolver(t *testing.T) {
+	for addr, expected := range map[string]TXTResolver{
+		"https://cloudflare-dns.com/dns-query": &dohResolver{url: "https://cloudflare-dns.com/dns-query", client: http.DefaultClient},
+		"10.0.0.1":                             &nameserverResolver{addr: "10.0.0.1:53"},
+		"10.0.0.1:5353":                        &nameserverResolver{addr: "10.0.0.1:5353"},
+		"::1":                                  &nameserverResolver{addr: "[::1]:53"},
+	} {
+		r, err := ParseTXTResolver(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e := expected.(type) {
+		case *dohResolver:
+			if d, ok := r.(*dohResolver); !ok || d.url != e.url {
+				t.Errorf("%s: expected a DNS over HTTPS resolver", addr)
+			}
+		case *nameserverResolver:
+			if n, ok := r.(*nameserverResolver); !ok || n.addr != e.addr {
+				t.Errorf("%s: expected the nameserver %s, got %#v", addr, e.addr, r)
+			}
+		}
+	}
+
+	if _, err := ParseTXTResolver(":53"); err == nil {
+		t.Fatal("expected an error without a nameserver host")
+	}
+}
+
+func TestDNSClientNameservers(t *testing.T) {
+	s1 := newTestDNSServer(map[string][]string{
+		"_dnslink.example.com": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		"www.example.com":      {"v=spf1 -all", "dnslink=/ipns/example.com"},
+	})
+	s2 := newTestDNSServer(map[string][]string{
+		"_dnslink.wiki.corp.example.com": {"dnslink=/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy"},
+		"_dnslink.nocache.example.com":   {"dnslink=/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj"},
+	})
+	s2.ttls["_dnslink.nocache.example.com"] = 0
+	s2.truncate = true
+
+	addr1, close1 := s1.listen(t)
+	defer close1()
+	addr2, close2 := s2.listen(t)
+	defer close2()
+
+	r := NewDNSResolverWithClient(NewDNSClient(map[string]TXTResolver{
+		"example.com":         NewNameserverResolver(addr1),
+		"corp.example.com.":   NewNameserverResolver(addr2),
+		"nocache.example.com": NewNameserverResolver(addr2),
+	}, 16))
+
+	for i := 0; i < 2; i++ {
+		testResolution(t, r, "example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+		testResolution(t, r, "www.example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+		testResolution(t, r, "wiki.corp.example.com/a", opts.DefaultDepthLimit, "/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy/a", nil)
+		testResolution(t, r, "nocache.example.com", opts.DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+	}
+
+	// the records are cached for their TTL
+	for name, count := range map[string]int{
+		"_dnslink.example.com":           1,
+		"www.example.com":                1,
+		"_dnslink.wiki.corp.example.com": 2, // over UDP, then TCP
+		"_dnslink.nocache.example.com":   4,
+	} {
+		s := s1
+		if strings.HasSuffix(name, "corp.example.com") || strings.HasSuffix(name, "nocache.example.com") {
+			s = s2
+		}
+		if n := s.queryCount(name); n != count {
+			t.Errorf("expected %d queries of %s, got %d", count, name, n)
+		}
+	}
+	if n := s1.queryCount("_dnslink.wiki.corp.example.com"); n != 0 {
+		t.Errorf("expected the longest suffix to be used, got %d queries of the shorter one", n)
+	}
+}
+
+func TestDNSClientDoH(t *testing.T) {
+	s := newTestDNSServer(map[string][]string{
+		"_dnslink.example.com": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		"long.example.com":     {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/" + strings.Repeat("a", 300)},
+	})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	r, err := ParseTXTResolver(ts.URL + "/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr := NewDNSResolverWithClient(NewDNSClient(map[string]TXTResolver{".": r}, 16))
+
+	testResolution(t, dr, "example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, dr, "long.example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/"+strings.Repeat("a", 300), nil)
+	testResolution(t, dr, "missing.example.com", opts.DefaultDepthLimit, "", ErrResolveFailed)
+	testResolution(t, dr, "example.com", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	if n := s.queryCount("_dnslink.example.com"); n != 1 {
+		t.Fatalf("expected a single query, got %d", n)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	r = NewDoHResolver(failing.URL)
+	if _, _, err := r.LookupTXT(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), strconv.Itoa(http.StatusServiceUnavailable)) {
+		t.Fatalf("expected the HTTP error, got %v", err)
+	}
+}
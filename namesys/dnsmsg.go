@@ -0,0 +1,171 @@
+package namesys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// The subset of the DNS wire format (RFC 1035) needed to look up TXT
+// records from a nameserver or a DNS-over-HTTPS endpoint.
+
+const (
+	dnsHeaderLen = 12
+
+	dnsFlagResponse         = 1 << 15
+	dnsFlagTruncated        = 1 << 9
+	dnsFlagRecursionDesired = 1 << 8
+
+	dnsRcodeMask      = 0xf
+	dnsRcodeNameError = 3
+
+	dnsTypeTXT   = 16
+	dnsClassINET = 1
+)
+
+var (
+	errDNSMalformed = errors.New("malformed DNS response")
+	errDNSTruncated = errors.New("truncated DNS response")
+	errDNSWrongID   = errors.New("unexpected DNS response ID")
+)
+
+// packTXTQuery builds a query of the TXT records of the given name.
+func packTXTQuery(id uint16, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return nil, fmt.Errorf("invalid domain name %q", name)
+	}
+
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagRecursionDesired)
+	binary.BigEndian.PutUint16(msg[4:], 1) // a single question
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid domain name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, dnsTypeTXT, 0, dnsClassINET)
+	return msg, nil
+}
+
+// parseTXTResponse returns the TXT records of a response to the query with
+// the given ID, and the lowest TTL of its answers.
+func parseTXTResponse(msg []byte, id uint16) ([]string, time.Duration, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, 0, errDNSMalformed
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, 0, errDNSWrongID
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&dnsFlagResponse == 0 {
+		return nil, 0, errDNSMalformed
+	}
+	if flags&dnsFlagTruncated != 0 {
+		return nil, 0, errDNSTruncated
+	}
+	switch rcode := flags & dnsRcodeMask; rcode {
+	case 0:
+	case dnsRcodeNameError:
+		return nil, 0, errors.New("no such domain")
+	default:
+		return nil, 0, fmt.Errorf("DNS query failed with rcode %d", rcode)
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := dnsHeaderLen
+	for i := 0; i < qdcount; i++ {
+		off = skipDNSName(msg, off)
+		if off < 0 || off+4 > len(msg) {
+			return nil, 0, errDNSMalformed
+		}
+		off += 4 // type and class
+	}
+
+	var txt []string
+	minTTL := uint32(math.MaxUint32)
+	for i := 0; i < ancount; i++ {
+		off = skipDNSName(msg, off)
+		if off < 0 || off+10 > len(msg) {
+			return nil, 0, errDNSMalformed
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		class := binary.BigEndian.Uint16(msg[off+2:])
+		ttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, 0, errDNSMalformed
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+
+		if class != dnsClassINET {
+			continue
+		}
+		// the CNAME records leading to the TXT records bound their TTL too
+		if ttl < minTTL {
+			minTTL = ttl
+		}
+		if typ != dnsTypeTXT {
+			continue
+		}
+		s, err := parseTXTData(rdata)
+		if err != nil {
+			return nil, 0, err
+		}
+		txt = append(txt, s)
+	}
+
+	if len(txt) == 0 {
+		return nil, 0, errors.New("no TXT records")
+	}
+	return txt, time.Duration(minTTL) * time.Second, nil
+}
+
+// parseTXTData joins the character strings of a TXT record.
+func parseTXTData(rdata []byte) (string, error) {
+	var s []byte
+	for len(rdata) > 0 {
+		l := int(rdata[0])
+		if 1+l > len(rdata) {
+			return "", errDNSMalformed
+		}
+		s = append(s, rdata[1:1+l]...)
+		rdata = rdata[1+l:]
+	}
+	return string(s), nil
+}
+
+// skipDNSName returns the offset following the name at the given offset, or
+// -1 if it is malformed.
+func skipDNSName(msg []byte, off int) int {
+	for {
+		if off >= len(msg) {
+			return -1
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1
+		case l&0xc0 == 0xc0: // compression pointer
+			if off+2 > len(msg) {
+				return -1
+			}
+			return off + 2
+		case l&0xc0 != 0:
+			return -1
+		}
+		off += 1 + l
+	}
+}
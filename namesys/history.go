@@ -0,0 +1,96 @@
+package namesys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+
+	pb "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns/pb"
+	peer "gx/ipfs/QmcqU6QUDSXprb1518vYDGczrTJTyGwLG9eUa5iNX4xUtS/go-libp2p-peer"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsquery "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+	base32 "gx/ipfs/QmfVj3x4D6Jkq9SEoi5n2NmoUomLwoeiwnYz2KQa15wRw6/base32"
+)
+
+// historyPrefix is the datastore prefix of the publish history, which has
+// one entry per name and sequence number.
+var historyPrefix = ds.NewKey("/local/ipns/history")
+
+// HistoryEntry is a value published by this node for a name.
+type HistoryEntry struct {
+	Sequence  uint64
+	Value     path.Path
+	Published time.Time
+}
+
+func historyDsKey(id peer.ID) ds.Key {
+	return historyPrefix.ChildString(base32.RawStdEncoding.EncodeToString([]byte(id)))
+}
+
+func historyEntryDsKey(id peer.ID, seq uint64) ds.Key {
+	// padded, so that the entries of a name are sorted by sequence number
+	return historyDsKey(id).ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// addHistory records a published record in the history of its name. The
+// records republished with the same sequence number, and thus the same
+// value, keep the time of their first publication.
+func addHistory(d ds.Datastore, id peer.ID, rec *pb.IpnsEntry, published time.Time) error {
+	k := historyEntryDsKey(id, rec.GetSequence())
+	has, err := d.Has(k)
+	if err != nil || has {
+		return err
+	}
+
+	b, err := json.Marshal(&HistoryEntry{
+		Sequence:  rec.GetSequence(),
+		Value:     path.Path(rec.GetValue()),
+		Published: published,
+	})
+	if err != nil {
+		return err
+	}
+	return d.Put(k, b)
+}
+
+// PublishHistory returns the values published by this node for the given
+// name, sorted by sequence number.
+func PublishHistory(d ds.Datastore, id peer.ID) ([]*HistoryEntry, error) {
+	res, err := d.Query(dsquery.Query{Prefix: historyDsKey(id).String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var entries []*HistoryEntry
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		e := new(HistoryEntry)
+		if err := json.Unmarshal(r.Value, e); err != nil {
+			log.Errorf("decoding publish history entry %s: %s", r.Key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Sequence < entries[j].Sequence })
+	return entries, nil
+}
+
+// GetPublishHistory returns the value published by this node for the given
+// name with the given sequence number, or ds.ErrNotFound.
+func GetPublishHistory(d ds.Datastore, id peer.ID, seq uint64) (*HistoryEntry, error) {
+	b, err := d.Get(historyEntryDsKey(id, seq))
+	if err != nil {
+		return nil, err
+	}
+	e := new(HistoryEntry)
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -3,6 +3,7 @@ package namesys
 import (
 	"context"
 	"strings"
+	"sync"
 	"time"
 
 	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
@@ -22,8 +23,9 @@ import (
 //
 // Uses several Resolvers:
 // (a) IPFS routing naming: SFS-like PKI names.
-// (b) dns domains: resolves using links in DNS TXT records
-// (c) proquints: interprets string as the raw byte data.
+// (b) static names: resolves using a local mapping, if any
+// (c) dns domains: resolves using links in DNS TXT records
+// (d) proquints: interprets string as the raw byte data.
 //
 // It can only publish to: (a) IPFS routing naming.
 //
@@ -31,27 +33,72 @@ type mpns struct {
 	dnsResolver, proquintResolver, ipnsResolver resolver
 	ipnsPublisher                               Publisher
 
-	cache *lru.Cache
+	staticResolver *StaticResolver
+
+	cache  *lru.Cache
+	pcache *PersistentCache
+
+	// names being resolved again in the background
+	revalidating   map[string]struct{}
+	revalidatingLk sync.Mutex
+}
+
+// Option is an option of NewNameSystem.
+type Option func(*mpns)
+
+// WithPersistentCache makes the name system look up the IPNS records of the
+// names missing from the memory cache in the given persistent cache, and add
+// the resolved ones to it. The persistent cache is not used when the memory
+// cache is disabled.
+func WithPersistentCache(pcache *PersistentCache) Option {
+	return func(ns *mpns) {
+		ns.pcache = pcache
+	}
+}
+
+// WithStaticResolver makes the name system resolve the names known to the
+// given static resolver before looking them up in DNS.
+func WithStaticResolver(r *StaticResolver) Option {
+	return func(ns *mpns) {
+		ns.staticResolver = r
+	}
+}
+
+// WithDNSResolver makes the name system resolve the domain names with the
+// given resolver instead of the one using the resolver of the host.
+func WithDNSResolver(r *DNSResolver) Option {
+	return func(ns *mpns) {
+		ns.dnsResolver = r
+	}
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
-func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSystem {
+func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int, options ...Option) NameSystem {
 	var cache *lru.Cache
 	if cachesize > 0 {
 		cache, _ = lru.New(cachesize)
 	}
 
-	return &mpns{
+	ns := &mpns{
 		dnsResolver:      NewDNSResolver(),
 		proquintResolver: new(ProquintResolver),
 		ipnsResolver:     NewIpnsResolver(r),
 		ipnsPublisher:    NewIpnsPublisher(r, ds),
 		cache:            cache,
+		revalidating:     make(map[string]struct{}),
+	}
+	for _, option := range options {
+		option(ns)
 	}
+	return ns
 }
 
 const DefaultResolverCacheTTL = time.Minute
 
+// revalidateTimeout bounds the background resolution of the names whose
+// stale value was returned from the persistent cache.
+const revalidateTimeout = time.Minute
+
 // Resolve implements Resolver.
 func (ns *mpns) Resolve(ctx context.Context, name string, options ...opts.ResolveOpt) (path.Path, error) {
 	if strings.HasPrefix(name, "/ipfs/") {
@@ -99,7 +146,27 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 
 	key := segments[2]
 
-	if p, ok := ns.cacheGet(key); ok {
+	// Resolver selection:
+	// 1. if it is a multihash resolve through "ipns".
+	// 2. if it is a static name, resolve through "static"
+	// 3. if it is a domain name, resolve through "dns"
+	// 4. otherwise resolve through the "proquint" resolver
+
+	var res resolver
+	if _, err := mh.FromB58String(key); err == nil {
+		res = ns.ipnsResolver
+	} else if ns.HasStaticName(key) {
+		res = ns.staticResolver
+	} else if isd.IsDomain(key) {
+		res = ns.dnsResolver
+	} else {
+		res = ns.proquintResolver
+	}
+
+	if p, stale, ok := ns.cacheGet(key); ok {
+		if stale {
+			ns.revalidate(key, res, options)
+		}
 		if len(segments) > 3 {
 			var err error
 			p, err = path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[3])
@@ -113,20 +180,6 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 		return out
 	}
 
-	// Resolver selection:
-	// 1. if it is a multihash resolve through "ipns".
-	// 2. if it is a domain name, resolve through "dns"
-	// 3. otherwise resolve through the "proquint" resolver
-
-	var res resolver
-	if _, err := mh.FromB58String(key); err == nil {
-		res = ns.ipnsResolver
-	} else if isd.IsDomain(key) {
-		res = ns.dnsResolver
-	} else {
-		res = ns.proquintResolver
-	}
-
 	resCh := res.resolveOnceAsync(ctx, key, options)
 	var best onceResult
 	go func() {
@@ -136,7 +189,7 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 			case res, ok := <-resCh:
 				if !ok {
 					if best != (onceResult{}) {
-						ns.cacheSet(key, best.value, best.ttl)
+						ns.cacheSet(key, best.value, best.ttl, best.record)
 					}
 					return
 				}
@@ -164,6 +217,50 @@ func (ns *mpns) resolveOnceAsync(ctx context.Context, name string, options opts.
 	return out
 }
 
+// revalidate resolves the given name again in the background, to update
+// the stale value returned from the persistent cache.
+func (ns *mpns) revalidate(key string, res resolver, options opts.ResolveOpts) {
+	ns.revalidatingLk.Lock()
+	defer ns.revalidatingLk.Unlock()
+	if _, ok := ns.revalidating[key]; ok {
+		return
+	}
+	ns.revalidating[key] = struct{}{}
+
+	go func() {
+		defer func() {
+			ns.revalidatingLk.Lock()
+			delete(ns.revalidating, key)
+			ns.revalidatingLk.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+
+		var best onceResult
+		for r := range res.resolveOnceAsync(ctx, key, options) {
+			if r.err == nil {
+				best = r
+			}
+		}
+		if best == (onceResult{}) {
+			log.Debugf("could not resolve %s again, keeping its stale value", key)
+			return
+		}
+		ns.cacheSet(key, best.value, best.ttl, best.record)
+	}()
+}
+
+// HasStaticName returns whether the given name is resolved by the static
+// resolver of the name system.
+func (ns *mpns) HasStaticName(name string) bool {
+	if ns.staticResolver == nil {
+		return false
+	}
+	_, ok := ns.staticResolver.Lookup(name)
+	return ok
+}
+
 func emitOnceResult(ctx context.Context, outCh chan<- onceResult, r onceResult) {
 	select {
 	case outCh <- r:
@@ -188,6 +285,13 @@ func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.
 	if ttEol := eol.Sub(time.Now()); ttEol < ttl {
 		ttl = ttEol
 	}
-	ns.cacheSet(peer.IDB58Encode(id), value, ttl)
+	key := peer.IDB58Encode(id)
+	if ns.pcache != nil {
+		// the persisted record is outdated
+		if err := ns.pcache.Remove(key); err != nil {
+			log.Errorf("removing the resolve cache entry of %s: %s", key, err)
+		}
+	}
+	ns.cacheSet(key, value, ttl, nil)
 	return nil
 }
@@ -183,6 +183,9 @@ func (p *IpnsPublisher) updateRecord(ctx context.Context, k ci.PrivKey, value pa
 	if err := p.ds.Put(IpnsDsKey(id), data); err != nil {
 		return nil, err
 	}
+	if err := addHistory(p.ds, id, entry, time.Now()); err != nil {
+		return nil, err
+	}
 	return entry, nil
 }
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
 	ipns "gx/ipfs/QmR9UpasSQR4Mqq1qiJAfnY4SVBxJn7r639CxiLjx8dYGm/go-ipns"
 	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
 	testutil "gx/ipfs/QmZXjR5X1p4KrQ967cTsy4MymMzUM8mZECF3PV8UcN4o3g/go-testutil"
@@ -110,3 +111,54 @@ func TestRSAPublisher(t *testing.T) {
 func TestEd22519Publisher(t *testing.T) {
 	testNamekeyPublisher(t, ci.Ed25519, ds.ErrNotFound, false)
 }
+
+func TestPublishHistory(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	serv := mockrouting.NewServer()
+	r := serv.ClientWithDatastore(ctx, testutil.RandIdentityOrFatal(t), dstore)
+	publisher := NewIpnsPublisher(r, dstore)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pubk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1 := path.FromString("/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj")
+	v2 := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	// republishing the same value does not add an entry
+	for _, v := range []path.Path{v1, v1, v2, v1} {
+		if err := publisher.Publish(ctx, privk, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := PublishHistory(dstore, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []path.Path{v1, v2, v1}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d history entries, got %d", len(expected), len(entries))
+	}
+	for i, e := range entries {
+		if e.Sequence != uint64(i) || e.Value != expected[i] {
+			t.Fatalf("unexpected history entry %d: %d %s", i, e.Sequence, e.Value)
+		}
+	}
+
+	e, err := GetPublishHistory(dstore, id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value != v2 {
+		t.Fatalf("expected %s, got %s", v2, e.Value)
+	}
+	if _, err := GetPublishHistory(dstore, id, 3); err != ds.ErrNotFound {
+		t.Fatalf("expected no entry, got %v", err)
+	}
+}
@@ -152,7 +152,7 @@ func (r *IpnsResolver) resolveOnceAsync(ctx context.Context, name string, option
 					return
 				}
 
-				emitOnceResult(ctx, out, onceResult{value: p, ttl: ttl})
+				emitOnceResult(ctx, out, onceResult{value: p, ttl: ttl, record: entry})
 			case <-ctx.Done():
 				return
 			}
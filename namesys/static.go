@@ -0,0 +1,218 @@
+package namesys
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	opts "github.com/ipfs/go-ipfs/namesys/opts"
+
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+)
+
+// staticCheckInterval is the minimum delay between two checks of the
+// static names file for changes.
+var staticCheckInterval = time.Second
+
+// ErrStaticNameNotFound is returned when resolving a name missing from the
+// static names.
+var ErrStaticNameNotFound = errors.New("not a static name")
+
+// StaticNames is implemented by the name systems which resolve names from a
+// static mapping.
+type StaticNames interface {
+	// HasStaticName returns whether the given name is a static name.
+	HasStaticName(name string) bool
+}
+
+// StaticResolver resolves names from a static mapping, given directly or
+// read from a file with the same syntax as /etc/hosts: each line holds a
+// path followed by the names resolving to it, and comments start with #.
+//
+//	/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy  wiki wiki.internal
+//	/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n  blog
+//
+// The file is read again when it changes. The names given directly take
+// precedence over the ones of the file. Names are case insensitive.
+type StaticResolver struct {
+	names map[string]path.Path
+	file  string
+
+	lk        sync.Mutex
+	fileNames map[string]path.Path
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// NewStaticResolver creates a StaticResolver resolving the given names, and
+// the ones of the given file, if any. A missing file is ignored until it is
+// created.
+func NewStaticResolver(names map[string]path.Path, file string) (*StaticResolver, error) {
+	r := &StaticResolver{
+		names: make(map[string]path.Path, len(names)),
+		file:  file,
+	}
+	for name, p := range names {
+		if !validStaticName(name) {
+			return nil, fmt.Errorf("invalid static name %q", name)
+		}
+		r.names[strings.ToLower(name)] = p
+	}
+
+	if file != "" {
+		st, err := os.Stat(file)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			fileNames, err := readStaticNames(file)
+			if err != nil {
+				return nil, err
+			}
+			r.fileNames = fileNames
+			r.modTime = st.ModTime()
+			r.size = st.Size()
+		}
+		r.lastCheck = time.Now()
+	}
+	return r, nil
+}
+
+func validStaticName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/ \t")
+}
+
+// ParseStaticNames parses a static names file.
+func ParseStaticNames(rd io.Reader) (map[string]path.Path, error) {
+	names := make(map[string]path.Path)
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a path followed by names", n)
+		}
+
+		p, err := path.ParsePath(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		for _, name := range fields[1:] {
+			if !validStaticName(name) {
+				return nil, fmt.Errorf("line %d: invalid name %q", n, name)
+			}
+			names[strings.ToLower(name)] = p
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func readStaticNames(file string) (map[string]path.Path, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := ParseStaticNames(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return names, nil
+}
+
+// reload reads the file again if it changed since it was last read. The
+// previous names are kept when the new file is invalid. The lock must be
+// held.
+func (r *StaticResolver) reload() {
+	if r.file == "" || time.Since(r.lastCheck) < staticCheckInterval {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	st, err := os.Stat(r.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("checking static names file: %s", err)
+			return
+		}
+		r.fileNames = nil
+		r.modTime = time.Time{}
+		r.size = 0
+		return
+	}
+	if st.ModTime().Equal(r.modTime) && st.Size() == r.size {
+		return
+	}
+
+	names, err := readStaticNames(r.file)
+	if err != nil {
+		log.Errorf("reloading static names: %s", err)
+		return
+	}
+	log.Debugf("reloaded %d static names from %s", len(names), r.file)
+	r.fileNames = names
+	r.modTime = st.ModTime()
+	r.size = st.Size()
+}
+
+// Lookup returns the path of the given name, and whether it is a static
+// name.
+func (r *StaticResolver) Lookup(name string) (path.Path, bool) {
+	name = strings.ToLower(name)
+	if p, ok := r.names[name]; ok {
+		return p, true
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.reload()
+	p, ok := r.fileNames[name]
+	return p, ok
+}
+
+// Resolve implements Resolver.
+func (r *StaticResolver) Resolve(ctx context.Context, name string, options ...opts.ResolveOpt) (path.Path, error) {
+	return resolve(ctx, r, name, opts.ProcessOpts(options))
+}
+
+// resolveOnceAsync implements resolver. The names are not cached, so that
+// the changes of the file are seen right away.
+func (r *StaticResolver) resolveOnceAsync(ctx context.Context, name string, options opts.ResolveOpts) <-chan onceResult {
+	out := make(chan onceResult, 1)
+	defer close(out)
+
+	segments := strings.SplitN(name, "/", 2)
+	p, ok := r.Lookup(segments[0])
+	if !ok {
+		out <- onceResult{err: ErrStaticNameNotFound}
+		return out
+	}
+	if len(segments) > 1 {
+		var err error
+		p, err = path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[1])
+		if err != nil {
+			out <- onceResult{err: err}
+			return out
+		}
+	}
+	out <- onceResult{value: p}
+	return out
+}
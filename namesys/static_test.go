@@ -0,0 +1,115 @@
+package namesys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	opts "github.com/ipfs/go-ipfs/namesys/opts"
+
+	path "gx/ipfs/QmQtg7N4XjAk2ZYpBjjv8B6gQprsRekabHBCnF6i46JYKJ/go-path"
+)
+
+func TestParseStaticNames(t *testing.T) {
+	names, err := ParseStaticNames(strings.NewReader(`
+# comment
+/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy  wiki Wiki.Internal # trailing comment
+/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n	blog
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"wiki":          "/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy",
+		"wiki.internal": "/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy",
+		"blog":          "/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %d names, got %d", len(expected), len(names))
+	}
+	for name, p := range expected {
+		if names[name].String() != p {
+			t.Errorf("%s: expected %s, got %s", name, p, names[name])
+		}
+	}
+
+	for _, bad := range []string{
+		"/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy",
+		"notapath wiki",
+	} {
+		if _, err := ParseStaticNames(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestStaticResolverReload(t *testing.T) {
+	defer func(d time.Duration) { staticCheckInterval = d }(staticCheckInterval)
+	staticCheckInterval = 0
+
+	dir, err := ioutil.TempDir("", "static-names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "names")
+
+	r, err := NewStaticResolver(map[string]path.Path{
+		"Blog": path.Path("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"),
+	}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lookup("wiki"); ok {
+		t.Fatal("expected no name before the file is created")
+	}
+
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy wiki blog\n")
+	testResolution(t, r, "wiki", opts.DefaultDepthLimit, "/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy", nil)
+	testResolution(t, r, "wiki/a/b", opts.DefaultDepthLimit, "/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy/a/b", nil)
+	// the names given directly take precedence over the file
+	testResolution(t, r, "blog", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+
+	write("/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj wiki wiki2\n")
+	testResolution(t, r, "wiki", opts.DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+
+	// an invalid file keeps the previous names
+	write("invalid\n")
+	testResolution(t, r, "wiki", opts.DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	testResolution(t, r, "wiki", opts.DefaultDepthLimit, "", ErrStaticNameNotFound)
+}
+
+func TestNamesysStaticResolution(t *testing.T) {
+	static, err := NewStaticResolver(map[string]path.Path{
+		"ipfs.io": path.Path("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"),
+		"wiki":    path.Path("/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy"),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &mpns{
+		ipnsResolver:   mockResolverOne(),
+		dnsResolver:    mockResolverTwo(),
+		staticResolver: static,
+	}
+
+	testResolution(t, r, "/ipns/ipfs.io", opts.DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "/ipns/wiki", opts.DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+	testResolution(t, r, "/ipns/wiki/index.html", 1, "/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy/index.html", ErrResolveRecursion)
+	if !r.HasStaticName("WIKI") || r.HasStaticName("ipfs.com") {
+		t.Fatal("wrong static names")
+	}
+}
@@ -0,0 +1,149 @@
+package pin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ipfs/go-ipfs/dagutils"
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// pinDepthDatastorePrefix is the prefix under which depth limited pins are
+// stored, one key per pinned cid holding the maximum depth.
+var pinDepthDatastorePrefix = ds.NewKey("/local/pindepth")
+
+// PinWithDepth pins the given node along with its descendants down to
+// maxDepth levels below it. A depth of 1 pins the node and its direct
+// children.
+func (p *pinner) PinWithDepth(ctx context.Context, node ipld.Node, maxDepth int) error {
+	if maxDepth < 1 {
+		return fmt.Errorf("invalid pin depth %d, depth limited pins need a depth of at least 1", maxDepth)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	err := p.dserv.Add(ctx, node)
+	if err != nil {
+		return err
+	}
+
+	c := node.Cid()
+	if p.recursePin.Has(c) {
+		return fmt.Errorf("%s already pinned recursively", c.String())
+	}
+
+	p.lock.Unlock()
+	// fetch the graph down to the requested depth
+	err = fetchDepth(ctx, p.dserv, c, maxDepth)
+	p.lock.Lock()
+	if err != nil {
+		return err
+	}
+
+	if p.recursePin.Has(c) {
+		return fmt.Errorf("%s already pinned recursively", c.String())
+	}
+
+	if p.directPin.Has(c) {
+		p.directPin.Remove(c)
+	}
+	p.depthPin[c] = maxDepth
+	p.changed.Add(c)
+	return nil
+}
+
+// fetchDepth fetches the nodes reachable from root down to maxDepth.
+func fetchDepth(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, maxDepth int) error {
+	set := cid.NewSet()
+	err := dagutils.EnumerateChildrenDepth(ctx, mdag.GetLinksWithDAG(ng), root, maxDepth, set.Visit)
+	if err != nil {
+		return err
+	}
+	for opt := range ng.GetMany(ctx, set.Keys()) {
+		if opt.Err != nil {
+			return opt.Err
+		}
+	}
+	return nil
+}
+
+// DepthLimitedKeys returns the depth limited pins along with their maximum
+// depth.
+func (p *pinner) DepthLimitedKeys() map[cid.Cid]int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	out := make(map[cid.Cid]int, len(p.depthPin))
+	for c, d := range p.depthPin {
+		out[c] = d
+	}
+	return out
+}
+
+// depthLimitedRoot finds a depth limited pin through which c is pinned.
+func (p *pinner) depthLimitedRoot(c cid.Cid) (cid.Cid, bool, error) {
+	for rc, depth := range p.depthPin {
+		set := cid.NewSet()
+		err := dagutils.EnumerateChildrenDepth(context.TODO(), mdag.GetLinksWithDAG(p.dserv), rc, depth, set.Visit)
+		if err != nil {
+			return cid.Cid{}, false, err
+		}
+		if set.Has(c) {
+			return rc, true, nil
+		}
+	}
+	return cid.Cid{}, false, nil
+}
+
+// flushDepth writes the depth limited pins among the given changed cids to
+// the datastore, and deletes the entries of the others.
+func (p *pinner) flushDepth(changed []cid.Cid) error {
+	for _, c := range changed {
+		k := pinDepthDatastorePrefix.Child(dshelp.CidToDsKey(c))
+		depth, ok := p.depthPin[c]
+		if !ok {
+			if err := p.dstore.Delete(k); err != nil && err != ds.ErrNotFound {
+				return err
+			}
+			continue
+		}
+		if err := p.dstore.Put(k, []byte(strconv.Itoa(depth))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDepth reads all the depth limited pins stored in the datastore.
+func loadDepth(d ds.Datastore) (map[cid.Cid]int, error) {
+	res, err := d.Query(dsq.Query{Prefix: pinDepthDatastorePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	out := make(map[cid.Cid]int)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := ds.RawKey(r.Key)
+		c, err := dshelp.DsKeyToCid(ds.NewKey(k.BaseNamespace()))
+		if err != nil {
+			log.Errorf("decoding cid from pin depth key %s: %s", k, err)
+			continue
+		}
+		depth, err := strconv.Atoi(string(r.Value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid depth for pin %s: %v", c, err)
+		}
+		out[c] = depth
+	}
+	return out, nil
+}
@@ -0,0 +1,207 @@
+package pin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// pinSetDatastorePrefix is the prefix under which the datastore pinner
+// stores its pins, one key per pinned cid holding the pin mode.
+var pinSetDatastorePrefix = ds.NewKey("/local/pinset")
+
+// ErrDatastorePins is returned by LoadPinner when the pins were migrated to
+// the datastore pinner, and must be loaded with LoadDatastorePinner. Starting
+// from an empty pinner instead would let the garbage collection remove all
+// the pinned blocks.
+var ErrDatastorePins = errors.New("the pins are stored by the datastore pinner")
+
+// hasDatastorePins returns whether the datastore holds pins stored by the
+// datastore pinner.
+func hasDatastorePins(d ds.Datastore) (bool, error) {
+	res, err := d.Query(dsq.Query{Prefix: pinSetDatastorePrefix.String(), KeysOnly: true, Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	defer res.Close()
+
+	r, ok := res.NextSync()
+	if !ok {
+		return false, nil
+	}
+	return r.Error == nil, r.Error
+}
+
+// datastoreStore stores every direct and recursive pin under its own key in
+// the datastore. Only the pins which changed are written on flush, so the
+// cost of a flush does not grow with the number of pins. Depth limited pins
+// are stored by the pinner itself, the same way for every pinStore.
+type datastoreStore struct{}
+
+// keyWriter is implemented by both datastores and datastore batches.
+type keyWriter interface {
+	Put(ds.Key, []byte) error
+	Delete(ds.Key) error
+}
+
+func pinSetKey(c cid.Cid) ds.Key {
+	return pinSetDatastorePrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// flush writes the pins which changed since the previous flush.
+func (datastoreStore) flush(ctx context.Context, p *pinner, changed []cid.Cid) error {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	var w keyWriter = p.dstore
+	var batch ds.Batch
+	if bds, ok := p.dstore.(ds.Batching); ok {
+		b, err := bds.Batch()
+		if err != nil {
+			return err
+		}
+		w = b
+		batch = b
+	}
+
+	for _, c := range changed {
+		var mode Mode
+		switch {
+		case p.recursePin.Has(c):
+			mode = Recursive
+		case p.directPin.Has(c):
+			mode = Direct
+		default:
+			if err := w.Delete(pinSetKey(c)); err != nil && err != ds.ErrNotFound {
+				return err
+			}
+			continue
+		}
+
+		modeStr, _ := ModeToString(mode)
+		if err := w.Put(pinSetKey(c), []byte(modeStr)); err != nil {
+			return fmt.Errorf("cannot store pin state: %v", err)
+		}
+	}
+
+	if batch != nil {
+		return batch.Commit()
+	}
+	return nil
+}
+
+func newDatastorePinner(d ds.Datastore, serv, internal ipld.DAGService) *pinner {
+	return &pinner{
+		recursePin:  cid.NewSet(),
+		directPin:   cid.NewSet(),
+		depthPin:    make(map[cid.Cid]int),
+		dserv:       serv,
+		dstore:      d,
+		internal:    internal,
+		internalPin: cid.NewSet(),
+		store:       datastoreStore{},
+		changed:     cid.NewSet(),
+		meta:        make(map[cid.Cid]PinMeta),
+		metaDirty:   cid.NewSet(),
+	}
+}
+
+// LoadDatastorePinner loads a pinner which stores each pin under its own
+// key in the given datastore, instead of as a DAG rewritten on every Flush.
+//
+// If the datastore still holds pins stored by a pinner from NewPinner or
+// LoadPinner, they are migrated to the new format on the first load.
+func LoadDatastorePinner(d ds.Datastore, serv, internal ipld.DAGService) (Pinner, error) {
+	if err := migrateDagSetPins(d, serv, internal); err != nil {
+		return nil, fmt.Errorf("cannot migrate pin state: %v", err)
+	}
+
+	p := newDatastorePinner(d, serv, internal)
+
+	res, err := d.Query(dsq.Query{Prefix: pinSetDatastorePrefix.String()})
+	if err != nil {
+		return nil, fmt.Errorf("cannot load pin state: %v", err)
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, fmt.Errorf("cannot load pin state: %v", r.Error)
+		}
+		k := ds.RawKey(r.Key)
+		c, err := dshelp.DsKeyToCid(ds.NewKey(k.BaseNamespace()))
+		if err != nil {
+			log.Errorf("decoding cid from pin key %s: %s", k, err)
+			continue
+		}
+
+		mode, ok := StringToMode(string(r.Value))
+		switch {
+		case ok && mode == Recursive:
+			p.recursePin.Add(c)
+		case ok && mode == Direct:
+			p.directPin.Add(c)
+		default:
+			return nil, fmt.Errorf("invalid pin mode %q for %s", r.Value, c)
+		}
+	}
+
+	depthPin, err := loadDepth(d)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load depth limited pins: %v", err)
+	}
+	p.depthPin = depthPin
+
+	meta, err := loadMeta(d)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load pin metadata: %v", err)
+	}
+	p.meta = meta
+
+	return p, nil
+}
+
+// migrateDagSetPins moves the pins stored as pb.Set DAGs under
+// pinDatastoreKey to one datastore key per pin. It does nothing if there is
+// no such pin state. Pin metadata is shared by both formats and is left
+// untouched.
+func migrateDagSetPins(d ds.Datastore, serv, internal ipld.DAGService) error {
+	has, err := d.Has(pinDatastoreKey)
+	if err != nil || !has {
+		return err
+	}
+
+	old, err := LoadPinner(d, serv, internal)
+	if err != nil {
+		return err
+	}
+
+	p := newDatastorePinner(d, serv, internal)
+	for _, c := range old.RecursiveKeys() {
+		p.recursePin.Add(c)
+		p.changed.Add(c)
+	}
+	for _, c := range old.DirectKeys() {
+		p.directPin.Add(c)
+		p.changed.Add(c)
+	}
+
+	err = p.store.flush(context.TODO(), p, p.changed.Keys())
+	if err != nil {
+		return err
+	}
+
+	log.Infof("migrated %d recursive and %d direct pins to the datastore pinner",
+		p.recursePin.Len(), p.directPin.Len())
+
+	// The pb.Set DAG is not referenced anymore and will be collected by
+	// the next garbage collection.
+	return d.Delete(pinDatastoreKey)
+}
@@ -0,0 +1,173 @@
+package pin
+
+import (
+	"context"
+	"testing"
+
+	bs "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func newTestDag() (ds.Datastore, ipld.DAGService) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+	return dstore, mdag.NewDAGService(bserv)
+}
+
+func TestDatastorePinner(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	p, err := LoadDatastorePinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, ak := randNode()
+	b, bk := randNode()
+	c, ck := randNode()
+	dserv.Add(ctx, a)
+	dserv.Add(ctx, b)
+	dserv.Add(ctx, c)
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, b, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, c, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.InternalPins()) != 0 {
+		t.Fatal("datastore pinner should not have internal pins")
+	}
+
+	has, err := dstore.Has(pinSetKey(ak))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("expected pin to be stored under its own key")
+	}
+
+	if err := p.Unpin(ctx, ck, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadDatastorePinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertPinned(t, np, ak, "recursive pin should be loaded")
+	assertPinned(t, np, bk, "direct pin should be loaded")
+	assertUnpinned(t, np, ck, "removed pin should not be loaded")
+
+	if _, pinned, _ := np.IsPinnedWithType(bk, Direct); !pinned {
+		t.Fatal("expected direct pin to keep its mode")
+	}
+}
+
+func TestDatastorePinnerMigration(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	old := NewPinner(dstore, dserv, dserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	dserv.Add(ctx, a)
+	dserv.Add(ctx, b)
+
+	if err := old.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Pin(ctx, b, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.SetMeta(ak, PinMeta{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadDatastorePinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, pinned, _ := p.IsPinnedWithType(ak, Recursive); !pinned {
+		t.Fatal("recursive pin was not migrated")
+	}
+	if _, pinned, _ := p.IsPinnedWithType(bk, Direct); !pinned {
+		t.Fatal("direct pin was not migrated")
+	}
+	if m, _ := p.Meta(ak); m.Name != "a" {
+		t.Fatal("pin metadata was not kept")
+	}
+
+	has, err := dstore.Has(pinDatastoreKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("old pin state should be removed after migration")
+	}
+
+	// loading again must not lose anything
+	p, err = LoadDatastorePinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPinned(t, p, ak, "pin lost after second load")
+	assertPinned(t, p, bk, "pin lost after second load")
+}
+
+func TestDatastorePinnerDisabled(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	old := NewPinner(dstore, dserv, dserv)
+	a, ak := randNode()
+	dserv.Add(ctx, a)
+	if err := old.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// enabling the datastore pinner migrates the pins
+	p, err := LoadDatastorePinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPinned(t, p, ak, "pin was not migrated")
+
+	// disabling it again must not silently start from no pins
+	if _, err := LoadPinner(dstore, dserv, dserv); err != ErrDatastorePins {
+		t.Fatalf("expected ErrDatastorePins, got %v", err)
+	}
+
+	// a repo which never had pins still gets an error to start empty
+	empty, _ := newTestDag()
+	if _, err := LoadPinner(empty, dserv, dserv); err == nil || err == ErrDatastorePins {
+		t.Fatalf("expected a missing pin state error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package pin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+)
+
+// ExportVersion is the version of the pin export format written by
+// WriteExport.
+const ExportVersion = 1
+
+// Export formats supported by WriteExport and ReadExport.
+const (
+	ExportJSON = "json"
+	ExportCBOR = "cbor"
+)
+
+func init() {
+	cbor.RegisterCborType(Export{})
+	cbor.RegisterCborType(ExportedPin{})
+}
+
+// Export is a portable description of the pins of a node.
+type Export struct {
+	Version int
+	Pins    []ExportedPin
+}
+
+// ExportedPin is a single direct, recursive or depth limited pin, along
+// with its name and metadata. Cids and times are stored as strings so the
+// export can be read without knowledge of their binary encoding.
+type ExportedPin struct {
+	Cid      string
+	Mode     string
+	MaxDepth int               `json:",omitempty"`
+	Name     string            `json:",omitempty"`
+	Meta     map[string]string `json:",omitempty"`
+	Expires  string            `json:",omitempty"`
+}
+
+// Key returns the cid of the pinned object.
+func (e ExportedPin) Key() (cid.Cid, error) {
+	return cid.Decode(e.Cid)
+}
+
+// PinMeta returns the name and metadata of the pin.
+func (e ExportedPin) PinMeta() (PinMeta, error) {
+	m := PinMeta{Name: e.Name, Meta: e.Meta}
+	if e.Expires != "" {
+		t, err := time.Parse(time.RFC3339, e.Expires)
+		if err != nil {
+			return PinMeta{}, fmt.Errorf("invalid expiry time for %s: %s", e.Cid, err)
+		}
+		m.Expires = t
+	}
+	return m, nil
+}
+
+// ExportPins returns the direct, recursive and depth limited pins of the
+// given pinner, sorted by cid. Pins which have expired are left out.
+func ExportPins(p Pinner) *Export {
+	now := time.Now()
+	var pins []ExportedPin
+
+	add := func(c cid.Cid, mode Mode, depth int) {
+		meta, _ := p.Meta(c)
+		if meta.ExpiredAt(now) {
+			return
+		}
+		modeStr, _ := ModeToString(mode)
+		e := ExportedPin{
+			Cid:      c.String(),
+			Mode:     modeStr,
+			MaxDepth: depth,
+			Name:     meta.Name,
+			Meta:     meta.Meta,
+		}
+		if !meta.Expires.IsZero() {
+			e.Expires = meta.Expires.UTC().Format(time.RFC3339)
+		}
+		pins = append(pins, e)
+	}
+
+	for _, c := range p.RecursiveKeys() {
+		add(c, Recursive, 0)
+	}
+	for c, depth := range p.DepthLimitedKeys() {
+		add(c, DepthLimited, depth)
+	}
+	for _, c := range p.DirectKeys() {
+		add(c, Direct, 0)
+	}
+
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].Cid < pins[j].Cid
+	})
+
+	return &Export{Version: ExportVersion, Pins: pins}
+}
+
+// WriteExport encodes the export to w in the given format.
+func WriteExport(w io.Writer, e *Export, format string) error {
+	switch format {
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	case ExportCBOR:
+		data, err := cbor.DumpObject(e)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown pin export format %q", format)
+	}
+}
+
+// ReadExport decodes an export written by WriteExport in the given format
+// from r, and checks that its pins are valid.
+func ReadExport(r io.Reader, format string) (*Export, error) {
+	e := new(Export)
+	switch format {
+	case ExportJSON:
+		if err := json.NewDecoder(r).Decode(e); err != nil {
+			return nil, err
+		}
+	case ExportCBOR:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := cbor.DecodeInto(data, e); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown pin export format %q", format)
+	}
+
+	if e.Version != ExportVersion {
+		return nil, fmt.Errorf("unsupported pin export version %d", e.Version)
+	}
+
+	for _, p := range e.Pins {
+		if _, err := p.Key(); err != nil {
+			return nil, fmt.Errorf("invalid cid %q: %s", p.Cid, err)
+		}
+		if _, err := p.PinMeta(); err != nil {
+			return nil, err
+		}
+		switch p.Mode {
+		case linkRecursive, linkDirect:
+		case linkDepthLimited:
+			if p.MaxDepth < 1 {
+				return nil, fmt.Errorf("invalid max depth %d for %s", p.MaxDepth, p.Cid)
+			}
+		default:
+			return nil, fmt.Errorf("invalid pin mode %q for %s", p.Mode, p.Cid)
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,105 @@
+package pin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	bs "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	c, ck := randNode()
+	d, dk := randNode()
+	for _, nd := range []*mdag.ProtoNode{a, b, c, d} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, b, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PinWithDepth(ctx, c, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, d, true); err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	meta := PinMeta{Name: "project-a", Meta: map[string]string{"owner": "alice"}, Expires: expires}
+	if err := p.SetMeta(ak, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMeta(dk, PinMeta{Expires: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{ExportJSON, ExportCBOR} {
+		var buf bytes.Buffer
+		if err := WriteExport(&buf, ExportPins(p), format); err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := ReadExport(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(e.Pins) != 3 {
+			t.Fatalf("%s: expected the 3 pins which did not expire, got %d", format, len(e.Pins))
+		}
+
+		pins := make(map[string]ExportedPin)
+		for _, ep := range e.Pins {
+			pins[ep.Cid] = ep
+		}
+
+		ea := pins[ak.String()]
+		if ea.Mode != "recursive" || ea.Name != "project-a" || ea.Meta["owner"] != "alice" {
+			t.Errorf("%s: unexpected exported pin: %#v", format, ea)
+		}
+		m, err := ea.PinMeta()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.Expires.Equal(expires) {
+			t.Errorf("%s: unexpected expiry time %s", format, m.Expires)
+		}
+
+		if eb := pins[bk.String()]; eb.Mode != "direct" {
+			t.Errorf("%s: unexpected exported pin: %#v", format, eb)
+		}
+
+		if ec := pins[ck.String()]; ec.Mode != "depth-limited" || ec.MaxDepth != 2 {
+			t.Errorf("%s: unexpected exported pin: %#v", format, ec)
+		}
+	}
+
+	_, err := ReadExport(bytes.NewBufferString(`{"Version":1,"Pins":[{"Cid":"`+ak.String()+`","Mode":"indirect"}]}`), ExportJSON)
+	if err == nil {
+		t.Fatal("expected importing an indirect pin to fail")
+	}
+}
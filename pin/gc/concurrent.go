@@ -0,0 +1,290 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	dstore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+// sweepBatchSize is the number of blocks ConcurrentGC deletes each time it
+// takes the GC lock.
+const sweepBatchSize = 1024
+
+// ErrGCRunning is returned when a concurrent garbage collection is started
+// while another one is running on the same blockstore.
+var ErrGCRunning = errors.New("a concurrent garbage collection is already running")
+
+// TrackingBlockstore wraps a GCBlockstore and records the blocks written to
+// it while a concurrent garbage collection runs, so they are not swept.
+type TrackingBlockstore struct {
+	bstore.GCBlockstore
+
+	lk      sync.Mutex
+	written *cid.Set // nil unless a concurrent garbage collection runs
+}
+
+// NewTrackingBlockstore wraps the given blockstore so that it can be
+// garbage collected with ConcurrentGC.
+func NewTrackingBlockstore(bs bstore.GCBlockstore) *TrackingBlockstore {
+	return &TrackingBlockstore{GCBlockstore: bs}
+}
+
+// Put implements Blockstore.Put.
+func (bs *TrackingBlockstore) Put(b blocks.Block) error {
+	bs.track(b.Cid())
+	return bs.GCBlockstore.Put(b)
+}
+
+// PutMany implements Blockstore.PutMany.
+func (bs *TrackingBlockstore) PutMany(bls []blocks.Block) error {
+	for _, b := range bls {
+		bs.track(b.Cid())
+	}
+	return bs.GCBlockstore.PutMany(bls)
+}
+
+func (bs *TrackingBlockstore) track(c cid.Cid) {
+	bs.lk.Lock()
+	if bs.written != nil {
+		bs.written.Add(c)
+	}
+	bs.lk.Unlock()
+}
+
+func (bs *TrackingBlockstore) startTracking() error {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	if bs.written != nil {
+		return ErrGCRunning
+	}
+	bs.written = cid.NewSet()
+	return nil
+}
+
+func (bs *TrackingBlockstore) stopTracking() {
+	bs.lk.Lock()
+	bs.written = nil
+	bs.lk.Unlock()
+}
+
+func (bs *TrackingBlockstore) wasWritten(c cid.Cid) bool {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	return bs.written != nil && bs.written.Has(c)
+}
+
+// ConcurrentGC works like GC, but only holds the GC lock for short periods
+// of time so that blocks can be added while it runs.
+//
+// The roots are taken under the lock, then the marked set is computed
+// without holding it. Blocks written from that point on are never swept.
+// The blockstore is then swept in batches: each batch takes the lock, marks
+// the descendants of the pins and best effort roots created since the roots
+// were last taken, and removes the unmarked blocks of the batch. The nodes
+// marked without their descendants, by direct and depth limited pins, are
+// kept in memory so that new roots reaching them mark their descendants.
+//
+// bestEffortRoots is called every time the roots are taken, since they can
+// change while the garbage collection runs.
+func ConcurrentGC(ctx context.Context, bs *TrackingBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots func() ([]cid.Cid, error), opts ...Option) <-chan Result {
+	output := make(chan Result, 128)
+	o := newOptions(opts)
+
+	go func() {
+		defer close(output)
+
+		emitErr := func(err error) {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+
+		if err := bs.startTracking(); err != nil {
+			emitErr(err)
+			return
+		}
+		defer bs.stopTracking()
+
+		takeRoots := func() (*gcRoots, error) {
+			beRoots, err := bestEffortRoots()
+			if err != nil {
+				return nil, err
+			}
+			return newGCRoots(pn, beRoots), nil
+		}
+
+		elock := log.EventBegin(ctx, "GC.lockWait")
+		unlocker := bs.GCLock()
+		elock.Done()
+		roots, err := takeRoots()
+		unlocker.Unlock()
+		if err != nil {
+			emitErr(err)
+			return
+		}
+
+		emark := log.EventBegin(ctx, "GC.mark")
+		ds := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+		gcs, err := o.newMarkSet()
+		if err != nil {
+			emitErr(err)
+			return
+		}
+		defer closeMarkSet(gcs)
+		// the nodes marked without their descendants are remembered, so
+		// that the roots taken later mark their descendants if they
+		// reach them
+		shallow := cid.NewSet()
+		if err := markRoots(ctx, ds, roots, gcs, shallow, output); err != nil {
+			emitErr(err)
+			return
+		}
+		emark.Done()
+
+		esweep := log.EventBegin(ctx, "GC.sweep")
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			emitErr(err)
+			return
+		}
+
+		errors := false
+		var removed uint64
+
+		// sweep removes the unmarked blocks of the batch. It returns false
+		// if the garbage collection must stop.
+		sweep := func(batch []cid.Cid) bool {
+			unlocker := bs.GCLock()
+			defer unlocker.Unlock()
+
+			current, err := takeRoots()
+			if err != nil {
+				emitErr(err)
+				return false
+			}
+			if err := markRoots(ctx, ds, current.newSince(roots), gcs, shallow, output); err != nil {
+				emitErr(err)
+				return false
+			}
+			roots = current
+
+			for _, k := range batch {
+				if gcs.Has(k) || bs.wasWritten(k) {
+					continue
+				}
+				size := blockSize(bs, k)
+				removed++
+				if err := bs.DeleteBlock(k); err != nil {
+					errors = true
+					output <- Result{Error: &CannotDeleteBlockError{k, err}}
+					// continue as error is non-fatal
+					continue
+				}
+				select {
+				case output <- Result{KeyRemoved: k, Size: size}:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		batch := make([]cid.Cid, 0, sweepBatchSize)
+	loop:
+		for {
+			select {
+			case k, ok := <-keychan:
+				if !ok {
+					break loop
+				}
+				if gcs.Has(k) || bs.wasWritten(k) {
+					continue
+				}
+				batch = append(batch, k)
+				if len(batch) < sweepBatchSize {
+					continue
+				}
+				if !sweep(batch) {
+					return
+				}
+				batch = batch[:0]
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(batch) > 0 && !sweep(batch) {
+			return
+		}
+
+		esweep.Append(logging.LoggableMap{
+			"whiteSetSize": fmt.Sprintf("%d", removed),
+		})
+		esweep.Done()
+		if err := markSetErr(gcs); err != nil {
+			emitErr(err)
+			return
+		}
+		if errors {
+			emitErr(ErrCannotDeleteSomeBlocks)
+			return
+		}
+
+		defer log.EventBegin(ctx, "GC.datastore").Done()
+		gds, ok := dstor.(dstore.GCDatastore)
+		if !ok {
+			return
+		}
+
+		if err := gds.CollectGarbage(); err != nil {
+			emitErr(err)
+		}
+	}()
+
+	return output
+}
+
+// newSince returns the roots which are not part of old. Depth limited pins
+// are kept if their depth increased.
+func (r *gcRoots) newSince(old *gcRoots) *gcRoots {
+	without := func(keys, oldKeys []cid.Cid) []cid.Cid {
+		set := cid.NewSet()
+		for _, k := range oldKeys {
+			set.Add(k)
+		}
+		var out []cid.Cid
+		for _, k := range keys {
+			if !set.Has(k) {
+				out = append(out, k)
+			}
+		}
+		return out
+	}
+
+	depth := make(map[cid.Cid]int)
+	for c, d := range r.depth {
+		if od, ok := old.depth[c]; !ok || od < d {
+			depth[c] = d
+		}
+	}
+
+	return &gcRoots{
+		recursive:  without(r.recursive, old.recursive),
+		depth:      depth,
+		direct:     without(r.direct, old.direct),
+		internal:   without(r.internal, old.internal),
+		bestEffort: without(r.bestEffort, old.bestEffort),
+	}
+}
@@ -0,0 +1,145 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestConcurrentGC(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewTrackingBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	child := dag.NodeWithData([]byte("child"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	garbage := dag.NodeWithData([]byte("garbage"))
+	pinnedLater := dag.NodeWithData([]byte("pinned during the gc"))
+	writtenLater := dag.NodeWithData([]byte("written during the gc"))
+
+	for _, nd := range []*dag.ProtoNode{child, root, garbage, pinnedLater} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pn.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the best effort roots are first taken before the marking, the next
+	// calls simulate a pin and an add happening after it
+	calls := 0
+	roots := func() ([]cid.Cid, error) {
+		calls++
+		if calls == 2 {
+			if err := pn.Pin(ctx, pinnedLater, false); err != nil {
+				return nil, err
+			}
+			if err := dserv.Add(ctx, writtenLater); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	removed := make(map[string]bool)
+	for res := range ConcurrentGC(ctx, bs, dstore, pn, roots) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed[res.KeyRemoved.String()] = true
+	}
+
+	if len(removed) != 1 || !removed[garbage.Cid().String()] {
+		t.Fatalf("expected only the unpinned block to be removed, got %v", removed)
+	}
+
+	for _, nd := range []*dag.ProtoNode{child, root, pinnedLater, writtenLater} {
+		has, err := bs.Has(nd.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("block %s was removed", nd.Cid())
+		}
+	}
+
+	if bs.wasWritten(writtenLater.Cid()) {
+		t.Error("expected writes to stop being tracked after the gc")
+	}
+}
+
+func TestConcurrentGCRewalksDirectPins(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewTrackingBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	child := dag.NodeWithData([]byte("child"))
+	direct := dag.NodeWithData([]byte("direct"))
+	if err := direct.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	mfsRoot := dag.NodeWithData([]byte("mfs root"))
+	if err := mfsRoot.AddNodeLink("direct", direct); err != nil {
+		t.Fatal(err)
+	}
+	garbage := dag.NodeWithData([]byte("garbage"))
+
+	for _, nd := range []*dag.ProtoNode{child, direct, mfsRoot, garbage} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pn.Pin(ctx, direct, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the directly pinned node is copied to the files API once the marking
+	// is done, which reaches its child through a node already marked
+	calls := 0
+	roots := func() ([]cid.Cid, error) {
+		calls++
+		if calls == 1 {
+			return nil, nil
+		}
+		return []cid.Cid{mfsRoot.Cid()}, nil
+	}
+
+	removed := make(map[string]bool)
+	for res := range ConcurrentGC(ctx, bs, dstore, pn, roots) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed[res.KeyRemoved.String()] = true
+	}
+
+	if len(removed) != 1 || !removed[garbage.Cid().String()] {
+		t.Fatalf("expected only the unpinned block to be removed, got %v", removed)
+	}
+}
@@ -0,0 +1,423 @@
+package gc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	dstore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// Eviction policies understood by Evict.
+const (
+	// EvictLRU removes the least recently accessed blocks first.
+	EvictLRU = "lru"
+	// EvictLFU removes the least frequently accessed blocks first.
+	EvictLFU = "lfu"
+)
+
+// accessDatastorePrefix is the prefix under which the access records of the
+// blocks are stored, one key per block.
+var accessDatastorePrefix = dstore.NewKey("/local/gc/access")
+
+// accessFlushSize is the number of pending access records which triggers a
+// flush in the background.
+const accessFlushSize = 1024
+
+// accessFlushInterval is the interval at which the pending access records
+// are flushed, however few they are.
+const accessFlushInterval = time.Minute
+
+// AccessRecord holds the time a block was last accessed and the number of
+// times it was accessed.
+type AccessRecord struct {
+	LastAccess time.Time
+	Count      uint64
+}
+
+func (r AccessRecord) bytes() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, uint64(r.LastAccess.UnixNano()))
+	binary.BigEndian.PutUint64(b[8:], r.Count)
+	return b
+}
+
+func parseAccessRecord(b []byte) (AccessRecord, error) {
+	if len(b) != 16 {
+		return AccessRecord{}, fmt.Errorf("invalid access record of %d bytes", len(b))
+	}
+	return AccessRecord{
+		LastAccess: time.Unix(0, int64(binary.BigEndian.Uint64(b))),
+		Count:      binary.BigEndian.Uint64(b[8:]),
+	}, nil
+}
+
+func accessKey(c cid.Cid) dstore.Key {
+	return accessDatastorePrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// AccessBlockstore wraps a GCBlockstore and records when the blocks are read
+// and written, so that Evict can remove the blocks which are not used.
+//
+// Records are kept in memory and written to the datastore in batches, every
+// accessFlushInterval and when the blockstore is closed.
+type AccessBlockstore struct {
+	bstore.GCBlockstore
+
+	dstore dstore.Batching
+
+	// flushLk serializes flushes, which read and update the stored records,
+	// with the removal of the records of deleted blocks
+	flushLk sync.Mutex
+
+	lk       sync.Mutex
+	pending  map[cid.Cid]AccessRecord
+	flushing bool
+
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+// NewAccessBlockstore wraps the given blockstore, storing the access records
+// in the given datastore. Close must be called to stop the periodic flushes
+// and write the last records.
+func NewAccessBlockstore(bs bstore.GCBlockstore, d dstore.Batching) *AccessBlockstore {
+	abs := &AccessBlockstore{
+		GCBlockstore: bs,
+		dstore:       d,
+		pending:      make(map[cid.Cid]AccessRecord),
+		closing:      make(chan struct{}),
+	}
+	go abs.flushLoop()
+	return abs
+}
+
+func (bs *AccessBlockstore) flushLoop() {
+	ticker := time.NewTicker(accessFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := bs.Flush(); err != nil {
+				log.Errorf("flushing block access records: %s", err)
+			}
+		case <-bs.closing:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flushes and writes the pending access records.
+func (bs *AccessBlockstore) Close() error {
+	bs.closeOnce.Do(func() {
+		close(bs.closing)
+	})
+	return bs.Flush()
+}
+
+// Get implements Blockstore.Get.
+func (bs *AccessBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	b, err := bs.GCBlockstore.Get(c)
+	if err == nil {
+		bs.record(c)
+	}
+	return b, err
+}
+
+// Put implements Blockstore.Put.
+func (bs *AccessBlockstore) Put(b blocks.Block) error {
+	if err := bs.GCBlockstore.Put(b); err != nil {
+		return err
+	}
+	bs.record(b.Cid())
+	return nil
+}
+
+// PutMany implements Blockstore.PutMany.
+func (bs *AccessBlockstore) PutMany(bls []blocks.Block) error {
+	if err := bs.GCBlockstore.PutMany(bls); err != nil {
+		return err
+	}
+	for _, b := range bls {
+		bs.record(b.Cid())
+	}
+	return nil
+}
+
+// DeleteBlock implements Blockstore.DeleteBlock, and forgets the accesses
+// to the block.
+func (bs *AccessBlockstore) DeleteBlock(c cid.Cid) error {
+	if err := bs.GCBlockstore.DeleteBlock(c); err != nil {
+		return err
+	}
+
+	// a flush in progress could otherwise write the record back
+	bs.flushLk.Lock()
+	defer bs.flushLk.Unlock()
+
+	bs.lk.Lock()
+	delete(bs.pending, c)
+	bs.lk.Unlock()
+
+	err := bs.dstore.Delete(accessKey(c))
+	if err != nil && err != dstore.ErrNotFound {
+		log.Warningf("removing the access record of %s: %s", c, err)
+	}
+	return nil
+}
+
+func (bs *AccessBlockstore) record(c cid.Cid) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	r := bs.pending[c]
+	r.LastAccess = time.Now()
+	r.Count++
+	bs.pending[c] = r
+
+	if len(bs.pending) >= accessFlushSize && !bs.flushing {
+		bs.flushing = true
+		go func() {
+			if err := bs.Flush(); err != nil {
+				log.Errorf("flushing block access records: %s", err)
+			}
+			bs.lk.Lock()
+			bs.flushing = false
+			bs.lk.Unlock()
+		}()
+	}
+}
+
+// Flush writes the pending access records to the datastore.
+func (bs *AccessBlockstore) Flush() error {
+	bs.flushLk.Lock()
+	defer bs.flushLk.Unlock()
+
+	bs.lk.Lock()
+	pending := bs.pending
+	bs.pending = make(map[cid.Cid]AccessRecord)
+	bs.lk.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batch, err := bs.dstore.Batch()
+	if err != nil {
+		return err
+	}
+
+	for c, r := range pending {
+		// the counts of the pending records only cover the accesses since
+		// the last flush
+		stored, err := bs.accessRecord(c)
+		if err != nil {
+			return err
+		}
+		r.Count += stored.Count
+		if stored.LastAccess.After(r.LastAccess) {
+			r.LastAccess = stored.LastAccess
+		}
+
+		if err := batch.Put(accessKey(c), r.bytes()); err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit()
+}
+
+func (bs *AccessBlockstore) accessRecord(c cid.Cid) (AccessRecord, error) {
+	b, err := bs.dstore.Get(accessKey(c))
+	switch err {
+	case nil:
+		return parseAccessRecord(b)
+	case dstore.ErrNotFound:
+		return AccessRecord{}, nil
+	default:
+		return AccessRecord{}, err
+	}
+}
+
+// AccessRecords flushes the pending records, then returns the access
+// records of every block.
+func (bs *AccessBlockstore) AccessRecords() (map[cid.Cid]AccessRecord, error) {
+	if err := bs.Flush(); err != nil {
+		return nil, err
+	}
+
+	res, err := bs.dstore.Query(dsq.Query{Prefix: accessDatastorePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	records := make(map[cid.Cid]AccessRecord)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := dstore.RawKey(r.Key)
+		c, err := dshelp.DsKeyToCid(dstore.NewKey(k.BaseNamespace()))
+		if err != nil {
+			log.Errorf("decoding cid from access key %s: %s", k, err)
+			continue
+		}
+		rec, err := parseAccessRecord(r.Value)
+		if err != nil {
+			log.Errorf("decoding access record of %s: %s", c, err)
+			continue
+		}
+		records[c] = rec
+	}
+	return records, nil
+}
+
+// evictionCandidate is an unmarked block which Evict may remove.
+type evictionCandidate struct {
+	key    cid.Cid
+	size   uint64
+	record AccessRecord
+}
+
+// Evict removes the blocks GC would remove, in the order given by the
+// eviction policy, until at least toFree bytes were freed. Blocks which were
+// never accessed since access tracking was enabled are removed first. Like
+// GC, it holds the GC lock while it runs.
+func Evict(ctx context.Context, bs *AccessBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, policy string, toFree uint64, opts ...Option) <-chan Result {
+	output := make(chan Result, 128)
+
+	var less func(a, b AccessRecord) bool
+	switch policy {
+	case EvictLRU:
+		less = func(a, b AccessRecord) bool {
+			if !a.LastAccess.Equal(b.LastAccess) {
+				return a.LastAccess.Before(b.LastAccess)
+			}
+			return a.Count < b.Count
+		}
+	case EvictLFU:
+		less = func(a, b AccessRecord) bool {
+			if a.Count != b.Count {
+				return a.Count < b.Count
+			}
+			return a.LastAccess.Before(b.LastAccess)
+		}
+	default:
+		output <- Result{Error: fmt.Errorf("unknown eviction policy %q", policy)}
+		close(output)
+		return output
+	}
+
+	elock := log.EventBegin(ctx, "GC.lockWait")
+	unlocker := bs.GCLock()
+	elock.Done()
+
+	go func() {
+		defer close(output)
+		defer unlocker.Unlock()
+
+		emitErr := func(err error) {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+
+		// walk the pins without recording accesses to their blocks
+		inner := bs.GCBlockstore
+		ds := dag.NewDAGService(bserv.New(inner, offline.Exchange(inner)))
+		gcs, err := coloredSet(ctx, pn, ds, bestEffortRoots, output, newOptions(opts))
+		if err != nil {
+			emitErr(err)
+			return
+		}
+		defer closeMarkSet(gcs)
+
+		records, err := bs.AccessRecords()
+		if err != nil {
+			emitErr(err)
+			return
+		}
+
+		keychan, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			emitErr(err)
+			return
+		}
+
+		var candidates []evictionCandidate
+		for k := range keychan {
+			if gcs.Has(k) {
+				continue
+			}
+			candidates = append(candidates, evictionCandidate{
+				key:    k,
+				size:   blockSize(bs, k),
+				record: records[k],
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err := markSetErr(gcs); err != nil {
+			emitErr(err)
+			return
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return less(candidates[i].record, candidates[j].record)
+		})
+
+		defer log.EventBegin(ctx, "GC.evict").Done()
+
+		errors := false
+		var freed uint64
+		for _, cand := range candidates {
+			if freed >= toFree {
+				break
+			}
+			if err := bs.DeleteBlock(cand.key); err != nil {
+				errors = true
+				output <- Result{Error: &CannotDeleteBlockError{cand.key, err}}
+				// continue as error is non-fatal
+				continue
+			}
+			freed += cand.size
+			select {
+			case output <- Result{KeyRemoved: cand.key, Size: cand.size}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if errors {
+			emitErr(ErrCannotDeleteSomeBlocks)
+			return
+		}
+
+		gds, ok := bs.dstore.(dstore.GCDatastore)
+		if !ok {
+			return
+		}
+		if err := gds.CollectGarbage(); err != nil {
+			emitErr(err)
+		}
+	}()
+
+	return output
+}
@@ -0,0 +1,137 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestEvict(t *testing.T) {
+	ctx := context.Background()
+
+	for _, policy := range []string{EvictLRU, EvictLFU} {
+		dstore := dssync.MutexWrap(ds.NewMapDatastore())
+		bs := NewAccessBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()), dstore)
+		dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+		pn := pin.NewPinner(dstore, dserv, dserv)
+
+		pinned := dag.NodeWithData([]byte("pinned"))
+		cold := dag.NodeWithData([]byte("cold"))
+		warm := dag.NodeWithData([]byte("warm"))
+		hot := dag.NodeWithData([]byte("hot"))
+		for _, nd := range []*dag.ProtoNode{pinned, cold, warm, hot} {
+			if err := dserv.Add(ctx, nd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pn.Pin(ctx, pinned, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := pn.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the hot block is read last and most often, the warm one is read
+		// once, the cold one is never read
+		if _, err := dserv.Get(ctx, warm.Cid()); err != nil {
+			t.Fatal(err)
+		}
+		if err := bs.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := dserv.Get(ctx, hot.Cid()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		toFree := uint64(len(cold.RawData()) + len(warm.RawData()))
+		var freed uint64
+		removed := make(map[string]bool)
+		for res := range Evict(ctx, bs, pn, nil, policy, toFree) {
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+			removed[res.KeyRemoved.String()] = true
+			freed += res.Size
+		}
+
+		if len(removed) != 2 || !removed[cold.Cid().String()] || !removed[warm.Cid().String()] {
+			t.Fatalf("%s: expected the cold and warm blocks to be evicted, got %v", policy, removed)
+		}
+		if freed != toFree {
+			t.Errorf("%s: expected %d bytes to be freed, got %d", policy, toFree, freed)
+		}
+
+		for _, nd := range []*dag.ProtoNode{pinned, hot} {
+			has, err := bs.Has(nd.Cid())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !has {
+				t.Errorf("%s: block %s was evicted", policy, nd.Cid())
+			}
+		}
+
+		records, err := bs.AccessRecords()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := records[hot.Cid()]; r.Count != 4 {
+			t.Errorf("%s: expected the hot block to be accessed 4 times, got %d", policy, r.Count)
+		}
+		if _, ok := records[cold.Cid()]; ok {
+			t.Errorf("%s: expected the access record of an evicted block to be removed", policy)
+		}
+	}
+}
+
+func TestAccessBlockstoreClose(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewAccessBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()), dstore)
+
+	kept := dag.NodeWithData([]byte("kept"))
+	deleted := dag.NodeWithData([]byte("deleted"))
+	for _, nd := range []*dag.ProtoNode{kept, deleted} {
+		if err := bs.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*dag.ProtoNode{kept, deleted} {
+		if _, err := bs.Get(nd.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bs.DeleteBlock(deleted.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pending records are written on close
+	if err := bs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewAccessBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()), dstore)
+	defer reopened.Close()
+	records, err := reopened.AccessRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected the record of a single block, got %d", len(records))
+	}
+	if r := records[kept.Cid()]; r.Count != 2 {
+		t.Errorf("expected the block to have been accessed twice, got %d", r.Count)
+	}
+}
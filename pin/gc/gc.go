@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	dagutils "github.com/ipfs/go-ipfs/dagutils"
 	pin "github.com/ipfs/go-ipfs/pin"
 	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
 	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
@@ -23,9 +25,11 @@ import (
 var log = logging.Logger("gc")
 
 // Result represents an incremental output from a garbage collection
-// run.  It contains either an error, or the cid of a removed object.
+// run.  It contains either an error, or the cid of a removed object along
+// with its size.
 type Result struct {
 	KeyRemoved cid.Cid
+	Size       uint64
 	Error      error
 }
 
@@ -35,10 +39,27 @@ type Result struct {
 // - bestEffortRoots, plus all of its descendants (recursively)
 // - all directly pinned blocks
 // - all blocks utilized internally by the pinner
+// - all depth limited pins, plus their descendants down to the pin's depth
+//
+// Pins which have expired are ignored, even if they have not been removed
+// from the pinner yet.
 //
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
-func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+//
+// The marked set is kept in memory unless the DiskMarking option is given.
+func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, opts ...Option) <-chan Result {
+	return collect(ctx, bs, dstor, pn, bestEffortRoots, false, newOptions(opts))
+}
+
+// DryRun performs the mark phase of GC and returns the blocks GC would
+// remove, along with their size, without removing them. Like GC, it holds
+// the GC lock while it runs.
+func DryRun(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, opts ...Option) <-chan Result {
+	return collect(ctx, bs, nil, pn, bestEffortRoots, true, newOptions(opts))
+}
+
+func collect(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, dryRun bool, opts *options) <-chan Result {
 
 	elock := log.EventBegin(ctx, "GC.lockWait")
 	unlocker := bs.GCLock()
@@ -56,7 +77,7 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 		defer unlocker.Unlock()
 		defer elock.Done()
 
-		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		gcs, err := coloredSet(ctx, pn, ds, bestEffortRoots, output, opts)
 		if err != nil {
 			select {
 			case output <- Result{Error: err}:
@@ -64,6 +85,7 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			}
 			return
 		}
+		defer closeMarkSet(gcs)
 		emark.Append(logging.LoggableMap{
 			"blackSetSize": fmt.Sprintf("%d", gcs.Len()),
 		})
@@ -90,17 +112,20 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 					break loop
 				}
 				if !gcs.Has(k) {
-					err := bs.DeleteBlock(k)
+					size := blockSize(bs, k)
 					removed++
-					if err != nil {
-						errors = true
-						output <- Result{Error: &CannotDeleteBlockError{k, err}}
-						//log.Errorf("Error removing key from blockstore: %s", err)
-						// continue as error is non-fatal
-						continue loop
+					if !dryRun {
+						err := bs.DeleteBlock(k)
+						if err != nil {
+							errors = true
+							output <- Result{Error: &CannotDeleteBlockError{k, err}}
+							//log.Errorf("Error removing key from blockstore: %s", err)
+							// continue as error is non-fatal
+							continue loop
+						}
 					}
 					select {
-					case output <- Result{KeyRemoved: k}:
+					case output <- Result{KeyRemoved: k, Size: size}:
 					case <-ctx.Done():
 						break loop
 					}
@@ -113,6 +138,13 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			"whiteSetSize": fmt.Sprintf("%d", removed),
 		})
 		esweep.Done()
+		if err := markSetErr(gcs); err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
 		if errors {
 			select {
 			case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
@@ -121,6 +153,10 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			}
 		}
 
+		if dryRun {
+			return
+		}
+
 		defer log.EventBegin(ctx, "GC.datastore").Done()
 		gds, ok := dstor.(dstore.GCDatastore)
 		if !ok {
@@ -140,29 +176,20 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 	return output
 }
 
-// Descendants recursively finds all the descendants of the given roots and
-// adds them to the given cid.Set, using the provided dag.GetLinks function
-// to walk the tree.
-func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots []cid.Cid) error {
-	verifyGetLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
-		err := verifcid.ValidateCid(c)
-		if err != nil {
-			return nil, err
-		}
-
-		return getLinks(ctx, c)
+// blockSize returns the size of the given block, 0 if it can't be read.
+func blockSize(bs bstore.Blockstore, c cid.Cid) uint64 {
+	size, err := bs.GetSize(c)
+	if err != nil || size < 0 {
+		return 0
 	}
+	return uint64(size)
+}
 
-	verboseCidError := func(err error) error {
-		if strings.Contains(err.Error(), verifcid.ErrBelowMinimumHashLength.Error()) ||
-			strings.Contains(err.Error(), verifcid.ErrPossiblyInsecureHashFunction.Error()) {
-			err = fmt.Errorf("\"%s\"\nPlease run 'ipfs pin verify'"+
-				" to list insecure hashes. If you want to read them,"+
-				" please downgrade your go-ipfs to 0.4.13\n", err)
-			log.Error(err)
-		}
-		return err
-	}
+// Descendants recursively finds all the descendants of the given roots and
+// adds them to the given set, using the provided dag.GetLinks function
+// to walk the tree.
+func Descendants(ctx context.Context, getLinks dag.GetLinks, set MarkSet, roots []cid.Cid) error {
+	verifyGetLinks := verifiedGetLinks(getLinks)
 
 	for _, c := range roots {
 		set.Add(c)
@@ -179,13 +206,118 @@ func Descendants(ctx context.Context, getLinks dag.GetLinks, set *cid.Set, roots
 	return nil
 }
 
+// DepthDescendants finds the descendants of the given roots down to the
+// depth associated with each root and adds them, along with the roots, to
+// the given set.
+func DepthDescendants(ctx context.Context, getLinks dag.GetLinks, set MarkSet, roots map[cid.Cid]int) error {
+	verifyGetLinks := verifiedGetLinks(getLinks)
+
+	for c, depth := range roots {
+		set.Add(c)
+
+		err := dagutils.EnumerateChildrenDepth(ctx, verifyGetLinks, c, depth, set.Visit)
+		if err != nil {
+			return verboseCidError(err)
+		}
+	}
+
+	return nil
+}
+
+// verifiedGetLinks wraps getLinks so that it refuses insecure cids.
+func verifiedGetLinks(getLinks dag.GetLinks) dag.GetLinks {
+	return func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		err := verifcid.ValidateCid(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return getLinks(ctx, c)
+	}
+}
+
+func verboseCidError(err error) error {
+	if strings.Contains(err.Error(), verifcid.ErrBelowMinimumHashLength.Error()) ||
+		strings.Contains(err.Error(), verifcid.ErrPossiblyInsecureHashFunction.Error()) {
+		err = fmt.Errorf("\"%s\"\nPlease run 'ipfs pin verify'"+
+			" to list insecure hashes. If you want to read them,"+
+			" please downgrade your go-ipfs to 0.4.13\n", err)
+		log.Error(err)
+	}
+	return err
+}
+
 // ColoredSet computes the set of nodes in the graph that are pinned by the
 // pins in the given pinner.
-func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
-	// KeySet currently implemented in memory, in the future, may be bloom filter or
-	// disk backed to conserve memory.
+//
+// The set is kept in memory unless the DiskMarking option is given, in
+// which case it must be released by the caller with Close when it
+// implements it.
+func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result, opts ...Option) (MarkSet, error) {
+	return coloredSet(ctx, pn, ng, bestEffortRoots, output, newOptions(opts))
+}
+
+func coloredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result, opts *options) (MarkSet, error) {
+	gcs, err := opts.newMarkSet()
+	if err != nil {
+		return nil, err
+	}
+	if err := markRoots(ctx, ng, newGCRoots(pn, bestEffortRoots), gcs, nil, output); err != nil {
+		closeMarkSet(gcs)
+		return nil, err
+	}
+	return gcs, nil
+}
+
+// gcRoots holds the roots from which the marked set is computed.
+type gcRoots struct {
+	recursive  []cid.Cid
+	depth      map[cid.Cid]int
+	direct     []cid.Cid
+	internal   []cid.Cid
+	bestEffort []cid.Cid
+}
+
+// newGCRoots takes the current roots of the given pinner, leaving the
+// expired pins out.
+func newGCRoots(pn pin.Pinner, bestEffortRoots []cid.Cid) *gcRoots {
+	expired := cid.NewSet()
+	for _, c := range pn.Expired(time.Now()) {
+		expired.Add(c)
+	}
+
+	depthPins := pn.DepthLimitedKeys()
+	for c := range depthPins {
+		if expired.Has(c) {
+			delete(depthPins, c)
+		}
+	}
+
+	return &gcRoots{
+		recursive:  withoutExpired(pn.RecursiveKeys(), expired),
+		depth:      depthPins,
+		direct:     withoutExpired(pn.DirectKeys(), expired),
+		internal:   pn.InternalPins(),
+		bestEffort: bestEffortRoots,
+	}
+}
+
+// markRoots adds the roots and their descendants to the given set. Nodes
+// already in the set are not walked again, so the set can be extended with
+// new roots.
+//
+// When shallow is not nil, it records the nodes marked without all their
+// descendants, by direct and depth limited pins, and the walks of the
+// recursive pins and best effort roots go through them, so that extending
+// the set marks their descendants too.
+func markRoots(ctx context.Context, ng ipld.NodeGetter, roots *gcRoots, gcs MarkSet, shallow *cid.Set, output chan<- Result) error {
+	full, limited := gcs, gcs
+	if shallow != nil {
+		full = &rewalkMarkSet{MarkSet: gcs, shallow: shallow}
+		limited = &shallowMarkSet{MarkSet: gcs, shallow: shallow}
+	}
+
 	errors := false
-	gcs := cid.NewSet()
 	getLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
 		if err != nil {
@@ -198,13 +330,13 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
-	err := Descendants(ctx, getLinks, gcs, pn.RecursiveKeys())
+	err := Descendants(ctx, getLinks, full, roots.recursive)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
@@ -220,35 +352,104 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
-	err = Descendants(ctx, bestEffortGetLinks, gcs, bestEffortRoots)
+	err = Descendants(ctx, bestEffortGetLinks, full, roots.bestEffort)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
-	for _, k := range pn.DirectKeys() {
-		gcs.Add(k)
+	for _, k := range roots.direct {
+		limited.Add(k)
+	}
+
+	// The internal pins hold every node of the pin sets, whose item links
+	// point to the pinned cids, expired ones included, so they are marked
+	// without being walked.
+	for _, k := range roots.internal {
+		limited.Add(k)
 	}
 
-	err = Descendants(ctx, getLinks, gcs, pn.InternalPins())
+	// The nodes at the depth limit of a pin are marked without their
+	// descendants, and the walks above skip the nodes already marked, so
+	// the depth limited pins are marked last.
+	err = DepthDescendants(ctx, getLinks, limited, roots.depth)
 	if err != nil {
 		errors = true
 		select {
 		case output <- Result{Error: err}:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 
+	if err := markSetErr(gcs); err != nil {
+		return err
+	}
+
 	if errors {
-		return nil, ErrCannotFetchAllLinks
+		return ErrCannotFetchAllLinks
 	}
 
-	return gcs, nil
+	return nil
+}
+
+// shallowMarkSet records the nodes it newly marks as shallow.
+type shallowMarkSet struct {
+	MarkSet
+	shallow *cid.Set
+}
+
+func (s *shallowMarkSet) Add(c cid.Cid) {
+	s.Visit(c)
+}
+
+func (s *shallowMarkSet) Visit(c cid.Cid) bool {
+	if !s.MarkSet.Visit(c) {
+		return false
+	}
+	s.shallow.Add(c)
+	return true
+}
+
+// rewalkMarkSet makes the walks go through the nodes marked as shallow,
+// which are no longer shallow once walked.
+type rewalkMarkSet struct {
+	MarkSet
+	shallow *cid.Set
+}
+
+func (s *rewalkMarkSet) Add(c cid.Cid) {
+	s.MarkSet.Add(c)
+	s.shallow.Remove(c)
+}
+
+func (s *rewalkMarkSet) Visit(c cid.Cid) bool {
+	if s.MarkSet.Visit(c) {
+		return true
+	}
+	if !s.shallow.Has(c) {
+		return false
+	}
+	s.shallow.Remove(c)
+	return true
+}
+
+// withoutExpired filters the expired pins out of the given keys.
+func withoutExpired(keys []cid.Cid, expired *cid.Set) []cid.Cid {
+	if expired.Len() == 0 {
+		return keys
+	}
+	out := make([]cid.Cid, 0, len(keys))
+	for _, k := range keys {
+		if !expired.Has(k) {
+			out = append(out, k)
+		}
+	}
+	return out
 }
 
 // ErrCannotFetchAllLinks is returned as the last Result in the GC output
@@ -0,0 +1,67 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestGCDepthLimitedPinOverlap(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	// D{B{C}}, pinned down to B, and also reachable from a best effort
+	// root such as the MFS root
+	c := dag.NodeWithData([]byte("c"))
+	b := dag.NodeWithData([]byte("b"))
+	if err := b.AddNodeLink("c", c); err != nil {
+		t.Fatal(err)
+	}
+	d := dag.NodeWithData([]byte("d"))
+	if err := d.AddNodeLink("b", b); err != nil {
+		t.Fatal(err)
+	}
+	mfsRoot := dag.NodeWithData([]byte("mfs root"))
+	if err := mfsRoot.AddNodeLink("d", d); err != nil {
+		t.Fatal(err)
+	}
+	garbage := dag.NodeWithData([]byte("garbage"))
+
+	for _, nd := range []*dag.ProtoNode{c, b, d, mfsRoot, garbage} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pn.PinWithDepth(ctx, d, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	removed := make(map[string]bool)
+	for res := range GC(ctx, bs, dstore, pn, []cid.Cid{mfsRoot.Cid()}) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed[res.KeyRemoved.String()] = true
+	}
+
+	if len(removed) != 1 || !removed[garbage.Cid().String()] {
+		t.Fatalf("expected only the unreferenced block to be removed, got %v", removed)
+	}
+}
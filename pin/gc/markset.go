@@ -0,0 +1,262 @@
+package gc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	dstore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// MarkSet is the set of blocks marked during a garbage collection, the
+// blocks which must not be removed. It is implemented by cid.Set.
+type MarkSet interface {
+	Add(cid.Cid)
+	// Visit adds the cid to the set and returns true if it was not in it.
+	Visit(cid.Cid) bool
+	Has(cid.Cid) bool
+	Len() int
+}
+
+// Option configures a garbage collection.
+type Option func(*options)
+
+type options struct {
+	newMarkSet func() (MarkSet, error)
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		newMarkSet: func() (MarkSet, error) {
+			return cid.NewSet(), nil
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// DiskMarking makes the garbage collection keep the marked set in the given
+// datastore instead of memory, so that the memory it uses does not grow with
+// the number of pinned blocks. The marks are removed once it is done.
+func DiskMarking(d dstore.Batching) Option {
+	return func(o *options) {
+		o.newMarkSet = func() (MarkSet, error) {
+			return newDiskMarkSet(d)
+		}
+	}
+}
+
+// markDatastorePrefix is the prefix under which diskMarkSet stores the
+// marked blocks, each garbage collection under its own run id.
+var markDatastorePrefix = dstore.NewKey("/local/gc/marks")
+
+// markRuns holds the run ids of the disk marked sets in use. Every disk
+// marked garbage collection, concurrent ones included, takes its lock to
+// register its run, and it is held while the marks left by the runs which
+// did not complete are removed, so that the marks of the running garbage
+// collections are never removed.
+var markRuns = struct {
+	sync.Mutex
+	active map[string]bool
+	last   int64
+}{active: make(map[string]bool)}
+
+// markBatchSize is the number of marks diskMarkSet keeps in memory before
+// writing them to the datastore.
+const markBatchSize = 16384
+
+// diskMarkSet is a MarkSet stored in a datastore. Marks are buffered in
+// memory and written in batches.
+//
+// The MarkSet methods can not return errors. Once the datastore fails, Has
+// and Visit report every block as marked, so that no block is removed, and
+// Err returns the error, which aborts the garbage collection.
+type diskMarkSet struct {
+	dstore  dstore.Batching
+	run     string
+	prefix  dstore.Key
+	batch   dstore.Batch
+	pending *cid.Set
+	len     int
+	err     error
+}
+
+func newDiskMarkSet(d dstore.Batching) (*diskMarkSet, error) {
+	markRuns.Lock()
+	defer markRuns.Unlock()
+
+	// remove the marks left by the garbage collections which did not
+	// complete
+	if err := clearMarks(d, markDatastorePrefix, markRuns.active); err != nil {
+		return nil, err
+	}
+
+	id := time.Now().UnixNano()
+	if id <= markRuns.last {
+		id = markRuns.last + 1
+	}
+	markRuns.last = id
+	run := strconv.FormatInt(id, 36)
+	markRuns.active[run] = true
+
+	return &diskMarkSet{
+		dstore:  d,
+		run:     run,
+		prefix:  markDatastorePrefix.ChildString(run),
+		pending: cid.NewSet(),
+	}, nil
+}
+
+func (s *diskMarkSet) markKey(c cid.Cid) dstore.Key {
+	return s.prefix.Child(dshelp.CidToDsKey(c))
+}
+
+func (s *diskMarkSet) fail(err error) {
+	if s.err == nil {
+		log.Errorf("marked set: %s", err)
+		s.err = err
+	}
+}
+
+// Add implements MarkSet.Add.
+func (s *diskMarkSet) Add(c cid.Cid) {
+	s.Visit(c)
+}
+
+// Visit implements MarkSet.Visit.
+func (s *diskMarkSet) Visit(c cid.Cid) bool {
+	if s.Has(c) {
+		return false
+	}
+
+	if s.batch == nil {
+		b, err := s.dstore.Batch()
+		if err != nil {
+			s.fail(err)
+			return false
+		}
+		s.batch = b
+	}
+	if err := s.batch.Put(s.markKey(c), []byte{}); err != nil {
+		s.fail(err)
+		return false
+	}
+	s.pending.Add(c)
+	s.len++
+
+	if s.pending.Len() >= markBatchSize {
+		s.flush()
+	}
+	return true
+}
+
+func (s *diskMarkSet) flush() {
+	if s.batch == nil {
+		return
+	}
+	if err := s.batch.Commit(); err != nil {
+		s.fail(err)
+		return
+	}
+	s.batch = nil
+	s.pending = cid.NewSet()
+}
+
+// Has implements MarkSet.Has.
+func (s *diskMarkSet) Has(c cid.Cid) bool {
+	if s.err != nil {
+		return true
+	}
+	if s.pending.Has(c) {
+		return true
+	}
+
+	has, err := s.dstore.Has(s.markKey(c))
+	if err != nil {
+		s.fail(err)
+		return true
+	}
+	return has
+}
+
+// Len implements MarkSet.Len.
+func (s *diskMarkSet) Len() int {
+	return s.len
+}
+
+// Err returns the first error of the datastore.
+func (s *diskMarkSet) Err() error {
+	return s.err
+}
+
+// Close removes the marks of the run from the datastore.
+func (s *diskMarkSet) Close() error {
+	s.flush()
+	err := clearMarks(s.dstore, s.prefix, nil)
+
+	markRuns.Lock()
+	delete(markRuns.active, s.run)
+	markRuns.Unlock()
+	return err
+}
+
+// clearMarks removes the marks under the given prefix, except the ones of
+// the runs in keep.
+func clearMarks(d dstore.Batching, prefix dstore.Key, keep map[string]bool) error {
+	res, err := d.Query(dsq.Query{Prefix: prefix.String() + "/", KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	batch, err := d.Batch()
+	if err != nil {
+		return err
+	}
+	depth := len(markDatastorePrefix.Namespaces())
+	n := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		k := dstore.RawKey(r.Key)
+		if ns := k.Namespaces(); len(ns) > depth && keep[ns[depth]] {
+			continue
+		}
+		if err := batch.Delete(k); err != nil {
+			return err
+		}
+		n++
+		if n%markBatchSize == 0 {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			if batch, err = d.Batch(); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Commit()
+}
+
+// markSetErr returns the error which made the marked set unusable, if any.
+func markSetErr(s MarkSet) error {
+	if s, ok := s.(interface{ Err() error }); ok {
+		return s.Err()
+	}
+	return nil
+}
+
+// closeMarkSet releases the resources held by the marked set.
+func closeMarkSet(s MarkSet) {
+	if s, ok := s.(interface{ Close() error }); ok {
+		if err := s.Close(); err != nil {
+			log.Errorf("removing the marked set: %s", err)
+		}
+	}
+}
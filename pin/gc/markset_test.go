@@ -0,0 +1,170 @@
+package gc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	dag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestDiskMarking(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	// a root with enough descendants for the marks to be written in several
+	// batches
+	root := dag.NodeWithData([]byte("root"))
+	var kept []cid.Cid
+	for i := 0; i < 2*markBatchSize+1; i++ {
+		child := dag.NodeWithData([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+		if err := dserv.Add(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+		if err := root.AddNodeLink("", child); err != nil {
+			t.Fatal(err)
+		}
+		kept = append(kept, child.Cid())
+	}
+	garbage := dag.NodeWithData([]byte("garbage"))
+	bestEffort := dag.NodeWithData([]byte("best effort"))
+	for _, nd := range []*dag.ProtoNode{root, garbage, bestEffort} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept = append(kept, root.Cid(), bestEffort.Cid())
+
+	if err := pn.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var removed []cid.Cid
+	for res := range GC(ctx, bs, dstore, pn, []cid.Cid{bestEffort.Cid()}, DiskMarking(dstore)) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed = append(removed, res.KeyRemoved)
+	}
+
+	if len(removed) != 1 || !removed[0].Equals(garbage.Cid()) {
+		t.Fatalf("expected only the unpinned block to be removed, got %v", removed)
+	}
+	for _, c := range kept {
+		has, err := bs.Has(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Fatalf("block %s was removed", c)
+		}
+	}
+
+	res, err := dstore.Query(dsq.Query{Prefix: markDatastorePrefix.String(), KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	marks, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(marks) != 0 {
+		t.Fatalf("expected the marks to be removed, %d are left", len(marks))
+	}
+}
+
+// readHookBlockstore calls hook the first time the block with the given cid
+// is read.
+type readHookBlockstore struct {
+	bstore.GCBlockstore
+	c      cid.Cid
+	hook   func()
+	called int32
+}
+
+func (bs *readHookBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	if c.Equals(bs.c) && atomic.CompareAndSwapInt32(&bs.called, 0, 1) {
+		bs.hook()
+	}
+	return bs.GCBlockstore.Get(c)
+}
+
+func TestDiskMarkingDuringConcurrentGC(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	hbs := &readHookBlockstore{GCBlockstore: bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())}
+	bs := NewTrackingBlockstore(hbs)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	child := dag.NodeWithData([]byte("child"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	garbage := dag.NodeWithData([]byte("garbage"))
+	for _, nd := range []*dag.ProtoNode{child, root, garbage} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pn.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the root is marked before its links are read, so a garbage collection
+	// runs while the concurrent one is marking
+	hbs.c = root.Cid()
+	hbs.hook = func() {
+		for res := range GC(ctx, bs, dstore, pn, nil, DiskMarking(dstore)) {
+			if res.Error != nil {
+				t.Error(res.Error)
+			}
+		}
+	}
+
+	roots := func() ([]cid.Cid, error) { return nil, nil }
+	for res := range ConcurrentGC(ctx, bs, dstore, pn, roots, DiskMarking(dstore)) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+	}
+	if atomic.LoadInt32(&hbs.called) == 0 {
+		t.Fatal("expected a garbage collection to run during the marking")
+	}
+
+	for _, nd := range []*dag.ProtoNode{child, root} {
+		has, err := bs.Has(nd.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("pinned block %s was removed", nd.Cid())
+		}
+	}
+	if has, _ := bs.Has(garbage.Cid()); has {
+		t.Error("expected the unpinned block to be removed")
+	}
+}
@@ -4,6 +4,7 @@ package pin
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
@@ -13,15 +14,21 @@ import (
 	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
 )
 
 var log = logging.Logger("pin")
 
 var pinDatastoreKey = ds.NewKey("/local/pins")
 
+// pinMetaDatastorePrefix is the prefix under which the names and metadata
+// of pins are stored, one key per pinned cid.
+var pinMetaDatastorePrefix = ds.NewKey("/local/pinmeta")
+
 var emptyKey cid.Cid
 
 func init() {
@@ -34,13 +41,14 @@ func init() {
 }
 
 const (
-	linkRecursive = "recursive"
-	linkDirect    = "direct"
-	linkIndirect  = "indirect"
-	linkInternal  = "internal"
-	linkNotPinned = "not pinned"
-	linkAny       = "any"
-	linkAll       = "all"
+	linkRecursive    = "recursive"
+	linkDirect       = "direct"
+	linkIndirect     = "indirect"
+	linkInternal     = "internal"
+	linkNotPinned    = "not pinned"
+	linkAny          = "any"
+	linkAll          = "all"
+	linkDepthLimited = "depth-limited"
 )
 
 // Mode allows to specify different types of pin (recursive, direct etc.).
@@ -66,17 +74,22 @@ const (
 
 	// Any refers to any pinned cid
 	Any
+
+	// DepthLimited pins pin the target cids along with their children
+	// down to a maximum depth.
+	DepthLimited
 )
 
 // ModeToString returns a human-readable name for the Mode.
 func ModeToString(mode Mode) (string, bool) {
 	m := map[Mode]string{
-		Recursive: linkRecursive,
-		Direct:    linkDirect,
-		Indirect:  linkIndirect,
-		Internal:  linkInternal,
-		NotPinned: linkNotPinned,
-		Any:       linkAny,
+		Recursive:    linkRecursive,
+		Direct:       linkDirect,
+		Indirect:     linkIndirect,
+		Internal:     linkInternal,
+		NotPinned:    linkNotPinned,
+		Any:          linkAny,
+		DepthLimited: linkDepthLimited,
 	}
 	s, ok := m[mode]
 	return s, ok
@@ -86,13 +99,14 @@ func ModeToString(mode Mode) (string, bool) {
 // It returns a boolean which is set to false if the mode is unknown.
 func StringToMode(s string) (Mode, bool) {
 	m := map[string]Mode{
-		linkRecursive: Recursive,
-		linkDirect:    Direct,
-		linkIndirect:  Indirect,
-		linkInternal:  Internal,
-		linkNotPinned: NotPinned,
-		linkAny:       Any,
-		linkAll:       Any, // "all" and "any" means the same thing
+		linkRecursive:    Recursive,
+		linkDirect:       Direct,
+		linkIndirect:     Indirect,
+		linkInternal:     Internal,
+		linkNotPinned:    NotPinned,
+		linkAny:          Any,
+		linkAll:          Any, // "all" and "any" means the same thing
+		linkDepthLimited: DepthLimited,
 	}
 	mode, ok := m[s]
 	return mode, ok
@@ -114,8 +128,13 @@ type Pinner interface {
 	// Pin the given node, optionally recursively.
 	Pin(ctx context.Context, node ipld.Node, recursive bool) error
 
-	// Unpin the given cid. If recursive is true, removes either a recursive or
-	// a direct pin. If recursive is false, only removes a direct pin.
+	// PinWithDepth pins the given node along with its children down to
+	// maxDepth levels below it.
+	PinWithDepth(ctx context.Context, node ipld.Node, maxDepth int) error
+
+	// Unpin the given cid. If recursive is true, removes either a recursive,
+	// depth limited or direct pin. If recursive is false, only removes a
+	// direct pin.
 	Unpin(ctx context.Context, cid cid.Cid, recursive bool) error
 
 	// Update updates a recursive pin from one cid to another
@@ -146,9 +165,104 @@ type Pinner interface {
 	// DirectKeys returns all recursively pinned cids
 	RecursiveKeys() []cid.Cid
 
+	// DepthLimitedKeys returns all cids pinned with a depth limit, along
+	// with their maximum depth.
+	DepthLimitedKeys() map[cid.Cid]int
+
 	// InternalPins returns all cids kept pinned for the internal state of the
 	// pinner
 	InternalPins() []cid.Cid
+
+	// SetMeta attaches a name and user metadata to a direct, recursive or
+	// depth limited pin. It is persisted on the next Flush.
+	SetMeta(cid.Cid, PinMeta) error
+
+	// Meta returns the name and user metadata attached to a pin, if any.
+	Meta(cid.Cid) (PinMeta, bool)
+
+	// Expired returns the pins whose expiry time is before the given time.
+	Expired(time.Time) []cid.Cid
+
+	// RebuildRefIndex rebuilds the index used to look up indirect pins
+	// from scratch. It returns ErrNoRefIndex if the pinner does not
+	// maintain one.
+	RebuildRefIndex(ctx context.Context) error
+}
+
+// PinMeta holds the user supplied information attached to a direct or
+// recursive pin, so pins can be told apart and managed in groups.
+type PinMeta struct {
+	Name string            `json:",omitempty"`
+	Meta map[string]string `json:",omitempty"`
+
+	// Expires is the time after which the pin is released. The zero
+	// value means the pin never expires.
+	Expires time.Time
+}
+
+// IsEmpty returns true if no information is held by the PinMeta.
+func (m PinMeta) IsEmpty() bool {
+	return m.Name == "" && len(m.Meta) == 0 && m.Expires.IsZero()
+}
+
+// PinWithMeta pins node recursively when depth is negative, directly when
+// it is 0, and down to the given depth otherwise, and attaches the given
+// metadata to the pin. When node is already pinned, the name and user
+// metadata given replace the ones of the pin, which are kept otherwise. A
+// pin which does not expire stays permanent even if an expiry is given, so
+// that a temporary pin cannot release one the user meant to keep, while an
+// expiring pin gets the given expiry, or none. The pinner is not flushed.
+func PinWithMeta(ctx context.Context, p Pinner, node ipld.Node, depth int, meta PinMeta) error {
+	c := node.Cid()
+	reason, pinned, err := p.IsPinnedWithType(c, Any)
+	if err != nil {
+		return err
+	}
+	pinned = pinned && (reason == linkRecursive || reason == linkDirect || reason == linkDepthLimited)
+	old, _ := p.Meta(c)
+
+	if depth > 0 {
+		err = p.PinWithDepth(ctx, node, depth)
+	} else {
+		err = p.Pin(ctx, node, depth < 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if pinned {
+		if meta.Name == "" {
+			meta.Name = old.Name
+		}
+		if meta.Meta == nil {
+			meta.Meta = old.Meta
+		}
+		if old.Expires.IsZero() {
+			meta.Expires = time.Time{}
+		}
+	}
+	if !pinned && meta.IsEmpty() {
+		return nil
+	}
+	return p.SetMeta(c, meta)
+}
+
+// clone returns a copy of the PinMeta not sharing its user metadata.
+func (m PinMeta) clone() PinMeta {
+	if m.Meta != nil {
+		meta := make(map[string]string, len(m.Meta))
+		for k, v := range m.Meta {
+			meta[k] = v
+		}
+		m.Meta = meta
+	}
+	return m
+}
+
+// ExpiredAt returns true if the pin carrying this PinMeta has expired at
+// the given time.
+func (m PinMeta) ExpiredAt(t time.Time) bool {
+	return !m.Expires.IsZero() && m.Expires.Before(t)
 }
 
 // Pinned represents CID which has been pinned with a pinning strategy.
@@ -185,12 +299,32 @@ type pinner struct {
 	recursePin *cid.Set
 	directPin  *cid.Set
 
+	// depthPin maps depth limited pins to their maximum depth
+	depthPin map[cid.Cid]int
+
 	// Track the keys used for storing the pinning state, so gc does
 	// not delete them.
 	internalPin *cid.Set
 	dserv       ipld.DAGService
 	internal    ipld.DAGService // dagservice used to store internal objects
 	dstore      ds.Datastore
+
+	// store persists the pin sets on Flush, changed tracks the cids whose
+	// pin state changed since the last Flush.
+	store   pinStore
+	changed *cid.Set
+
+	// meta holds the names and metadata of pins, metaDirty tracks the
+	// entries changed since the last Flush.
+	meta      map[cid.Cid]PinMeta
+	metaDirty *cid.Set
+
+	// index, when enabled, maps descendants to their recursive pins
+	index *refIndex
+
+	// indexInvalidated is set once the persisted reference index has been
+	// marked stale by a flush while the index was disabled
+	indexInvalidated bool
 }
 
 // NewPinner creates a new pinner using the given datastore as a backend
@@ -202,10 +336,15 @@ func NewPinner(dstore ds.Datastore, serv, internal ipld.DAGService) Pinner {
 	return &pinner{
 		recursePin:  rcset,
 		directPin:   dirset,
+		depthPin:    make(map[cid.Cid]int),
 		dserv:       serv,
 		dstore:      dstore,
 		internal:    internal,
 		internalPin: cid.NewSet(),
+		store:       dagSetStore{},
+		changed:     cid.NewSet(),
+		meta:        make(map[cid.Cid]PinMeta),
+		metaDirty:   cid.NewSet(),
 	}
 }
 
@@ -227,7 +366,10 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 
 		if p.directPin.Has(c) {
 			p.directPin.Remove(c)
+			p.changed.Add(c)
 		}
+		// a depth limited pin is kept until the graph is fetched, so that
+		// it is not lost if fetching fails
 		p.lock.Unlock()
 		// fetch entire graph
 		err := mdag.FetchGraph(ctx, c, p.dserv)
@@ -243,8 +385,11 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 		if p.directPin.Has(c) {
 			p.directPin.Remove(c)
 		}
+		delete(p.depthPin, c)
 
 		p.recursePin.Add(c)
+		p.changed.Add(c)
+		p.recursiveAdded(c)
 	} else {
 		p.lock.Unlock()
 		_, err := p.dserv.Get(ctx, c)
@@ -256,8 +401,12 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 		if p.recursePin.Has(c) {
 			return fmt.Errorf("%s already pinned recursively", c.String())
 		}
+		if _, ok := p.depthPin[c]; ok {
+			return fmt.Errorf("%s already pinned with a depth limit", c.String())
+		}
 
 		p.directPin.Add(c)
+		p.changed.Add(c)
 	}
 	return nil
 }
@@ -280,11 +429,24 @@ func (p *pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
 	case "recursive":
 		if recursive {
 			p.recursePin.Remove(c)
+			p.changed.Add(c)
+			p.recursiveRemoved(c)
+			p.removeMeta(c)
 			return nil
 		}
 		return fmt.Errorf("%s is pinned recursively", c)
+	case linkDepthLimited:
+		if recursive {
+			delete(p.depthPin, c)
+			p.changed.Add(c)
+			p.removeMeta(c)
+			return nil
+		}
+		return fmt.Errorf("%s is pinned with a depth limit", c)
 	case "direct":
 		p.directPin.Remove(c)
+		p.changed.Add(c)
+		p.removeMeta(c)
 		return nil
 	default:
 		return fmt.Errorf("%s is pinned indirectly under %s", c, reason)
@@ -315,10 +477,10 @@ func (p *pinner) IsPinnedWithType(c cid.Cid, mode Mode) (string, bool, error) {
 // intended for use by other pinned methods that already take locks
 func (p *pinner) isPinnedWithType(c cid.Cid, mode Mode) (string, bool, error) {
 	switch mode {
-	case Any, Direct, Indirect, Recursive, Internal:
+	case Any, Direct, Indirect, Recursive, Internal, DepthLimited:
 	default:
-		err := fmt.Errorf("invalid Pin Mode '%d', must be one of {%d, %d, %d, %d, %d}",
-			mode, Direct, Indirect, Recursive, Internal, Any)
+		err := fmt.Errorf("invalid Pin Mode '%d', must be one of {%d, %d, %d, %d, %d, %d}",
+			mode, Direct, Indirect, Recursive, Internal, Any, DepthLimited)
 		return "", false, err
 	}
 	if (mode == Recursive || mode == Any) && p.recursePin.Has(c) {
@@ -335,6 +497,13 @@ func (p *pinner) isPinnedWithType(c cid.Cid, mode Mode) (string, bool, error) {
 		return "", false, nil
 	}
 
+	if _, ok := p.depthPin[c]; ok && (mode == DepthLimited || mode == Any) {
+		return linkDepthLimited, true, nil
+	}
+	if mode == DepthLimited {
+		return "", false, nil
+	}
+
 	if (mode == Internal || mode == Any) && p.isInternalPin(c) {
 		return linkInternal, true, nil
 	}
@@ -343,17 +512,32 @@ func (p *pinner) isPinnedWithType(c cid.Cid, mode Mode) (string, bool, error) {
 	}
 
 	// Default is Indirect
-	visitedSet := cid.NewSet()
-	for _, rc := range p.recursePin.Keys() {
-		has, err := hasChild(p.dserv, rc, c, visitedSet.Visit)
+	if p.index != nil && p.index.built {
+		rc, has, err := p.indexedRoot(c)
 		if err != nil {
 			return "", false, err
 		}
 		if has {
 			return rc.String(), true, nil
 		}
+	} else {
+		visitedSet := cid.NewSet()
+		for _, rc := range p.recursePin.Keys() {
+			has, err := hasChild(p.dserv, rc, c, visitedSet.Visit)
+			if err != nil {
+				return "", false, err
+			}
+			if has {
+				return rc.String(), true, nil
+			}
+		}
+	}
+
+	rc, has, err := p.depthLimitedRoot(c)
+	if err != nil || !has {
+		return "", false, err
 	}
-	return "", false, nil
+	return rc.String(), true, nil
 }
 
 // CheckIfPinned Checks if a set of keys are pinned, more efficient than
@@ -370,6 +554,8 @@ func (p *pinner) CheckIfPinned(cids ...cid.Cid) ([]Pinned, error) {
 			pinned = append(pinned, Pinned{Key: c, Mode: Recursive})
 		} else if p.directPin.Has(c) {
 			pinned = append(pinned, Pinned{Key: c, Mode: Direct})
+		} else if _, ok := p.depthPin[c]; ok {
+			pinned = append(pinned, Pinned{Key: c, Mode: DepthLimited})
 		} else if p.isInternalPin(c) {
 			pinned = append(pinned, Pinned{Key: c, Mode: Internal})
 		} else {
@@ -377,6 +563,21 @@ func (p *pinner) CheckIfPinned(cids ...cid.Cid) ([]Pinned, error) {
 		}
 	}
 
+	// Use the reference index to find indirect pins when available
+	if p.index != nil && p.index.built {
+		for _, c := range toCheck.Keys() {
+			rc, has, err := p.indexedRoot(c)
+			if err != nil {
+				return nil, err
+			}
+			if has {
+				pinned = append(pinned, Pinned{Key: c, Mode: Indirect, Via: rc})
+				toCheck.Remove(c)
+			}
+		}
+		return p.checkDepthLimited(pinned, toCheck)
+	}
+
 	// Now walk all recursive pins to check for indirect pins
 	var checkChildren func(cid.Cid, cid.Cid) error
 	checkChildren = func(rk, parentKey cid.Cid) error {
@@ -406,13 +607,36 @@ func (p *pinner) CheckIfPinned(cids ...cid.Cid) ([]Pinned, error) {
 	}
 
 	for _, rk := range p.recursePin.Keys() {
+		if toCheck.Len() == 0 {
+			break
+		}
 		err := checkChildren(rk, rk)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	return p.checkDepthLimited(pinned, toCheck)
+}
+
+// checkDepthLimited looks for the cids left in toCheck among the children
+// of depth limited pins and appends their status to pinned.
+func (p *pinner) checkDepthLimited(pinned []Pinned, toCheck *cid.Set) ([]Pinned, error) {
+	for rk, depth := range p.depthPin {
 		if toCheck.Len() == 0 {
 			break
 		}
+		set := cid.NewSet()
+		err := dagutils.EnumerateChildrenDepth(context.TODO(), mdag.GetLinksWithDAG(p.dserv), rk, depth, set.Visit)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range toCheck.Keys() {
+			if set.Has(c) {
+				pinned = append(pinned, Pinned{Key: c, Mode: Indirect, Via: rk})
+				toCheck.Remove(c)
+			}
+		}
 	}
 
 	// Anything left in toCheck is not pinned
@@ -434,10 +658,17 @@ func (p *pinner) RemovePinWithMode(c cid.Cid, mode Mode) {
 		p.directPin.Remove(c)
 	case Recursive:
 		p.recursePin.Remove(c)
+		p.recursiveRemoved(c)
+	case DepthLimited:
+		delete(p.depthPin, c)
 	default:
 		// programmer error, panic OK
 		panic("unrecognized pin type")
 	}
+	p.changed.Add(c)
+	if !p.hasPin(c) {
+		p.removeMeta(c)
+	}
 }
 
 func cidSetWithValues(cids []cid.Cid) *cid.Set {
@@ -453,6 +684,15 @@ func LoadPinner(d ds.Datastore, dserv, internal ipld.DAGService) (Pinner, error)
 	p := new(pinner)
 
 	rootKey, err := d.Get(pinDatastoreKey)
+	if err == ds.ErrNotFound {
+		has, herr := hasDatastorePins(d)
+		if herr != nil {
+			return nil, fmt.Errorf("cannot load pin state: %v", herr)
+		}
+		if has {
+			return nil, ErrDatastorePins
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot load pin state: %v", err)
 	}
@@ -496,6 +736,22 @@ func LoadPinner(d ds.Datastore, dserv, internal ipld.DAGService) (Pinner, error)
 
 	p.internalPin = internalset
 
+	depthPin, err := loadDepth(d)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load depth limited pins: %v", err)
+	}
+	p.depthPin = depthPin
+
+	meta, err := loadMeta(d)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load pin metadata: %v", err)
+	}
+	p.meta = meta
+	p.metaDirty = cid.NewSet()
+
+	p.store = dagSetStore{}
+	p.changed = cid.NewSet()
+
 	// assign services
 	p.dserv = dserv
 	p.dstore = d
@@ -531,19 +787,73 @@ func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error
 	}
 
 	p.recursePin.Add(to)
+	p.changed.Add(to)
+	p.recursiveAdded(to)
 	if unpin {
 		p.recursePin.Remove(from)
+		p.changed.Add(from)
+		p.recursiveRemoved(from)
+		if m, ok := p.meta[from]; ok {
+			p.removeMeta(from)
+			p.setMeta(to, m)
+		}
 	}
 	return nil
 }
 
-// Flush encodes and writes pinner keysets to the datastore
+// Flush writes the pin state to the backing datastore
 func (p *pinner) Flush() error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
 	ctx := context.TODO()
 
+	changed := p.changed.Keys()
+	if p.index != nil {
+		if err := p.index.flushAdded(ctx, p); err != nil {
+			return fmt.Errorf("cannot update pin reference index: %v", err)
+		}
+	} else if len(changed) > 0 && !p.indexInvalidated {
+		if err := invalidateRefIndex(p.dstore); err != nil {
+			return fmt.Errorf("cannot invalidate pin reference index: %v", err)
+		}
+		p.indexInvalidated = true
+	}
+
+	if err := p.store.flush(ctx, p, changed); err != nil {
+		return err
+	}
+	if err := p.flushDepth(changed); err != nil {
+		return fmt.Errorf("cannot store depth limited pins: %v", err)
+	}
+	p.changed = cid.NewSet()
+
+	if p.index != nil {
+		if err := p.index.flushRemoved(ctx, p); err != nil {
+			return fmt.Errorf("cannot update pin reference index: %v", err)
+		}
+	}
+
+	if err := p.flushMeta(); err != nil {
+		return fmt.Errorf("cannot store pin metadata: %v", err)
+	}
+	return nil
+}
+
+// pinStore persists the direct and recursive pin sets of a pinner.
+type pinStore interface {
+	// flush writes the pin sets of the given pinner, whose lock is held.
+	// changed holds the cids whose pin state changed since the previous
+	// flush.
+	flush(ctx context.Context, p *pinner, changed []cid.Cid) error
+}
+
+// dagSetStore stores the pin sets as DAGs of pb.Set nodes, rewritten on
+// every flush. The root of the pin state is stored under pinDatastoreKey.
+type dagSetStore struct{}
+
+// flush encodes and writes pinner keysets to the datastore
+func (dagSetStore) flush(ctx context.Context, p *pinner, changed []cid.Cid) error {
 	internalset := cid.NewSet()
 	recordInternal := internalset.Add
 
@@ -607,9 +917,13 @@ func (p *pinner) PinWithMode(c cid.Cid, mode Mode) {
 	switch mode {
 	case Recursive:
 		p.recursePin.Add(c)
+		p.recursiveAdded(c)
 	case Direct:
 		p.directPin.Add(c)
+	default:
+		return
 	}
+	p.changed.Add(c)
 }
 
 // hasChild recursively looks for a Cid among the children of a root Cid.
@@ -637,3 +951,125 @@ func hasChild(ng ipld.NodeGetter, root cid.Cid, child cid.Cid, visit func(cid.Ci
 	}
 	return false, nil
 }
+
+// SetMeta attaches a name and user metadata to a direct, recursive or depth
+// limited pin. Setting an empty PinMeta removes any previously attached
+// information.
+func (p *pinner) SetMeta(c cid.Cid, m PinMeta) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.hasPin(c) {
+		return fmt.Errorf("%s is not pinned directly or recursively", c)
+	}
+	if m.IsEmpty() {
+		p.removeMeta(c)
+		return nil
+	}
+	p.setMeta(c, m.clone())
+	return nil
+}
+
+// Meta returns a copy of the name and user metadata attached to a pin.
+func (p *pinner) Meta(c cid.Cid) (PinMeta, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	m, ok := p.meta[c]
+	return m.clone(), ok
+}
+
+// Expired returns the pins whose expiry time is before the given time.
+func (p *pinner) Expired(t time.Time) []cid.Cid {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var out []cid.Cid
+	for c, m := range p.meta {
+		if m.ExpiredAt(t) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// hasPin returns true if c is pinned directly, recursively or with a depth
+// limit.
+func (p *pinner) hasPin(c cid.Cid) bool {
+	_, depth := p.depthPin[c]
+	return depth || p.recursePin.Has(c) || p.directPin.Has(c)
+}
+
+func (p *pinner) recursiveAdded(c cid.Cid) {
+	if p.index != nil {
+		p.index.pinAdded(c)
+	}
+}
+
+func (p *pinner) recursiveRemoved(c cid.Cid) {
+	if p.index != nil {
+		p.index.pinRemoved(c)
+	}
+}
+
+func (p *pinner) setMeta(c cid.Cid, m PinMeta) {
+	p.meta[c] = m
+	p.metaDirty.Add(c)
+}
+
+func (p *pinner) removeMeta(c cid.Cid) {
+	if _, ok := p.meta[c]; !ok {
+		return
+	}
+	delete(p.meta, c)
+	p.metaDirty.Add(c)
+}
+
+// flushMeta writes the metadata entries changed since the last flush to the
+// datastore. Only the changed entries are touched.
+func (p *pinner) flushMeta() error {
+	for _, c := range p.metaDirty.Keys() {
+		k := pinMetaDatastorePrefix.Child(dshelp.CidToDsKey(c))
+		m, ok := p.meta[c]
+		if !ok {
+			if err := p.dstore.Delete(k); err != nil && err != ds.ErrNotFound {
+				return err
+			}
+			continue
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := p.dstore.Put(k, b); err != nil {
+			return err
+		}
+	}
+	p.metaDirty = cid.NewSet()
+	return nil
+}
+
+// loadMeta reads all the pin metadata entries stored in the datastore.
+func loadMeta(d ds.Datastore) (map[cid.Cid]PinMeta, error) {
+	res, err := d.Query(dsq.Query{Prefix: pinMetaDatastorePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	out := make(map[cid.Cid]PinMeta)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := ds.RawKey(r.Key)
+		c, err := dshelp.DsKeyToCid(ds.NewKey(k.BaseNamespace()))
+		if err != nil {
+			log.Errorf("decoding cid from pin metadata key %s: %s", k, err)
+			continue
+		}
+		var m PinMeta
+		if err := json.Unmarshal(r.Value, &m); err != nil {
+			return nil, err
+		}
+		out[c] = m
+	}
+	return out, nil
+}
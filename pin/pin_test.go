@@ -12,6 +12,7 @@ import (
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
 	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
 	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
 )
@@ -406,3 +407,295 @@ func TestPinUpdate(t *testing.T) {
 	assertPinned(t, p, c2, "c2 should be pinned still")
 	assertPinned(t, p, c1, "c1 should be pinned now")
 }
+
+func TestPinMeta(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	dserv.Add(ctx, a)
+	dserv.Add(ctx, b)
+
+	if err := p.SetMeta(ak, PinMeta{Name: "a"}); err == nil {
+		t.Fatal("expected setting meta on unpinned node to fail")
+	}
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, b, false); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := PinMeta{Name: "project-a", Meta: map[string]string{"owner": "alice"}}
+	if err := p.SetMeta(ak, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMeta(bk, PinMeta{Name: "project-b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, ok := np.Meta(ak)
+	if !ok {
+		t.Fatal("expected meta to be loaded")
+	}
+	if m.Name != "project-a" || m.Meta["owner"] != "alice" {
+		t.Fatalf("unexpected meta: %#v", m)
+	}
+	m.Meta["owner"] = "mallory"
+	if m, _ := np.Meta(ak); m.Meta["owner"] != "alice" {
+		t.Fatal("expected Meta to return a copy")
+	}
+
+	if err := np.Unpin(ctx, bk, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := np.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err = LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := np.Meta(bk); ok {
+		t.Fatal("expected meta to be removed along with the pin")
+	}
+	if _, ok := np.Meta(ak); !ok {
+		t.Fatal("expected meta of remaining pin to be kept")
+	}
+}
+
+func TestPinExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+
+	dserv := mdag.NewDAGService(bserv)
+	p := NewPinner(dstore, dserv, dserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	dserv.Add(ctx, a)
+	dserv.Add(ctx, b)
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, b, true); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if err := p.SetMeta(ak, PinMeta{Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMeta(bk, PinMeta{Expires: now.Add(2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := np.Expired(now); len(exp) != 0 {
+		t.Fatalf("expected no expired pins, got %v", exp)
+	}
+
+	exp := np.Expired(now.Add(90 * time.Minute))
+	if len(exp) != 1 || !exp[0].Equals(ak) {
+		t.Fatalf("expected only %s to be expired, got %v", ak, exp)
+	}
+}
+
+func TestPinWithMetaRepin(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+	p := NewPinner(dstore, dserv, dserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	dserv.Add(ctx, a)
+	dserv.Add(ctx, b)
+
+	// a permanent pin stays permanent when pinned again with an expiry
+	if err := PinWithMeta(ctx, p, a, -1, PinMeta{Name: "keep"}); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	if err := PinWithMeta(ctx, p, a, -1, PinMeta{Expires: expires}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := p.Meta(ak); m.Name != "keep" || !m.Expires.IsZero() {
+		t.Fatalf("unexpected meta after re-pin: %#v", m)
+	}
+
+	// a new pin gets the expiry, which can be changed by pinning again
+	if err := PinWithMeta(ctx, p, b, 0, PinMeta{Expires: expires}); err != nil {
+		t.Fatal(err)
+	}
+	if err := PinWithMeta(ctx, p, b, 0, PinMeta{Name: "later", Expires: expires.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := p.Meta(bk); m.Name != "later" || !m.Expires.Equal(expires.Add(time.Hour)) {
+		t.Fatalf("unexpected meta after re-pin: %#v", m)
+	}
+
+	// pinning it again without expiry makes it permanent
+	if err := PinWithMeta(ctx, p, b, 0, PinMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := p.Meta(bk); m.Name != "later" || !m.Expires.IsZero() {
+		t.Fatalf("unexpected meta after re-pin: %#v", m)
+	}
+}
+
+func TestPinWithDepth(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	p := NewPinner(dstore, dserv, dserv)
+
+	// A{B{C}}
+	c, ck := randNode()
+	b, bk := randNode()
+	if err := b.AddNodeLink("c", c); err != nil {
+		t.Fatal(err)
+	}
+	a, ak := randNode()
+	if err := a.AddNodeLink("b", b); err != nil {
+		t.Fatal(err)
+	}
+	dserv.Add(ctx, c)
+	dserv.Add(ctx, b)
+	dserv.Add(ctx, a)
+
+	if err := p.PinWithDepth(ctx, a, 0); err == nil {
+		t.Fatal("expected a depth of 0 to be refused")
+	}
+
+	if err := p.PinWithDepth(ctx, a, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, pinned, _ := p.IsPinnedWithType(ak, DepthLimited); !pinned {
+		t.Fatal("expected A to be pinned with a depth limit")
+	}
+	via, pinned, err := p.IsPinnedWithType(bk, Indirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned || via != ak.String() {
+		t.Fatalf("expected B to be pinned through A, got %q", via)
+	}
+	assertUnpinned(t, p, ck, "C is below the depth limit")
+
+	if err := p.Pin(ctx, a, false); err == nil {
+		t.Fatal("expected a direct pin on a depth limited pin to fail")
+	}
+	if err := p.Unpin(ctx, ak, false); err == nil {
+		t.Fatal("expected non recursive unpin of a depth limited pin to fail")
+	}
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := np.DepthLimitedKeys()[ak]; depth != 1 {
+		t.Fatalf("expected depth 1 to be loaded, got %d", depth)
+	}
+
+	res, err := np.CheckIfPinned(ak, bk, ck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res {
+		switch {
+		case r.Key.Equals(ak) && r.Mode != DepthLimited:
+			t.Fatalf("expected A to be depth limited, got %s", r)
+		case r.Key.Equals(bk) && (r.Mode != Indirect || !r.Via.Equals(ak)):
+			t.Fatalf("expected B to be pinned through A, got %s", r)
+		case r.Key.Equals(ck) && r.Mode != NotPinned:
+			t.Fatalf("expected C not to be pinned, got %s", r)
+		}
+	}
+
+	// pinning recursively replaces the depth limit
+	if err := np.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(np.DepthLimitedKeys()) != 0 {
+		t.Fatal("expected the depth limited pin to be replaced")
+	}
+	assertPinned(t, np, ck, "C should be pinned recursively")
+
+	if err := np.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	has, err := dstore.Has(pinDepthDatastorePrefix.Child(dshelp.CidToDsKey(ak)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected the stored depth to be removed")
+	}
+}
+
+func TestPinRecursiveFailKeepsDepth(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	p := NewPinner(dstore, dserv, dserv)
+
+	// A{B{C}}, C is missing
+	c, _ := randNode()
+	b, _ := randNode()
+	if err := b.AddNodeLink("c", c); err != nil {
+		t.Fatal(err)
+	}
+	a, ak := randNode()
+	if err := a.AddNodeLink("b", b); err != nil {
+		t.Fatal(err)
+	}
+	dserv.Add(ctx, b)
+	dserv.Add(ctx, a)
+
+	if err := p.PinWithDepth(ctx, a, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	mctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := p.Pin(mctx, a, true); err == nil {
+		t.Fatal("expected the recursive pin to fail")
+	}
+
+	if depth := p.DepthLimitedKeys()[ak]; depth != 1 {
+		t.Fatalf("expected the depth limited pin to be kept, got depth %d", depth)
+	}
+}
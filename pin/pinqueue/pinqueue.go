@@ -0,0 +1,330 @@
+// Package pinqueue implements a persistent queue of pins which are fetched
+// and added in the background.
+package pinqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+var log = logging.Logger("pinqueue")
+
+// queueDatastorePrefix is the prefix under which queued pins are stored,
+// one key per cid.
+var queueDatastorePrefix = ds.NewKey("/local/pinqueue")
+
+// Workers is the number of pins processed at the same time.
+const Workers = 4
+
+// State is the state of a pin in the queue.
+type State int
+
+const (
+	// Queued pins are waiting to be processed.
+	Queued State = iota
+
+	// Pinning pins are being fetched and pinned.
+	Pinning
+
+	// Failed pins could not be fetched or pinned. They stay in the queue
+	// until they are added again.
+	Failed
+)
+
+// String returns a human-readable name for the State.
+func (s State) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case Pinning:
+		return "pinning"
+	case Failed:
+		return "failed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// ErrNotQueued is returned when looking up a cid which is not in the queue.
+var ErrNotQueued = errors.New("not in the pin queue")
+
+// Request is a pin held by the queue.
+type Request struct {
+	Cid cid.Cid
+
+	// MaxDepth is the depth to pin down to, as taken by corerepo.Pin: 0
+	// pins directly, a negative depth pins recursively.
+	MaxDepth int
+	Meta     pin.PinMeta
+
+	State State
+	Err   string `json:",omitempty"`
+	Added time.Time
+
+	// Fetched is the number of blocks fetched so far while pinning. It is
+	// not persisted.
+	Fetched int `json:"-"`
+}
+
+// Queue fetches and pins the requests added to it in the background. The
+// requests are stored in the datastore, so they are resumed after a
+// restart.
+type Queue struct {
+	dstore  ds.Datastore
+	locker  bstore.GCLocker
+	pinning pin.Pinner
+	dag     ipld.DAGService
+
+	lock     sync.Mutex
+	requests map[cid.Cid]*Request
+	progress map[cid.Cid]*mdag.ProgressTracker
+	wake     chan struct{}
+}
+
+// New creates a Queue and loads the requests stored in the given datastore.
+// Requests which were being pinned when the queue was stopped are queued
+// again.
+func New(d ds.Datastore, locker bstore.GCLocker, pinning pin.Pinner, dag ipld.DAGService) (*Queue, error) {
+	q := &Queue{
+		dstore:   d,
+		locker:   locker,
+		pinning:  pinning,
+		dag:      dag,
+		requests: make(map[cid.Cid]*Request),
+		progress: make(map[cid.Cid]*mdag.ProgressTracker),
+		wake:     make(chan struct{}, 1),
+	}
+
+	res, err := d.Query(dsq.Query{Prefix: queueDatastorePrefix.String()})
+	if err != nil {
+		return nil, fmt.Errorf("cannot load pin queue: %v", err)
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, fmt.Errorf("cannot load pin queue: %v", r.Error)
+		}
+		var req Request
+		if err := json.Unmarshal(r.Value, &req); err != nil {
+			log.Errorf("decoding pin queue entry %s: %s", r.Key, err)
+			continue
+		}
+		if req.State == Pinning {
+			req.State = Queued
+		}
+		q.requests[req.Cid] = &req
+	}
+	return q, nil
+}
+
+func requestKey(c cid.Cid) ds.Key {
+	return queueDatastorePrefix.Child(dshelp.CidToDsKey(c))
+}
+
+// put persists the given request. The queue lock must be held.
+func (q *Queue) put(req *Request) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return q.dstore.Put(requestKey(req.Cid), b)
+}
+
+// Add queues the given cid to be pinned down to maxDepth, with the given
+// pin metadata. Adding a failed request again retries it. Adding a request
+// which is already queued or being pinned does nothing.
+func (q *Queue) Add(c cid.Cid, maxDepth int, meta pin.PinMeta) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if req, ok := q.requests[c]; ok && req.State != Failed {
+		return nil
+	}
+
+	req := &Request{
+		Cid:      c,
+		MaxDepth: maxDepth,
+		Meta:     meta,
+		State:    Queued,
+		Added:    time.Now(),
+	}
+	if err := q.put(req); err != nil {
+		return fmt.Errorf("cannot store pin queue entry: %v", err)
+	}
+	q.requests[c] = req
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the requests held by the queue, oldest first.
+func (q *Queue) Status() []Request {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	out := make([]Request, 0, len(q.requests))
+	for c, req := range q.requests {
+		r := *req
+		if p, ok := q.progress[c]; ok {
+			r.Fetched = p.Value()
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Added.Before(out[j].Added)
+	})
+	return out
+}
+
+// Get returns the request held by the queue for the given cid.
+func (q *Queue) Get(c cid.Cid) (Request, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	req, ok := q.requests[c]
+	if !ok {
+		return Request{}, ErrNotQueued
+	}
+	r := *req
+	if p, ok := q.progress[c]; ok {
+		r.Fetched = p.Value()
+	}
+	return r, nil
+}
+
+// next marks the oldest queued request as being pinned and returns it.
+func (q *Queue) next() (*Request, *mdag.ProgressTracker, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var oldest *Request
+	for _, req := range q.requests {
+		if req.State != Queued {
+			continue
+		}
+		if oldest == nil || req.Added.Before(oldest.Added) {
+			oldest = req
+		}
+	}
+	if oldest == nil {
+		return nil, nil, false
+	}
+
+	oldest.State = Pinning
+	if err := q.put(oldest); err != nil {
+		log.Errorf("cannot store pin queue entry: %s", err)
+	}
+	p := new(mdag.ProgressTracker)
+	q.progress[oldest.Cid] = p
+	return oldest, p, true
+}
+
+// done removes a successful request from the queue, or records the error of
+// a failed one.
+func (q *Queue) done(req *Request, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.progress, req.Cid)
+	if err == nil {
+		delete(q.requests, req.Cid)
+		if err := q.dstore.Delete(requestKey(req.Cid)); err != nil && err != ds.ErrNotFound {
+			log.Errorf("cannot remove pin queue entry: %s", err)
+		}
+		return
+	}
+
+	req.State = Failed
+	req.Err = err.Error()
+	if err := q.put(req); err != nil {
+		log.Errorf("cannot store pin queue entry: %s", err)
+	}
+}
+
+// Run processes the queued requests until the given context is cancelled.
+func (q *Queue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.worker(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	for {
+		req, progress, ok := q.next()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// let another worker pick up the next request
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+
+		err := q.pin(progress.DeriveContext(ctx), req)
+		if ctx.Err() != nil {
+			// interrupted by shutdown, the request is resumed on the next
+			// start
+			return
+		}
+		if err != nil {
+			log.Errorf("background pin of %s failed: %s", req.Cid, err)
+		}
+		q.done(req, err)
+	}
+}
+
+// pin fetches and pins a single request. Recursive pins are fetched before
+// the pin lock is taken, so garbage collection is not blocked while
+// fetching.
+func (q *Queue) pin(ctx context.Context, req *Request) error {
+	if req.MaxDepth < 0 {
+		if err := mdag.FetchGraph(ctx, req.Cid, q.dag); err != nil {
+			return err
+		}
+	}
+
+	defer q.locker.PinLock().Unlock()
+
+	nd, err := q.dag.Get(ctx, req.Cid)
+	if err != nil {
+		return err
+	}
+
+	if err := pin.PinWithMeta(ctx, q.pinning, nd, req.MaxDepth, req.Meta); err != nil {
+		return err
+	}
+	return q.pinning.Flush()
+}
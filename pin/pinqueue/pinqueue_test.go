@@ -0,0 +1,91 @@
+package pinqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bs "gx/ipfs/QmVDTbzzTwnuBwNbJdhW3u7LoBQp46bezm9yp4z1RoEepM/go-blockservice"
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewGCBlockstore(blockstore.NewBlockstore(dstore), blockstore.NewGCLocker())
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+	pinning := pin.NewPinner(dstore, dserv, dserv)
+
+	a := mdag.NodeWithData([]byte("queued pin"))
+	if err := dserv.Add(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	missing := mdag.NodeWithData([]byte("not stored anywhere"))
+
+	q, err := New(dstore, bstore, pinning, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add(a.Cid(), -1, pin.PinMeta{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add(missing.Cid(), -1, pin.PinMeta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue is persisted before being processed
+	q, err = New(dstore, bstore, pinning, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := q.Status(); len(st) != 2 || st[0].State != Queued || !st[0].Cid.Equals(a.Cid()) {
+		t.Fatalf("expected two queued requests, got %v", st)
+	}
+
+	go q.Run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req, err := q.Get(missing.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = q.Get(a.Cid())
+		if req.State == Failed && err == ErrNotQueued {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the queue to be processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, pinned, _ := pinning.IsPinnedWithType(a.Cid(), pin.Recursive); !pinned {
+		t.Fatal("expected the queued cid to be pinned")
+	}
+	if m, _ := pinning.Meta(a.Cid()); m.Name != "a" {
+		t.Fatal("expected the pin name to be set")
+	}
+
+	// failed requests are kept across restarts
+	cancel()
+	q, err = New(dstore, bstore, pinning, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := q.Get(missing.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != Failed || req.Err == "" {
+		t.Fatalf("expected a failed request with an error, got %v", req)
+	}
+}
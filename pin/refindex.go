@@ -0,0 +1,269 @@
+package pin
+
+import (
+	"context"
+	"errors"
+
+	mdag "gx/ipfs/QmdURv6Sbob8TVW2tFFve9vcEWrSUgwPqeqnXyvYhLrkyd/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// refIndexDatastorePrefix is the prefix of the reverse reference index.
+// It holds one empty entry per (descendant, recursive pin) pair, keyed as
+// <prefix>/<descendant>/<pin>.
+var refIndexDatastorePrefix = ds.NewKey("/local/refindex/refs")
+
+// refIndexBuiltKey is set once the index has been built from scratch and
+// can be trusted to answer indirect pin lookups.
+var refIndexBuiltKey = ds.NewKey("/local/refindex/built")
+
+// ErrNoRefIndex is returned when operating on the reverse reference index
+// of a pinner which does not maintain one.
+var ErrNoRefIndex = errors.New("pinner does not maintain a reference index")
+
+// refIndex maps the descendants of recursive pins to the pins they are
+// reachable from, so that indirect pins can be looked up instead of found
+// by walking every recursive pin.
+type refIndex struct {
+	dstore ds.Datastore
+
+	// built is true once the index covers every recursive pin.
+	built bool
+
+	// added and removed hold the recursive pins whose descendants are yet
+	// to be indexed or unindexed. They are processed on Flush.
+	added   *cid.Set
+	removed *cid.Set
+}
+
+// EnableRefIndex makes the given pinner maintain a persistent index from
+// the descendants of recursive pins to those pins. The index is only used
+// for lookups once it has been built with RebuildRefIndex; until then
+// indirect pins keep being found by walking the recursive pins.
+func EnableRefIndex(pn Pinner) error {
+	p, ok := pn.(*pinner)
+	if !ok {
+		return ErrNoRefIndex
+	}
+
+	built, err := p.dstore.Has(refIndexBuiltKey)
+	if err != nil {
+		return err
+	}
+	if !built {
+		log.Warning("the pin reference index needs to be built, run 'ipfs pin reindex'")
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.index = &refIndex{
+		dstore:  p.dstore,
+		built:   built,
+		added:   cid.NewSet(),
+		removed: cid.NewSet(),
+	}
+	return nil
+}
+
+// invalidateRefIndex marks the persisted index as needing a rebuild. It is
+// called before pins change while the index is not maintained, so that it
+// is not trusted again once re-enabled.
+func invalidateRefIndex(d ds.Datastore) error {
+	if err := d.Delete(refIndexBuiltKey); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func refIndexKey(child, root cid.Cid) ds.Key {
+	return refIndexDatastorePrefix.Child(dshelp.CidToDsKey(child)).Child(dshelp.CidToDsKey(root))
+}
+
+// pinAdded records that c became a recursive pin.
+func (idx *refIndex) pinAdded(c cid.Cid) {
+	idx.removed.Remove(c)
+	idx.added.Add(c)
+}
+
+// pinRemoved records that c is not a recursive pin anymore.
+func (idx *refIndex) pinRemoved(c cid.Cid) {
+	idx.added.Remove(c)
+	idx.removed.Add(c)
+}
+
+// roots returns the recursive pins the given cid has been indexed under.
+// The result may include pins which have been removed since.
+func (idx *refIndex) roots(c cid.Cid) ([]cid.Cid, error) {
+	prefix := refIndexDatastorePrefix.Child(dshelp.CidToDsKey(c)).String() + "/"
+	res, err := idx.dstore.Query(dsq.Query{Prefix: prefix, KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var out []cid.Cid
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := ds.RawKey(r.Key)
+		root, err := dshelp.DsKeyToCid(ds.NewKey(k.BaseNamespace()))
+		if err != nil {
+			log.Errorf("decoding cid from reference index key %s: %s", k, err)
+			continue
+		}
+		out = append(out, root)
+	}
+	return out, nil
+}
+
+// update writes or deletes the index entries for all the descendants of
+// root.
+func (idx *refIndex) update(ctx context.Context, ng ipld.NodeGetter, root cid.Cid, add bool) error {
+	set := cid.NewSet()
+	err := mdag.EnumerateChildren(ctx, mdag.GetLinksWithDAG(ng), root, set.Visit)
+	if err != nil {
+		return err
+	}
+
+	var w keyWriter = idx.dstore
+	var batch ds.Batch
+	if bds, ok := idx.dstore.(ds.Batching); ok {
+		b, err := bds.Batch()
+		if err != nil {
+			return err
+		}
+		w = b
+		batch = b
+	}
+
+	for _, c := range set.Keys() {
+		k := refIndexKey(c, root)
+		if add {
+			err = w.Put(k, []byte{})
+		} else {
+			err = w.Delete(k)
+			if err == ds.ErrNotFound {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if batch != nil {
+		return batch.Commit()
+	}
+	return nil
+}
+
+// flushAdded indexes the descendants of the recursive pins added since the
+// last flush. It runs before the pin state is written so the index never
+// misses a persisted pin.
+func (idx *refIndex) flushAdded(ctx context.Context, p *pinner) error {
+	for _, c := range idx.added.Keys() {
+		if !p.recursePin.Has(c) {
+			continue
+		}
+		if err := idx.update(ctx, p.internal, c, true); err != nil {
+			return err
+		}
+	}
+	idx.added = cid.NewSet()
+	return nil
+}
+
+// flushRemoved drops the entries of the recursive pins removed since the
+// last flush. It runs after the pin state is written; entries left behind
+// by an interrupted flush are ignored by lookups.
+func (idx *refIndex) flushRemoved(ctx context.Context, p *pinner) error {
+	for _, c := range idx.removed.Keys() {
+		if p.recursePin.Has(c) {
+			continue
+		}
+		if err := idx.update(ctx, p.internal, c, false); err != nil {
+			log.Warningf("could not remove %s from the reference index: %s", c, err)
+		}
+	}
+	idx.removed = cid.NewSet()
+	return nil
+}
+
+// indexedRoot finds the recursive pin through which c is pinned using the
+// reference index. Recursive pins not indexed yet are walked.
+func (p *pinner) indexedRoot(c cid.Cid) (cid.Cid, bool, error) {
+	roots, err := p.index.roots(c)
+	if err != nil {
+		return cid.Cid{}, false, err
+	}
+	for _, rc := range roots {
+		if p.recursePin.Has(rc) {
+			return rc, true, nil
+		}
+	}
+
+	visitedSet := cid.NewSet()
+	for _, rc := range p.index.added.Keys() {
+		if !p.recursePin.Has(rc) {
+			continue
+		}
+		has, err := hasChild(p.dserv, rc, c, visitedSet.Visit)
+		if err != nil {
+			return cid.Cid{}, false, err
+		}
+		if has {
+			return rc, true, nil
+		}
+	}
+	return cid.Cid{}, false, nil
+}
+
+// RebuildRefIndex rebuilds the reverse reference index from scratch by
+// walking every recursive pin.
+func (p *pinner) RebuildRefIndex(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.index == nil {
+		return ErrNoRefIndex
+	}
+
+	if err := invalidateRefIndex(p.dstore); err != nil {
+		return err
+	}
+	p.index.built = false
+
+	res, err := p.dstore.Query(dsq.Query{Prefix: refIndexDatastorePrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := p.dstore.Delete(ds.RawKey(e.Key)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+
+	for _, c := range p.recursePin.Keys() {
+		if err := p.index.update(ctx, p.internal, c, true); err != nil {
+			return err
+		}
+	}
+	p.index.added = cid.NewSet()
+	p.index.removed = cid.NewSet()
+
+	if err := p.dstore.Put(refIndexBuiltKey, []byte{}); err != nil {
+		return err
+	}
+	p.index.built = true
+	return nil
+}
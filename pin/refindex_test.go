@@ -0,0 +1,146 @@
+package pin
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRefIndex(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	p := NewPinner(dstore, dserv, dserv)
+	if err := EnableRefIndex(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// A{B{C}}
+	c, ck := randNode()
+	b, bk := randNode()
+	if err := b.AddNodeLink("c", c); err != nil {
+		t.Fatal(err)
+	}
+	a, ak := randNode()
+	if err := a.AddNodeLink("b", b); err != nil {
+		t.Fatal(err)
+	}
+	dserv.Add(ctx, c)
+	dserv.Add(ctx, b)
+	dserv.Add(ctx, a)
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RebuildRefIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	via, pinned, err := p.IsPinnedWithType(ck, Indirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned || via != ak.String() {
+		t.Fatalf("expected C to be pinned through A, got %q", via)
+	}
+
+	// pins added since the last flush are found too
+	d, dk := randNode()
+	if err := d.AddNodeLink("c", c); err != nil {
+		t.Fatal(err)
+	}
+	dserv.Add(ctx, d)
+	if err := p.Pin(ctx, d, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unpin(ctx, ak, true); err != nil {
+		t.Fatal(err)
+	}
+
+	via, pinned, err = p.IsPinnedWithType(ck, Indirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned || via != dk.String() {
+		t.Fatalf("expected C to be pinned through D, got %q", via)
+	}
+	assertUnpinned(t, p, bk, "B should not be pinned anymore")
+
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableRefIndex(np); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := np.CheckIfPinned(bk, ck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res {
+		switch {
+		case r.Key.Equals(bk) && r.Mode != NotPinned:
+			t.Fatalf("expected B not to be pinned, got %s", r)
+		case r.Key.Equals(ck) && (r.Mode != Indirect || !r.Via.Equals(dk)):
+			t.Fatalf("expected C to be pinned through D, got %s", r)
+		}
+	}
+}
+
+func TestRefIndexStaleAfterDisabled(t *testing.T) {
+	ctx := context.Background()
+	dstore, dserv := newTestDag()
+
+	p := NewPinner(dstore, dserv, dserv)
+	if err := EnableRefIndex(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RebuildRefIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// pin A{B} while the index is disabled
+	np, err := LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, bk := randNode()
+	a, ak := randNode()
+	if err := a.AddNodeLink("b", b); err != nil {
+		t.Fatal(err)
+	}
+	dserv.Add(ctx, b)
+	dserv.Add(ctx, a)
+	if err := np.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := np.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index built before must not be trusted once enabled again
+	np, err = LoadPinner(dstore, dserv, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableRefIndex(np); err != nil {
+		t.Fatal(err)
+	}
+	res, err := np.CheckIfPinned(bk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Mode != Indirect || !res[0].Via.Equals(ak) {
+		t.Fatalf("expected B to be pinned through A, got %s", res[0])
+	}
+}
@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// MockService is an in-memory pinning service, meant to stand in for a real
+// one in tests when served with net/http/httptest.
+//
+// It does not fetch anything. New pin requests are queued, and every lookup
+// of a single request moves it one step further, from queued to pinning and
+// from pinning to pinned. Lists are paged, 10 requests per page by default.
+type MockService struct {
+	key string
+
+	lock        sync.Mutex
+	requests    map[string]*PinStatus
+	nextID      int
+	lastCreated time.Time
+}
+
+// NewMockService returns a MockService accepting the given key.
+func NewMockService(key string) *MockService {
+	return &MockService{
+		key:      key,
+		requests: make(map[string]*PinStatus),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (m *MockService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+m.key {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid access token")
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/pins/")
+	switch {
+	case r.URL.Path == "/pins" && r.Method == "POST":
+		m.add(w, r)
+	case r.URL.Path == "/pins" && r.Method == "GET":
+		m.ls(w, r)
+	case id != r.URL.Path && r.Method == "GET":
+		st, ok := m.requests[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "no such pin request")
+			return
+		}
+		switch st.Status {
+		case Queued:
+			st.Status = Pinning
+		case Pinning:
+			st.Status = Pinned
+		}
+		writeJSON(w, http.StatusOK, st)
+	case id != r.URL.Path && r.Method == "DELETE":
+		if _, ok := m.requests[id]; !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "no such pin request")
+			return
+		}
+		delete(m.requests, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("unsupported request %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (m *MockService) add(w http.ResponseWriter, r *http.Request) {
+	var p Pin
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if _, err := cid.Decode(p.Cid); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	// the creation times are distinct, so that pages can be requested
+	// with before
+	created := time.Now()
+	if !created.After(m.lastCreated) {
+		created = m.lastCreated.Add(time.Nanosecond)
+	}
+	m.lastCreated = created
+
+	m.nextID++
+	st := &PinStatus{
+		RequestID: fmt.Sprintf("req-%d", m.nextID),
+		Status:    Queued,
+		Created:   created,
+		Pin:       p,
+		Delegates: []string{},
+	}
+	m.requests[st.RequestID] = st
+	writeJSON(w, http.StatusAccepted, st)
+}
+
+func (m *MockService) ls(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	statuses := map[Status]bool{Pinned: true}
+	if s := q.Get("status"); s != "" {
+		statuses = make(map[Status]bool)
+		for _, st := range strings.Split(s, ",") {
+			statuses[Status(st)] = true
+		}
+	}
+	var cids map[string]bool
+	if c := q.Get("cid"); c != "" {
+		cids = make(map[string]bool)
+		for _, k := range strings.Split(c, ",") {
+			cids[k] = true
+		}
+	}
+	name := q.Get("name")
+	var before time.Time
+	if b := q.Get("before"); b != "" {
+		var err error
+		if before, err = time.Parse(time.RFC3339Nano, b); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+	}
+	limit := 10
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > 1000 {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid limit")
+			return
+		}
+	}
+
+	res := pinResults{Results: []PinStatus{}}
+	for _, st := range m.requests {
+		if !statuses[st.Status] ||
+			(cids != nil && !cids[st.Pin.Cid]) ||
+			(name != "" && st.Pin.Name != name) ||
+			(!before.IsZero() && !st.Created.Before(before)) {
+			continue
+		}
+		res.Results = append(res.Results, *st)
+	}
+	sort.Slice(res.Results, func(i, j int) bool {
+		return res.Results[i].Created.After(res.Results[j].Created)
+	})
+	res.Count = len(res.Results)
+	if len(res.Results) > limit {
+		res.Results = res.Results[:limit]
+	}
+	writeJSON(w, http.StatusOK, &res)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, reason, details string) {
+	var er errorResponse
+	er.Error.Reason = reason
+	er.Error.Details = details
+	writeJSON(w, code, &er)
+}
@@ -0,0 +1,300 @@
+// Package remote implements a client for remote pinning services, which keep
+// content pinned on behalf of the local node.
+//
+// Services are spoken to over HTTP using the pinning service API: pin
+// requests are created with POST /pins, listed with GET /pins, looked up
+// with GET /pins/{requestid} and removed with DELETE /pins/{requestid}.
+// Requests are authenticated with a bearer token.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// Status is the status of a pin request on a remote service.
+type Status string
+
+const (
+	// Queued pin requests are waiting to be processed by the service.
+	Queued Status = "queued"
+
+	// Pinning pin requests are being fetched by the service.
+	Pinning Status = "pinning"
+
+	// Pinned pin requests are complete.
+	Pinned Status = "pinned"
+
+	// Failed pin requests could not be completed.
+	Failed Status = "failed"
+)
+
+// ParseStatus parses a pin request status.
+func ParseStatus(s string) (Status, error) {
+	switch st := Status(s); st {
+	case Queued, Pinning, Pinned, Failed:
+		return st, nil
+	default:
+		return "", fmt.Errorf("invalid remote pin status %q, must be one of {queued, pinning, pinned, failed}", s)
+	}
+}
+
+// Pin is the object a pin request is about.
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus is a pin request as tracked by a remote service.
+type PinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    Status            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+// pinResults is the response to GET /pins. Count is the number of pin
+// requests matching the query, of which Results holds a page.
+type pinResults struct {
+	Count   int         `json:"count"`
+	Results []PinStatus `json:"results"`
+}
+
+// Error is returned when a service answers a request with an error.
+type Error struct {
+	StatusCode int
+	Reason     string
+	Details    string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("remote pinning service error (%d)", e.StatusCode)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return msg
+}
+
+// errorResponse is the body of error responses.
+type errorResponse struct {
+	Error struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details,omitempty"`
+	} `json:"error"`
+}
+
+// requestTimeout bounds every request to a remote service, so that an
+// unresponsive service cannot hang the commands using it.
+const requestTimeout = time.Minute
+
+// Client talks to a single remote pinning service.
+type Client struct {
+	endpoint string
+	key      string
+	http     *http.Client
+}
+
+// NewClient returns a client for the service at the given endpoint,
+// authenticating with the given key.
+func NewClient(endpoint, key string) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		key:      key,
+		http:     &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// AddOptions holds the optional fields of a new pin request.
+type AddOptions struct {
+	Name    string
+	Origins []string
+	Meta    map[string]string
+}
+
+// Add asks the service to pin the given cid.
+func (c *Client) Add(ctx context.Context, k cid.Cid, opts AddOptions) (*PinStatus, error) {
+	body, err := json.Marshal(&Pin{
+		Cid:     k.String(),
+		Name:    opts.Name,
+		Origins: opts.Origins,
+		Meta:    opts.Meta,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var st PinStatus
+	if err := c.do(ctx, "POST", "/pins", nil, bytes.NewReader(body), &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// LsOptions filters the pin requests returned by Ls.
+type LsOptions struct {
+	Cids   []cid.Cid
+	Name   string
+	Status []Status
+
+	// Limit is the maximum number of results, 0 for all of them.
+	Limit int
+}
+
+// pageSize is the number of results requested at once by Ls, the maximum
+// allowed by the pinning service API.
+const pageSize = 1000
+
+// Ls lists the pin requests known to the service which match the given
+// filters, most recent first. Without a status filter, only pinned objects
+// are listed. The results are requested page by page, until as many as the
+// service counted are listed.
+func (c *Client) Ls(ctx context.Context, opts LsOptions) ([]PinStatus, error) {
+	q := url.Values{}
+	if len(opts.Cids) > 0 {
+		cids := make([]string, len(opts.Cids))
+		for i, k := range opts.Cids {
+			cids[i] = k.String()
+		}
+		q.Set("cid", strings.Join(cids, ","))
+	}
+	if opts.Name != "" {
+		q.Set("name", opts.Name)
+	}
+	if len(opts.Status) > 0 {
+		st := make([]string, len(opts.Status))
+		for i, s := range opts.Status {
+			st[i] = string(s)
+		}
+		q.Set("status", strings.Join(st, ","))
+	}
+
+	var out []PinStatus
+	count := -1
+	for {
+		limit := pageSize
+		if opts.Limit > 0 && opts.Limit-len(out) < limit {
+			limit = opts.Limit - len(out)
+		}
+		q.Set("limit", strconv.Itoa(limit))
+
+		var res pinResults
+		if err := c.do(ctx, "GET", "/pins", q, nil, &res); err != nil {
+			return nil, err
+		}
+		// the count of the next pages only covers the requests created
+		// before their first one
+		if count < 0 {
+			count = res.Count
+		}
+		out = append(out, res.Results...)
+
+		if len(res.Results) == 0 || len(out) >= count || (opts.Limit > 0 && len(out) >= opts.Limit) {
+			return out, nil
+		}
+		q.Set("before", res.Results[len(res.Results)-1].Created.Format(time.RFC3339Nano))
+	}
+}
+
+// Get returns the pin request with the given id.
+func (c *Client) Get(ctx context.Context, requestID string) (*PinStatus, error) {
+	var st PinStatus
+	if err := c.do(ctx, "GET", "/pins/"+url.PathEscape(requestID), nil, nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Rm removes the pin request with the given id.
+func (c *Client) Rm(ctx context.Context, requestID string) error {
+	return c.do(ctx, "DELETE", "/pins/"+url.PathEscape(requestID), nil, nil, nil)
+}
+
+// Polling intervals used by Wait. The interval doubles after every poll.
+const (
+	minPollInterval = 100 * time.Millisecond
+	maxPollInterval = 10 * time.Second
+)
+
+// Wait polls the pin request with the given id until it is pinned or has
+// failed, and returns its last status.
+func (c *Client) Wait(ctx context.Context, requestID string) (*PinStatus, error) {
+	interval := minPollInterval
+	for {
+		st, err := c.Get(ctx, requestID)
+		if err != nil {
+			return nil, err
+		}
+		if st.Status == Pinned || st.Status == Failed {
+			return st, nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if interval *= 2; interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body io.Reader, out interface{}) error {
+	u := c.endpoint + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.key)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		rerr := &Error{StatusCode: resp.StatusCode}
+		var er errorResponse
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, &er) == nil && er.Error.Reason != "" {
+			rerr.Reason = er.Error.Reason
+			rerr.Details = er.Error.Details
+		} else {
+			rerr.Reason = http.StatusText(resp.StatusCode)
+		}
+		return rerr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,120 @@
+package remote
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+var testCid, _ = cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(NewMockService("secret"))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "secret")
+
+	st, err := c.Add(ctx, testCid, AddOptions{Name: "foo", Meta: map[string]string{"owner": "ci"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != Queued || st.Pin.Cid != testCid.String() || st.Pin.Name != "foo" {
+		t.Fatalf("unexpected pin status: %+v", st)
+	}
+
+	// only pinned requests are listed by default
+	list, err := c.Ls(ctx, LsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected no pinned requests, got %d", len(list))
+	}
+
+	st, err = c.Wait(ctx, st.RequestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != Pinned {
+		t.Fatalf("expected request to be pinned, got %s", st.Status)
+	}
+
+	list, err = c.Ls(ctx, LsOptions{Name: "foo", Cids: []cid.Cid{testCid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].RequestID != st.RequestID {
+		t.Fatalf("unexpected pin list: %+v", list)
+	}
+
+	list, err = c.Ls(ctx, LsOptions{Name: "bar", Status: []Status{Queued, Pinning, Pinned, Failed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("expected the name filter to exclude the pin, got %d", len(list))
+	}
+
+	if err := c.Rm(ctx, st.RequestID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Get(ctx, st.RequestID)
+	if rerr, ok := err.(*Error); !ok || rerr.StatusCode != 404 || rerr.Reason != "NOT_FOUND" {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(NewMockService("secret"))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "wrong")
+	_, err := c.Add(context.Background(), testCid, AddOptions{})
+	if rerr, ok := err.(*Error); !ok || rerr.StatusCode != 401 {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestClientLsPages(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(NewMockService("secret"))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "secret")
+
+	all := []Status{Queued, Pinning, Pinned, Failed}
+	seen := make(map[string]bool)
+	for i := 0; i < pageSize+5; i++ {
+		st, err := c.Add(ctx, testCid, AddOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[st.RequestID] = false
+	}
+
+	list, err := c.Ls(ctx, LsOptions{Status: all})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(seen) {
+		t.Fatalf("expected %d requests, got %d", len(seen), len(list))
+	}
+	for _, st := range list {
+		if seen[st.RequestID] {
+			t.Fatalf("request %s listed twice", st.RequestID)
+		}
+		seen[st.RequestID] = true
+	}
+
+	list, err = c.Ls(ctx, LsOptions{Status: all, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("expected the limit to apply, got %d requests", len(list))
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	filestore "github.com/ipfs/go-ipfs/filestore"
 	keystore "github.com/ipfs/go-ipfs/keystore"
+	common "github.com/ipfs/go-ipfs/repo/common"
 
 	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
 	config "gx/ipfs/QmXctaABKwgzmQgNM4bucMJf7zJnxxvhmPM1Pw95dxUfB5/go-ipfs-config"
@@ -17,6 +18,10 @@ type Mock struct {
 	C config.Config
 	D Datastore
 	K keystore.Keystore
+
+	// cfgMap holds the config as set by SetConfigKey, including keys
+	// unknown to config.Config. It is rebuilt from C when nil.
+	cfgMap map[string]interface{}
 }
 
 func (m *Mock) Config() (*config.Config, error) {
@@ -25,6 +30,7 @@ func (m *Mock) Config() (*config.Config, error) {
 
 func (m *Mock) SetConfig(updated *config.Config) error {
 	m.C = *updated // FIXME threadsafety
+	m.cfgMap = nil
 	return nil
 }
 
@@ -32,12 +38,39 @@ func (m *Mock) BackupConfig(prefix string) (string, error) {
 	return "", errTODO
 }
 
+func (m *Mock) configMap() (map[string]interface{}, error) {
+	if m.cfgMap == nil {
+		cfg, err := config.ToMap(&m.C)
+		if err != nil {
+			return nil, err
+		}
+		m.cfgMap = cfg
+	}
+	return m.cfgMap, nil
+}
+
 func (m *Mock) SetConfigKey(key string, value interface{}) error {
-	return errTODO
+	cfg, err := m.configMap()
+	if err != nil {
+		return err
+	}
+	if err := common.MapSetKV(cfg, key, value); err != nil {
+		return err
+	}
+	conf, err := config.FromMap(cfg)
+	if err != nil {
+		return err
+	}
+	m.C = *conf
+	return nil
 }
 
 func (m *Mock) GetConfigKey(key string) (interface{}, error) {
-	return nil, errTODO
+	cfg, err := m.configMap()
+	if err != nil {
+		return nil, err
+	}
+	return common.MapGetKV(cfg, key)
 }
 
 func (m *Mock) Datastore() Datastore { return m.D }
@@ -62,3 +62,21 @@ type Datastore interface {
 	ds.Batching // should be threadsafe, just be careful
 	io.Closer
 }
+
+// ConfigBool reads a boolean config key which is not part of the config
+// struct. Missing or unreadable keys are treated as false.
+func ConfigBool(r Repo, key string) bool {
+	v, err := r.GetConfigKey(key)
+	if err != nil {
+		return false
+	}
+
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
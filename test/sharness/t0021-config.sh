@@ -159,6 +159,42 @@ test_config_cmd() {
     sed -i"~" -e '\''s/privkey/PrivKey/'\'' "$IPFS_PATH/config"
   '
 
+  # Those tests are here to prevent exposing the urlstore headers on the network
+
+  test_expect_success "set the urlstore headers" '
+    ipfs config --json Urlstore.Headers "{\"localhost\": {\"Authorization\": \"Bearer secret-token\"}}"
+  '
+
+  test_expect_success "'ipfs config show' redacts the urlstore headers" '
+    ipfs config show >show_out &&
+    grep "\"Authorization\": \"<redacted>\"" show_out &&
+    test_must_fail grep secret-token show_out
+  '
+
+  test_expect_success "'ipfs config' redacts the urlstore headers" '
+    ipfs config Urlstore.Headers >headers_out &&
+    ipfs config Urlstore.Headers.localhost.Authorization >>headers_out &&
+    grep "<redacted>" headers_out &&
+    test_must_fail grep secret-token headers_out
+  '
+
+  test_expect_success "the urlstore headers are kept in the config file" '
+    grep secret-token "$IPFS_PATH/config"
+  '
+
+  test_expect_success "set a remote pinning service" '
+    ipfs config --json Pinning.RemoteServices "{\"mysvc\": {\"Endpoint\": \"https://pinning.example.com\", \"Key\": \"secret-key\"}}"
+  '
+
+  test_expect_success "'ipfs config' redacts the remote pinning service keys" '
+    ipfs config show >show_out &&
+    ipfs config Pinning >>show_out &&
+    ipfs config Pinning.RemoteServices.mysvc.Key >>show_out &&
+    grep "https://pinning.example.com" show_out &&
+    grep "<redacted>" show_out &&
+    test_must_fail grep secret-key show_out
+  '
+
   test_expect_success "'ipfs config show' doesn't include privkey" '
     ipfs config show > show_config &&
     test_expect_code 1 grep PrivKey show_config
@@ -117,6 +117,59 @@ test_expect_success "'ipfs repo gc' removes file" '
   grep "removed $PATCH_ROOT" actual7
 '
 
+test_expect_success "'ipfs repo gc --dry-run' lists unpinned objects without removing them" '
+  DRY=`echo "dry run gc" | ipfs add -q --pin=false` &&
+  ipfs repo gc --dry-run >actual_dry 2>summary_dry &&
+  grep "would remove $DRY (19 bytes)" actual_dry &&
+  grep "would remove [0-9]* blocks" summary_dry &&
+  ipfs refs local >actual_dry_refs &&
+  grep "$DRY" actual_dry_refs &&
+  ipfs repo gc >actual_dry_gc &&
+  grep "removed $DRY" actual_dry_gc
+'
+
+test_expect_success "'ipfs repo gc protect add' protects objects from gc" '
+  PROTECTED=`echo "protected from gc" | ipfs add -q --pin=false` &&
+  PROTECTED_NAME=`echo "protected by name" | ipfs add -q --pin=false` &&
+  ipfs name publish --allow-offline -Q "/ipfs/$PROTECTED_NAME" >protect_name &&
+  ipfs repo gc protect add "/ipfs/$PROTECTED" "/ipns/`cat protect_name`" >actual_protect &&
+  grep "protected /ipfs/$PROTECTED" actual_protect &&
+  ipfs repo gc protect ls >actual_protect_ls &&
+  grep "/ipfs/$PROTECTED" actual_protect_ls &&
+  grep "/ipns/`cat protect_name`" actual_protect_ls &&
+  ipfs repo gc >actual_protect_gc &&
+  test_must_fail grep "$PROTECTED" actual_protect_gc &&
+  test_must_fail grep "$PROTECTED_NAME" actual_protect_gc
+'
+
+test_expect_success "'ipfs repo gc protect rm' lets gc remove objects" '
+  ipfs repo gc protect rm "/ipfs/$PROTECTED" "/ipns/`cat protect_name`" >actual_unprotect &&
+  grep "unprotected /ipfs/$PROTECTED" actual_unprotect &&
+  ipfs repo gc protect ls >actual_protect_ls &&
+  test_must_be_empty actual_protect_ls &&
+  ipfs repo gc >actual_unprotect_gc &&
+  grep "removed $PROTECTED" actual_unprotect_gc &&
+  grep "removed $PROTECTED_NAME" actual_unprotect_gc
+'
+
+test_expect_success "'ipfs repo gc' fails when a protected path never resolved" '
+  UNRESOLVED=`ipfs key gen --type=ed25519 unresolved` &&
+  ipfs repo gc protect add "/ipns/$UNRESOLVED" &&
+  test_must_fail ipfs repo gc 2>unresolved_gc &&
+  grep "cannot resolve the protected root /ipns/$UNRESOLVED" unresolved_gc &&
+  ipfs repo gc protect rm "/ipns/$UNRESOLVED"
+'
+
+test_expect_success "'ipfs repo gc --concurrent' removes unpinned objects" '
+  CGC=`echo "concurrent gc" | ipfs add -q --pin=false` &&
+  CGC_PINNED=`echo "concurrent gc pinned" | ipfs add -q` &&
+  ipfs repo gc --concurrent >actual_cgc &&
+  grep "removed $CGC" actual_cgc &&
+  test_must_fail grep "$CGC_PINNED" actual_cgc &&
+  ipfs pin rm "$CGC_PINNED" &&
+  ipfs repo gc
+'
+
 test_expect_success "'ipfs refs local' no longer shows file" '
   EMPTY_DIR=QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn &&
   ipfs refs local >actual8 &&
@@ -125,8 +125,164 @@ test_pin_progress() {
   '
 }
 
+test_pin_name() {
+  test_expect_success "'ipfs add' files to name" '
+    FOO=`echo "foo pin" | ipfs add -q --pin=false` &&
+    BAR=`echo "bar pin" | ipfs add -q --pin=false`
+  '
+
+  test_expect_success "'ipfs pin add --name' works" '
+    ipfs pin add --name=project-foo --meta=owner=ci $FOO &&
+    ipfs pin add --name=project-bar $BAR
+  '
+
+  test_expect_success "'ipfs pin ls --name' filters by name" '
+    echo "$FOO recursive project-foo" > expected &&
+    ipfs pin ls --name=foo > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin ls --name' filters the given paths" '
+    echo "$FOO recursive project-foo" > expected &&
+    ipfs pin ls --name=foo $FOO $BAR > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin rm' named pins" '
+    ipfs pin rm $FOO $BAR
+  '
+}
+
+test_pin_max_depth() {
+  test_expect_success "'ipfs add' a nested directory" '
+    mkdir -p deep/sub &&
+    echo "deep file" > deep/sub/file &&
+    ipfs add -r -q --pin=false deep > deep_hashes &&
+    FILE=`sed -n 1p deep_hashes` &&
+    SUB=`sed -n 2p deep_hashes` &&
+    DEEP=`sed -n 3p deep_hashes`
+  '
+
+  test_expect_success "'ipfs pin add --max-depth' works" '
+    echo "pinned $DEEP recursively down to depth 1" > expected &&
+    ipfs pin add --max-depth=1 $DEEP > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin ls --type=depth-limited' lists the pin" '
+    echo "$DEEP depth-limited (max depth 1)" > expected &&
+    ipfs pin ls --type=depth-limited > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "children within the depth are pinned indirectly" '
+    echo "$SUB indirect through $DEEP" > expected &&
+    ipfs pin ls $SUB > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "children below the depth are not pinned" '
+    test_must_fail ipfs pin ls $FILE
+  '
+
+  test_expect_success "'ipfs pin verify' checks depth limited pins" '
+    ipfs pin verify --verbose > verify_out &&
+    grep "$DEEP ok" verify_out
+  '
+
+  test_expect_success "'ipfs pin rm' depth limited pin" '
+    ipfs pin rm $DEEP
+  '
+}
+
+test_pin_export() {
+  test_expect_success "'ipfs pin export' and pin some content" '
+    EXP=`echo "exported pin" | ipfs add -q --pin=false` &&
+    ipfs pin add --name=exported $EXP &&
+    ipfs pin export > pins.json &&
+    grep "$EXP" pins.json &&
+    ipfs pin export --format=cbor > pins.cbor
+  '
+
+  test_expect_success "'ipfs pin import --dry-run' reports present roots" '
+    ipfs pin rm $EXP &&
+    echo "$EXP recursive present" > expected &&
+    ipfs pin import --dry-run pins.json | grep $EXP > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin import' re-creates the pins" '
+    ipfs pin import --format=cbor pins.cbor &&
+    echo "$EXP recursive exported" > expected &&
+    ipfs pin ls --name=exported > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin import' reports missing content" '
+    ipfs pin rm $EXP &&
+    ipfs block rm $EXP &&
+    echo "$EXP recursive missing" > expected &&
+    ipfs pin import pins.json | grep $EXP > actual &&
+    test_cmp expected actual &&
+    test_must_fail ipfs pin ls $EXP
+  '
+
+  test_expect_success "'ipfs pin import --dry-run' reports partially stored pins as missing" '
+    PARTIAL=`random 1048576 42 | ipfs add -q` &&
+    ipfs pin export > partial.json &&
+    ipfs pin rm $PARTIAL &&
+    PARTIAL_CHILD=`ipfs refs $PARTIAL | head -1` &&
+    ipfs block rm $PARTIAL_CHILD &&
+    echo "$PARTIAL recursive missing" > expected &&
+    ipfs pin import --dry-run partial.json | grep $PARTIAL > actual &&
+    test_cmp expected actual
+  '
+}
+
+test_pin_repair() {
+  test_expect_success "pin a file and remove one of its blocks" '
+    random 1048576 57 > repairfile &&
+    REPAIR=`ipfs add -q repairfile` &&
+    REPAIR_PART=`ipfs refs $REPAIR | head -1` &&
+    ipfs block get $REPAIR_PART > repair_part &&
+    REPAIR_PART_FILE=`find .ipfs/blocks -name "*.data" -exec cmp -s repair_part {} \; -print` &&
+    test -n "$REPAIR_PART_FILE" &&
+    rm "$REPAIR_PART_FILE" &&
+    test_must_fail ipfs block stat $REPAIR_PART
+  '
+
+  test_expect_success "'ipfs pin verify --repair' reports the block it can't fetch offline" '
+    ipfs pin verify --repair > repair_out &&
+    grep "$REPAIR broken" repair_out &&
+    grep "  $REPAIR_PART: " repair_out
+  '
+
+  test_expect_success "'ipfs pin verify --repair --quiet' only writes broken pins" '
+    echo "$REPAIR" > expected &&
+    ipfs pin verify --repair --quiet > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "remove the broken pin" '
+    ipfs pin rm $REPAIR
+  '
+}
+
 test_init_ipfs
 
+test_expect_success "'ipfs pin add --background' queues the pin" '
+  BG=`echo "background pin" | ipfs add -q --pin=false` &&
+  echo "queued $BG to be pinned recursively" > expected &&
+  ipfs pin add --background $BG > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs pin status' lists queued pins" '
+  echo "$BG queued" > expected &&
+  ipfs pin status > actual &&
+  test_cmp expected actual
+'
+
 test_pins
 test_pins --progress
 
@@ -138,8 +294,27 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_name
+
+test_pin_max_depth
+
+test_pin_export
+
+test_pin_repair
+
 test_launch_ipfs_daemon --offline
 
+test_expect_success "queued pins are processed by the daemon" '
+  for i in $(test_seq 1 100)
+  do
+    ipfs pin ls --type=recursive $BG >/dev/null 2>&1 && break
+    go-sleep 100ms
+  done &&
+  ipfs pin ls --type=recursive $BG &&
+  ipfs pin status > actual &&
+  test_must_be_empty actual
+'
+
 test_pins
 test_pins --progress
 
@@ -151,6 +326,14 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_name
+
+test_pin_max_depth
+
+test_pin_export
+
+test_pin_repair
+
 test_kill_ipfs_daemon
 
 test_done
@@ -114,6 +114,34 @@ test_expect_success "publish an explicit node ID as key name looks good" '
   test_cmp expected_node_id_publish actual_node_id_publish
 '
 
+# test the publish history
+
+test_expect_success "'ipfs name history' lists the published values" '
+  ipfs name publish --allow-offline --key=keyname "/ipfs/$HASH_WELCOME_DOCS/help" &&
+  ipfs name history keyname | cut -d" " -f1,3 >history_out &&
+  printf "0 /ipfs/%s\n1 /ipfs/%s/help\n" "$HASH_WELCOME_DOCS" "$HASH_WELCOME_DOCS" >expected_history &&
+  test_cmp expected_history history_out
+'
+
+test_expect_success "'ipfs name rollback' publishes a previous value" '
+  ipfs name rollback --allow-offline --to=0 keyname >rollback_out &&
+  echo "Published to ${NEWID}: /ipfs/$HASH_WELCOME_DOCS" >expected_rollback &&
+  test_cmp expected_rollback rollback_out &&
+  ipfs name resolve "$NEWID" >output &&
+  printf "/ipfs/%s\n" "$HASH_WELCOME_DOCS" >expected_resolve &&
+  test_cmp expected_resolve output
+'
+
+test_expect_success "the rollback has a new sequence number" '
+  ipfs name history "$NEWID" | cut -d" " -f1,3 >history_out &&
+  printf "2 /ipfs/%s\n" "$HASH_WELCOME_DOCS" >>expected_history &&
+  test_cmp expected_history history_out
+'
+
+test_expect_success "'ipfs name rollback' to an unknown sequence number fails" '
+  test_must_fail ipfs name rollback --allow-offline --to=5 keyname
+'
+
 # test IPNS + IPLD
 test_expect_success "'ipfs dag put' succeeds" '
   HELLO_HASH="$(echo "\"hello world\"" | ipfs dag put)" &&
@@ -158,6 +186,58 @@ test_expect_success "'ipfs name publish --help' succeeds" '
   ipfs name publish --help
 '
 
+# test the persistent resolve cache
+
+test_expect_success "enable the persistent resolve cache" '
+  ipfs config --json Names.PersistentResolveCache true
+'
+
+test_expect_success "'ipfs name resolve' caches the record" '
+  ipfs name publish --allow-offline "/ipfs/$HASH_WELCOME_DOCS" &&
+  ipfs name resolve "$PEERID" >output &&
+  test_cmp expected2 output
+'
+
+test_expect_success "'ipfs name cache ls' lists the persisted record" '
+  ipfs name cache ls >cache_out &&
+  test_line_count = 1 cache_out &&
+  grep "^$PEERID /ipfs/$HASH_WELCOME_DOCS .* persistent$" cache_out
+'
+
+test_expect_success "'ipfs name cache clear' removes it" '
+  ipfs name cache clear >clear_out &&
+  echo "cleared 1 names" >expected_clear &&
+  test_cmp expected_clear clear_out &&
+  ipfs name cache ls >cache_out &&
+  test_must_be_empty cache_out
+'
+
+test_expect_success "disable the persistent resolve cache" '
+  ipfs config --json Names.PersistentResolveCache false
+'
+
+# test the static names
+
+test_expect_success "configure static names" '
+  ipfs config --json Names.Static "{\"wiki\": \"/ipfs/$HASH_WELCOME_DOCS\"}" &&
+  echo "/ipfs/$HASH_WELCOME_DOCS/readme blog # comment" >static_names &&
+  ipfs config Names.StaticFile "$(pwd)/static_names"
+'
+
+test_expect_success "'ipfs name resolve' resolves the static names" '
+  ipfs name resolve wiki >output &&
+  printf "/ipfs/$HASH_WELCOME_DOCS\n" >expected_static &&
+  test_cmp expected_static output &&
+  ipfs name resolve blog >output &&
+  printf "/ipfs/$HASH_WELCOME_DOCS/readme\n" >expected_static &&
+  test_cmp expected_static output
+'
+
+test_expect_success "remove the static names" '
+  ipfs config --json Names.Static "{}" &&
+  ipfs config Names.StaticFile ""
+'
+
 test_launch_ipfs_daemon
 
 test_expect_success "empty request to name publish doesn't panic and returns error" '
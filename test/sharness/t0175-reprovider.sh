@@ -145,9 +145,38 @@ findprovs_empty '$HASH_0'
 reprovide
 findprovs_expect '$HASH_0' '$PEERID_0'
 
+test_expect_success "'ipfs stats provide' shows the last run" '
+  ipfsi 0 stats provide > stats_provide &&
+  grep "idle" stats_provide &&
+  grep "next run: on demand" stats_provide &&
+  grep "last runs \[1\]" stats_provide
+'
+
+test_expect_success "added roots are provided through the provide queue" '
+  HASH_QUEUED=$(echo "queued" | ipfsi 0 add -q) &&
+  for i in $(test_seq 1 50); do
+    ipfsi 0 stats provide > stats_provide &&
+    grep "0 pending, 0 retrying" stats_provide && break
+    sleep 0.2
+  done &&
+  grep "0 pending, 0 retrying" stats_provide &&
+  grep "provided, 0 failed attempts since start" stats_provide
+'
+findprovs_expect '$HASH_QUEUED' '$PEERID_0'
+
 test_expect_success 'resolve object $HASH_0' '
   HASH_WITH_PREFIX=$(ipfsi 1 resolve $HASH_0)
 '
 findprovs_expect '$HASH_WITH_PREFIX' '$PEERID_0'
 
+test_expect_success 'stop the nodes' '
+  iptb stop
+'
+
+test_expect_success "'ipfs stats provide' shows the stored runs offline" '
+  ipfsi 0 stats provide > stats_provide &&
+  grep "offline" stats_provide &&
+  grep "last runs \[1\]" stats_provide
+'
+
 test_done
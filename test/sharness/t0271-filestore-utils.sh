@@ -109,6 +109,11 @@ test_filestore_verify() {
     test_cmp verify_expect_file_order verify_actual
   '
 
+  test_expect_success "ipfs filestore verify --quick' output looks good'" '
+    ipfs filestore verify --quick | LC_ALL=C sort > verify_actual
+    test_cmp verify_expect_key_order verify_actual
+  '
+
   test_expect_success "'ipfs filestore verify HASH' works" '
     ipfs filestore verify $FILE1_HASH > verify_actual &&
     grep -q somedir/file1 verify_actual
@@ -149,6 +154,11 @@ test_filestore_verify() {
     grep changed verify_actual | grep -q somedir/file3
   '
 
+  test_expect_success "'ipfs filestore verify --quick' shows file as changed" '
+    ipfs filestore verify --quick > verify_actual &&
+    grep changed verify_actual | grep -q somedir/file3
+  '
+
   # reset the state for the next test
   test_init_dataset
 }
@@ -165,6 +175,71 @@ test_filestore_dups() {
   '
 }
 
+test_filestore_relocate() {
+  test_filestore_state
+
+  test_expect_success "rename the directory" '
+    mv somedir otherdir
+  '
+
+  test_expect_success "'ipfs filestore mv' updates the references" '
+    ipfs filestore mv somedir otherdir > mv_actual &&
+    echo "moved 6 references" > mv_expect &&
+    test_cmp mv_expect mv_actual
+  '
+
+  test_expect_success "blocks can be read from the new location" '
+    ipfs cat $FILE3_HASH > file3.data &&
+    test_cmp otherdir/file3 file3.data
+  '
+
+  test_expect_success "rename the directory back" '
+    mv otherdir somedir &&
+    ipfs filestore mv otherdir somedir
+  '
+
+  test_filestore_state
+
+  test_expect_success "'ipfs filestore verify --quick --remove-bad' keeps the references to touched files" '
+    touch -t 200001010000 somedir/file1 &&
+    ipfs filestore verify --quick --remove-bad --force > verify_actual &&
+    grep changed verify_actual | grep -q somedir/file1 &&
+    ipfs filestore verify $FILE1_HASH | grep -q ok
+  '
+
+  test_expect_success "'ipfs filestore rm PATH' keeps the references to pinned blocks" '
+    ipfs filestore rm somedir/file2 > rm_actual &&
+    grep -q "cannot remove $FILE2_HASH: pinned via $HASH" rm_actual &&
+    ipfs filestore verify $FILE2_HASH | grep -q ok
+  '
+
+  test_expect_success "'ipfs filestore rm PATH' removes the references" '
+    ipfs filestore rm --force somedir/file2 > rm_actual &&
+    echo "removed $FILE2_HASH" > rm_expect &&
+    test_cmp rm_expect rm_actual &&
+    ipfs filestore verify $FILE2_HASH | grep -q missing
+  '
+
+  test_expect_success "'ipfs filestore rm HASH' removes the reference" '
+    ipfs filestore rm --force $FILE1_HASH > rm_actual &&
+    echo "removed $FILE1_HASH" > rm_expect &&
+    test_cmp rm_expect rm_actual &&
+    ipfs filestore rm --force $FILE1_HASH > rm_actual &&
+    grep -q "cannot remove $FILE1_HASH: not in the filestore" rm_actual
+  '
+
+  test_expect_success "'ipfs filestore verify --remove-bad' removes bad references" '
+    rm somedir/file3 &&
+    ipfs filestore verify --remove-bad --force > verify_actual &&
+    grep no-file verify_actual | grep -q somedir/file3 &&
+    ipfs filestore ls > ls_actual &&
+    test_must_be_empty ls_actual
+  '
+
+  # reset the state for the next test
+  test_init_dataset
+}
+
 #
 # No daemon
 #
@@ -177,6 +252,8 @@ test_filestore_verify
 
 test_filestore_dups
 
+test_filestore_relocate
+
 #
 # With daemon
 #
@@ -193,6 +270,8 @@ test_filestore_verify
 
 test_filestore_dups
 
+test_filestore_relocate
+
 test_kill_ipfs_daemon
 
 test_done
@@ -86,6 +86,18 @@ test_expect_success "ipfs filestore verify works with urls" '
   test_cmp verify_expect verify_actual
 '
 
+test_expect_success "ipfs urlstore ls works" '
+  ipfs urlstore ls | sort > ls_actual &&
+  test_cmp ls_expect ls_actual
+'
+
+test_expect_success "ipfs urlstore verify works" '
+  ipfs urlstore verify | sort > verify_actual &&
+  test_cmp verify_expect verify_actual &&
+  ipfs urlstore verify --quick | sort > verify_actual &&
+  test_cmp verify_expect verify_actual
+'
+
 test_expect_success "remove original hashes from local gateway" '
   ipfs pin rm $HASH1a $HASH2a &&
   ipfs repo gc > /dev/null
@@ -112,6 +124,15 @@ test_expect_success "files can not be retrieved via the urlstore" '
   test_must_fail ipfs cat $HASH2 > /dev/null
 '
 
+test_expect_success "ipfs urlstore rm removes the references to a url" '
+  ipfs urlstore rm http://127.0.0.1:$GWAY_PORT/ipfs/$HASH1a > rm_actual &&
+  echo "removed zb2rhjddJ5DNzBrFu8G6CP1ApY25BukwCeskXHzN1H18CiVVZ" > rm_expect &&
+  test_cmp rm_expect rm_actual &&
+  ipfs urlstore ls > ls_actual &&
+  test_line_count = 2 ls_actual &&
+  test_must_fail grep $HASH1a ls_actual
+'
+
 test_expect_success "remove broken files" '
   ipfs pin rm $HASH1 $HASH2 &&
   ipfs repo gc > /dev/null
@@ -137,6 +158,18 @@ test_expect_success "check that the trickle option works" '
   test $HASHat = $HASHut
 '
 
+test_expect_success "add a directory listing recursively via url store" '
+  mkdir dir &&
+  cp file1 file2 dir &&
+  HASHda=$(ipfs add -r -Q dir) &&
+  HASHdn=$(ipfs add -r -Q -n --cid-version=1 --raw-leaves=true dir) &&
+  HASHdu=$(ipfs urlstore add -r http://127.0.0.1:$GWAY_PORT/ipfs/$HASHda) &&
+  test $HASHdn = $HASHdu &&
+  ipfs urlstore ls | grep -c "/ipfs/$HASHda/file" > count_actual &&
+  echo 3 > count_expect &&
+  test_cmp count_expect count_actual
+'
+
 test_kill_ipfs_daemon
 
 test_expect_success "files can not be retrieved via the urlstore" '